@@ -0,0 +1,104 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"time"
+)
+
+// adaptiveBands is how many bands of rows RGBAAdaptive splits dest into.
+// Each band is a point where it can give up on the box filter.
+const adaptiveBands = 32
+
+// RGBAAdaptive is RGBA that gives up quality rather than the result when ctx
+// has a deadline. dest is made in bands of rows, and once the time left is
+// shorter than the last band took, or ctx is done, the remaining rows are
+// sampled from the nearest pixel as RGBAFast does. It never returns
+// ErrAborted: every pixel of dest is written when it returns nil. Without a
+// deadline it is RGBA.
+func RGBAAdaptive(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return RGBA(ctx, dest, src, opts...)
+	}
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaAdaptive(ctx, deadline, dest, src, opts)
+	})
+}
+
+func rgbaAdaptive(ctx context.Context, deadline time.Time, dest *image.RGBA, src *image.RGBA, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		copyRGBA(dest, src, false)
+		return nil
+	}
+	var horz, vert *WeightTable
+	if sw != dw {
+		horz = NewWeightTable(uint32(sw), uint32(dw))
+	}
+	if sh != dh {
+		vert = NewWeightTable(uint32(sh), uint32(dh))
+	}
+	o := newOptions(opts)
+
+	rows := (dh + adaptiveBands - 1) / adaptiveBands
+	var last time.Duration
+	for y := 0; y < dh; y += rows {
+		if ctx.Err() != nil || time.Until(deadline) < last {
+			nnInner(nil, y, dh, dest.Pix, src.Pix, dest.Stride, src.Stride, dw, dh, sw, sh)
+			return nil
+		}
+		start := time.Now()
+		yMax := y + rows
+		if yMax > dh {
+			yMax = dh
+		}
+		if err := adaptiveBand(dest, src, horz, vert, image.Rect(0, y, dw, yMax), o); err != nil {
+			return err
+		}
+		last = time.Since(start)
+	}
+	return nil
+}
+
+// adaptiveBand recomputes the band d of dest with the box filter, split into
+// columns across the workers. It is not aborted by ctx, as a band that was
+// started has to be finished.
+func adaptiveBand(dest *image.RGBA, src *image.RGBA, horz *WeightTable, vert *WeightTable, d image.Rectangle, o *options) error {
+	n := o.workers(d.Dx() * d.Dy())
+	for n > 1 && n<<1 > d.Dx() {
+		n--
+	}
+	h := &handle{}
+	h.wg.Add(n)
+	step := d.Dx() / n
+	x := d.Min.X
+	for i := 0; i < n; i++ {
+		r := image.Rect(x, d.Min.Y, x+step, d.Max.Y)
+		if i == n-1 {
+			r.Max.X = d.Max.X
+		}
+		spawn(func() {
+			defer h.Done()
+			partial8RGBA(dest, src, horz, vert, r, o.rounding)
+		})
+		x += step
+	}
+	return h.Wait(context.Background())
+}
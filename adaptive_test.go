@@ -0,0 +1,65 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestRGBAAdaptive(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(src, src.Rect, testPattern(300, 200), image.Point{}, draw.Src)
+	want := image.NewRGBA(image.Rect(0, 0, 71, 53))
+	if err := RGBA(context.Background(), want, src); err != nil {
+		t.Fatal(err)
+	}
+
+	// with time to spare, it is RGBA.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	got := image.NewRGBA(want.Rect)
+	if err := RGBAAdaptive(ctx, got, src); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want.Pix, got.Pix) {
+		t.Error("differs from RGBA")
+	}
+
+	// past the deadline, every row is sampled as RGBAFast does.
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	<-ctx.Done()
+	fast := image.NewRGBA(want.Rect)
+	if err := RGBAFast(context.Background(), fast, src); err != nil {
+		t.Fatal(err)
+	}
+	got = image.NewRGBA(want.Rect)
+	if err := RGBAAdaptive(ctx, got, src); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fast.Pix, got.Pix) {
+		t.Error("differs from RGBAFast")
+	}
+}
+
+func TestRGBAAdaptiveTightDeadline(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2000, 1500))
+	draw.Draw(src, src.Rect, image.Opaque, image.Point{}, draw.Src)
+	dest := image.NewRGBA(image.Rect(0, 0, 997, 701))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := RGBAAdaptive(ctx, dest, src); err != nil {
+		t.Fatal(err)
+	}
+	// src is opaque, so a row that was never written would stay transparent.
+	for y := 0; y < 701; y++ {
+		for x := 0; x < 997; x++ {
+			if c := dest.RGBAAt(x, y); c.A != 255 || c.R != 255 {
+				t.Fatalf("(%d, %d): want white, got %v", x, y, c)
+			}
+		}
+	}
+}
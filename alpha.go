@@ -0,0 +1,30 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+func Alpha(ctx context.Context, dest *image.Alpha, src *image.Alpha, opts ...Option) error {
+	return Gray(ctx, &image.Gray{
+		Pix:    dest.Pix,
+		Stride: dest.Stride,
+		Rect:   dest.Rect,
+	}, &image.Gray{
+		Pix:    src.Pix,
+		Stride: src.Stride,
+		Rect:   src.Rect,
+	}, opts...)
+}
+
+func Alpha16(ctx context.Context, dest *image.Alpha16, src *image.Alpha16, opts ...Option) error {
+	return Gray16(ctx, &image.Gray16{
+		Pix:    dest.Pix,
+		Stride: dest.Stride,
+		Rect:   dest.Rect,
+	}, &image.Gray16{
+		Pix:    src.Pix,
+		Stride: src.Stride,
+		Rect:   src.Rect,
+	}, opts...)
+}
@@ -0,0 +1,47 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestAlpha(t *testing.T) {
+	// left half is a 1px checkerboard, right half is opaque on top and
+	// transparent on the bottom.
+	src := image.NewAlpha(image.Rect(0, 0, 60, 60))
+	src16 := image.NewAlpha16(src.Rect)
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 60; x++ {
+			if (x < 30 && (x+y)&1 == 0) || (x >= 30 && y < 30) {
+				src.SetAlpha(x, y, color.Alpha{A: 255})
+				src16.SetAlpha16(x, y, color.Alpha16{A: 65535})
+			}
+		}
+	}
+	dest := image.NewAlpha(image.Rect(0, 0, 6, 6))
+	if err := Alpha(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	dest16 := image.NewAlpha16(dest.Rect)
+	if err := Alpha16(context.Background(), dest16, src16); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			want, want16 := uint8(128), uint16(32768)
+			if x >= 3 && y < 3 {
+				want, want16 = 255, 65535
+			} else if x >= 3 {
+				want, want16 = 0, 0
+			}
+			if got := dest.AlphaAt(x, y).A; got != want {
+				t.Errorf("Alpha (%d, %d): want %d, got %d", x, y, want, got)
+			}
+			if got := dest16.Alpha16At(x, y).A; got != want16 {
+				t.Errorf("Alpha16 (%d, %d): want %d, got %d", x, y, want16, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package downscale
+
+import (
+	"context"
+	"errors"
+	"image"
+)
+
+// RGBABatch downscales each srcs[i] into dests[i] like RGBA. Every source
+// must have the same size, and so must every destination, which lets the
+// whole batch share one set of weight tables and one intermediate image.
+func RGBABatch(ctx context.Context, dests []*image.RGBA, srcs []*image.RGBA, opts ...Option) error {
+	var srcPixels, dstPixels int
+	for _, src := range srcs {
+		srcPixels += src.Rect.Dx() * src.Rect.Dy()
+	}
+	for _, dest := range dests {
+		dstPixels += dest.Rect.Dx() * dest.Rect.Dy()
+	}
+	return meteredPixels(ctx, opts, srcPixels, dstPixels, func(ctx context.Context) error {
+		return rgbaBatch(ctx, dests, srcs, opts)
+	})
+}
+
+func rgbaBatch(ctx context.Context, dests []*image.RGBA, srcs []*image.RGBA, opts []Option) error {
+	if len(dests) != len(srcs) {
+		return errors.New("downscale: dests and srcs differ in length")
+	}
+	if len(srcs) == 0 {
+		return nil
+	}
+	sw, sh := srcs[0].Rect.Dx(), srcs[0].Rect.Dy()
+	dw, dh := dests[0].Rect.Dx(), dests[0].Rect.Dy()
+	for i := range srcs {
+		dest, src := dests[i], srcs[i]
+		if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+			return err
+		}
+		if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+			return err
+		}
+		if src.Rect.Dx() != sw || src.Rect.Dy() != sh || dest.Rect.Dx() != dw || dest.Rect.Dy() != dh {
+			return errors.New("downscale: images in a batch must share their sizes")
+		}
+	}
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+
+	o := newOptions(opts)
+	var horz, vert *WeightTable
+	var tmp *image.RGBA
+	if sw != dw {
+		horz = NewWeightTable(uint32(sw), uint32(dw))
+	}
+	if sh != dh {
+		vert = NewWeightTable(uint32(sh), uint32(dh))
+		if horz != nil {
+			tmp = image.NewRGBA(image.Rect(0, 0, dw, sh))
+		}
+	}
+	for i := range srcs {
+		if ctx.Err() != nil {
+			return ErrAborted
+		}
+		dest, src := dests[i], srcs[i]
+		var err error
+		switch {
+		case horz != nil && vert != nil:
+			if err = horz8RGBATable(ctx, tmp, src, horz, false, o); err == nil {
+				err = vert8RGBATable(ctx, dest, tmp, vert, false, false, o)
+			}
+		case horz != nil:
+			err = horz8RGBATable(ctx, dest, src, horz, false, o)
+		case vert != nil:
+			err = vert8RGBATable(ctx, dest, src, vert, false, false, o)
+		default:
+			for y := 0; y < sh; y++ {
+				copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
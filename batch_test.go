@@ -0,0 +1,55 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func TestRGBABatch(t *testing.T) {
+	ctx := context.Background()
+	for _, sz := range []image.Point{{31, 17}, {64, 17}, {31, 48}, {64, 48}} {
+		dests := make([]*image.RGBA, 3)
+		srcs := make([]*image.RGBA, 3)
+		for i := range srcs {
+			srcs[i] = image.NewRGBA(image.Rect(0, 0, 64, 48))
+			draw.Draw(srcs[i], srcs[i].Rect, testPattern(64+i*7, 48), image.Pt(i*7, 0), draw.Src)
+			dests[i] = image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		}
+		if err := RGBABatch(ctx, dests, srcs); err != nil {
+			t.Fatal(err)
+		}
+		for i := range srcs {
+			want := image.NewRGBA(dests[i].Rect)
+			if err := RGBA(ctx, want, srcs[i]); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want.Pix, dests[i].Pix) {
+				t.Errorf("%v #%d: differs from RGBA", sz, i)
+			}
+		}
+	}
+}
+
+func TestRGBABatchSizes(t *testing.T) {
+	ctx := context.Background()
+	srcs := []*image.RGBA{
+		image.NewRGBA(image.Rect(0, 0, 20, 20)),
+		image.NewRGBA(image.Rect(0, 0, 20, 21)),
+	}
+	dests := []*image.RGBA{
+		image.NewRGBA(image.Rect(0, 0, 10, 10)),
+		image.NewRGBA(image.Rect(0, 0, 10, 10)),
+	}
+	if err := RGBABatch(ctx, dests, srcs); err == nil {
+		t.Error("want an error for mismatched source sizes")
+	}
+	if err := RGBABatch(ctx, dests[:1], srcs); err == nil {
+		t.Error("want an error for mismatched lengths")
+	}
+	if err := RGBABatch(ctx, srcs[:1], dests[:1]); err != ErrUpscaleUnsupported {
+		t.Errorf("want ErrUpscaleUnsupported, got %v", err)
+	}
+}
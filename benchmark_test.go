@@ -3,6 +3,7 @@ package downscale
 import (
 	"context"
 	"image"
+	"image/color"
 	"image/draw"
 	"testing"
 )
@@ -12,6 +13,7 @@ func BenchmarkRGBA(b *testing.B) {
 	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
 	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
 	ctx := context.Background()
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		if err := RGBA(ctx, d, s); err != nil {
@@ -33,6 +35,42 @@ func BenchmarkRGBAGamma(b *testing.B) {
 	}
 }
 
+func BenchmarkScalerRGBAGamma(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
+	sc, err := NewScaler(4000, 3000, 1222, 1333, WithGamma(2.2))
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := sc.RGBAGamma(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGammaScalerNRGBAGamma(b *testing.B) {
+	s := image.NewNRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	d := image.NewNRGBA(image.Rect(0, 0, 1222, 1333))
+	sc, err := NewGammaScaler(4000, 3000, 1222, 1333, 2.2)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := sc.NRGBAGamma(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkMakeTable(b *testing.B) {
 	testData := makeTableTestData[0]
 	b.ResetTimer()
@@ -42,3 +80,227 @@ func BenchmarkMakeTable(b *testing.B) {
 		makeTable(testData.dw, dlcmlen, slcmlen)
 	}
 }
+
+func BenchmarkYCbCr(b *testing.B) {
+	s := image.NewYCbCr(image.Rect(0, 0, 4000, 3000), image.YCbCrSubsampleRatio420)
+	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := YCbCr(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkYCbCrViaRGBA(b *testing.B) {
+	s := image.NewYCbCr(image.Rect(0, 0, 4000, 3000), image.YCbCrSubsampleRatio420)
+	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tmp := image.NewRGBA(s.Rect)
+		draw.Draw(tmp, tmp.Rect, s, image.Point{}, draw.Src)
+		if err := RGBA(ctx, d, tmp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRGBAToNRGBA(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.NewUniform(color.RGBA{0x40, 0x40, 0x40, 0x80}), image.Point{}, draw.Src)
+	d := image.NewNRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBAToNRGBA(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRGBAToNRGBAViaRGBA(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.NewUniform(color.RGBA{0x40, 0x40, 0x40, 0x80}), image.Point{}, draw.Src)
+	d := image.NewNRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tmp := image.NewRGBA(d.Rect)
+		if err := RGBA(ctx, tmp, s); err != nil {
+			b.Fatal(err)
+		}
+		draw.Draw(d, d.Rect, tmp, image.Point{}, draw.Src)
+	}
+}
+
+func BenchmarkAborted(b *testing.B) {
+	var h handle
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if h.Aborted() {
+				b.Fatal("aborted")
+			}
+		}
+	})
+}
+
+func newBatch(n int, sw int, sh int, dw int, dh int) ([]*image.RGBA, []*image.RGBA) {
+	dests, srcs := make([]*image.RGBA, n), make([]*image.RGBA, n)
+	for i := range srcs {
+		srcs[i] = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(srcs[i], srcs[i].Rect, image.Opaque, image.Point{}, draw.Src)
+		dests[i] = image.NewRGBA(image.Rect(0, 0, dw, dh))
+	}
+	return dests, srcs
+}
+
+func BenchmarkRGBABatch(b *testing.B) {
+	dests, srcs := newBatch(64, 256, 256, 224, 224)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBABatch(ctx, dests, srcs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRGBABatchIndividual(b *testing.B) {
+	dests, srcs := newBatch(64, 256, 256, 224, 224)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range srcs {
+			if err := RGBA(ctx, dests[j], srcs[j]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkRGBALargeRatio(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 100, 75))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBA(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRGBATall(b *testing.B) {
+	benchmarkRGBATall(b)
+}
+
+func BenchmarkRGBATallVerticalFirst(b *testing.B) {
+	benchmarkRGBATall(b, WithVerticalFirst(true))
+}
+
+func benchmarkRGBATall(b *testing.B, opts ...Option) {
+	s := image.NewRGBA(image.Rect(0, 0, 300, 8000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 256, 100))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBA(ctx, d, s, opts...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRGBAProgressive(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 100, 75))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBAProgressive(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRGBAOpaque(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBAOpaque(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRGBATranslucent(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.NewUniform(color.RGBA{0x40, 0x40, 0x40, 0x80}), image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBA(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRGBANearlyOpaque is the worst case of the opaque detection: the
+// whole source is scanned only to find the last pixel translucent.
+func BenchmarkRGBANearlyOpaque(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	s.Pix[len(s.Pix)-1] = 0xfe
+	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBA(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRGBASmall shows the cost of splitting a small image across many
+// workers; run it with a high -cpu.
+func BenchmarkRGBASmall(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	draw.Draw(s, s.Rect, image.NewUniform(color.RGBA{0x40, 0x40, 0x40, 0x80}), image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBA(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRGBAMostlyOpaque is a photo with a translucent logo in a corner,
+// which keeps it off the opaque path although most rows are opaque.
+func BenchmarkRGBAMostlyOpaque(b *testing.B) {
+	s := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	draw.Draw(s, s.Rect, image.Opaque, image.Point{}, draw.Src)
+	draw.Draw(s, image.Rect(3600, 2700, 3900, 2900), image.NewUniform(color.RGBA{0x40, 0x40, 0x40, 0x80}), image.Point{}, draw.Src)
+	d := image.NewRGBA(image.Rect(0, 0, 1222, 1333))
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := RGBA(ctx, d, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+// CMYK downscales src by averaging each of C, M, Y and K on its own, in
+// device space. No color conversion and no ICC transform is applied, so a
+// pure black stays in the K channel instead of turning into rich black as
+// it would through RGBA.
+func CMYK(ctx context.Context, dest *image.CMYK, src *image.CMYK, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return cmyk(ctx, dest, src, opts)
+	})
+}
+
+func cmyk(ctx context.Context, dest *image.CMYK, src *image.CMYK, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8) || !sumFits(sh, dh, peak8) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+
+	// the opaque passes only see four bytes per pixel, so the images are
+	// handed over as RGBA with the fourth channel kept.
+	d := &image.RGBA{Pix: dest.Pix, Stride: dest.Stride, Rect: dest.Rect}
+	s := &image.RGBA{Pix: src.Pix, Stride: src.Stride, Rect: src.Rect}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := image.NewRGBA(image.Rect(0, 0, dw, sh))
+				h.pass(horzOpaque8RGBA(ctx, tmp, s, true, true, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vertOpaque8RGBA(ctx, d, tmp, true, false, true, o))
+			} else {
+				h.pass(vertOpaque8RGBA(ctx, d, s, true, false, true, o))
+			}
+		} else {
+			h.pass(horzOpaque8RGBA(ctx, d, s, true, true, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
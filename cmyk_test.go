@@ -0,0 +1,48 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestCMYK(t *testing.T) {
+	ctx := context.Background()
+
+	// a pure K gradient must not pick up any C, M or Y.
+	src := image.NewCMYK(image.Rect(0, 0, 60, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 60; x++ {
+			src.Pix[src.PixOffset(x, y)+3] = uint8(x * 4)
+		}
+	}
+	dest := image.NewCMYK(image.Rect(0, 0, 7, 5))
+	if err := CMYK(ctx, dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 7; x++ {
+			c := dest.CMYKAt(x, y)
+			if c.C != 0 || c.M != 0 || c.Y != 0 {
+				t.Errorf("(%d, %d): want pure K, got %v", x, y, c)
+			}
+			if x > 0 && c.K <= dest.CMYKAt(x-1, y).K {
+				t.Errorf("(%d, %d): want K above %d, got %d", x, y, dest.CMYKAt(x-1, y).K, c.K)
+			}
+		}
+	}
+
+	// each channel is averaged on its own.
+	src = image.NewCMYK(image.Rect(0, 0, 2, 2))
+	copy(src.Pix, []uint8{
+		10, 0, 200, 255, 20, 100, 200, 0,
+		30, 0, 0, 255, 40, 100, 0, 0,
+	})
+	dest = image.NewCMYK(image.Rect(0, 0, 1, 1))
+	if err := Scale(ctx, dest, src); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []uint8{25, 50, 100, 128}, dest.Pix; string(want) != string(got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
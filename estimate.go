@@ -0,0 +1,50 @@
+package downscale
+
+import (
+	"image"
+)
+
+// EstimateMemory returns about how many bytes RGBA, or RGBAGamma if gamma is
+// set, allocates to scale an image of srcRect into dstRect. Everything is
+// allocated up front, so it is also close to the peak. It returns 0 when the
+// call would only copy the pixels or would fail on the sizes.
+func EstimateMemory(srcRect image.Rectangle, dstRect image.Rectangle, gamma bool) int64 {
+	sw, sh := srcRect.Dx(), srcRect.Dy()
+	dw, dh := dstRect.Dx(), dstRect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 || sw < dw || sh < dh || IsCopy(srcRect, dstRect) {
+		return 0
+	}
+	w, h, sw64, sh64 := int64(dw), int64(dh), int64(sw), int64(sh)
+	var n int64
+	if sw != dw {
+		n += (w*2 + 2) * 4
+	}
+	if sh != dh {
+		n += (h*2 + 2) * 4
+	}
+	if gamma {
+		// 16-bit copies of the source, the destination and the intermediate.
+		n += sw64*sh64*8 + w*h*8
+		if sw != dw && sh != dh {
+			n += w * sh64 * 8
+		}
+		return n
+	}
+	if sw != dw && sh != dh {
+		n += w * sh64 * 4
+	}
+	o := newOptions(nil)
+	if sw != dw {
+		// every worker of the horizontal pass widens a source row and keeps
+		// the sums of a destination row.
+		workers := o.workers(dw * sh)
+		for workers > 1 && workers<<1 > sh {
+			workers--
+		}
+		n += int64(workers) * (sw64 + w) * 16
+	}
+	if sh != dh {
+		n += w * 16
+	}
+	return n
+}
@@ -0,0 +1,49 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"testing"
+)
+
+func TestEstimateMemory(t *testing.T) {
+	ctx := context.Background()
+	for _, gamma := range []bool{false, true} {
+		for _, sz := range []struct{ sw, sh, dw, dh int }{
+			{1000, 800, 300, 200},
+			{1000, 800, 1000, 200},
+			{1000, 800, 300, 800},
+		} {
+			src := image.NewRGBA(image.Rect(0, 0, sz.sw, sz.sh))
+			dest := image.NewRGBA(image.Rect(0, 0, sz.dw, sz.dh))
+			want := EstimateMemory(src.Rect, dest.Rect, gamma)
+
+			// two collections empty tmpPool, so that RGBA allocates afresh.
+			runtime.GC()
+			runtime.GC()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			var err error
+			if gamma {
+				err = RGBAGamma(ctx, dest, src, 2.2)
+			} else {
+				err = RGBA(ctx, dest, src)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			runtime.ReadMemStats(&after)
+			got := int64(after.TotalAlloc - before.TotalAlloc)
+			if d := got - want; d < -want/10 || d > want/10+16<<10 {
+				t.Errorf("%v %v: want about %d bytes, got %d", sz, gamma, want, got)
+			}
+		}
+	}
+	if got := EstimateMemory(image.Rect(0, 0, 8, 8), image.Rect(0, 0, 8, 8), false); got != 0 {
+		t.Errorf("copy: want 0, got %d", got)
+	}
+	if got := EstimateMemory(image.Rect(0, 0, 8, 8), image.Rect(0, 0, 9, 8), false); got != 0 {
+		t.Errorf("upscale: want 0, got %d", got)
+	}
+}
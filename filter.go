@@ -0,0 +1,745 @@
+package downscale
+
+import (
+	"context"
+	"errors"
+	"image"
+	"math"
+)
+
+type Filter int
+
+const (
+	Box Filter = iota
+	Triangle
+	CatmullRom
+	MitchellNetravali
+	Lanczos3
+)
+
+// EdgeMode selects what the filter kernels read beyond the image bounds.
+// The box filter of RGBA never reads beyond them, so it ignores EdgeMode.
+type EdgeMode int
+
+const (
+	// Clamp ignores the taps beyond the image and spreads their weight over
+	// the rest.
+	Clamp EdgeMode = iota
+	// Wrap reads the opposite edge, so a tiling texture stays seamless.
+	Wrap
+	// Reflect mirrors the image at its edges.
+	Reflect
+)
+
+// edgeIndex maps the source index si, which may lie beyond the sl pixels of
+// the image, to the pixel edge reads there. ok is false for Clamp.
+func edgeIndex(si int, sl int, edge EdgeMode) (int, bool) {
+	switch edge {
+	case Wrap:
+		si %= sl
+		if si < 0 {
+			si += sl
+		}
+		return si, true
+	case Reflect:
+		si %= sl << 1
+		if si < 0 {
+			si += sl << 1
+		}
+		if si >= sl {
+			si = sl<<1 - 1 - si
+		}
+		return si, true
+	}
+	return 0, false
+}
+
+type kernel struct {
+	support float64
+	at      func(x float64) float64
+}
+
+var kernels = [...]kernel{
+	Triangle: {1, func(x float64) float64 {
+		if x < 0 {
+			x = -x
+		}
+		if x < 1 {
+			return 1 - x
+		}
+		return 0
+	}},
+	CatmullRom:        {2, func(x float64) float64 { return bicubic(x, 0, 0.5) }},
+	MitchellNetravali: {2, func(x float64) float64 { return bicubic(x, 1.0/3, 1.0/3) }},
+	Lanczos3: {3, func(x float64) float64 {
+		if x < 0 {
+			x = -x
+		}
+		if x < 1e-9 {
+			return 1
+		}
+		if x < 3 {
+			px := math.Pi * x
+			return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+		}
+		return 0
+	}},
+}
+
+func bicubic(x float64, b float64, c float64) float64 {
+	if x < 0 {
+		x = -x
+	}
+	if x < 1 {
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	}
+	if x < 2 {
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	}
+	return 0
+}
+
+// i32RGBA holds the result of the horizontal pass with coeffBits of extra
+// fractional precision per channel.
+type i32RGBA struct {
+	Rect image.Rectangle
+	Pix  []int32
+}
+
+const coeffBits = 14
+
+// coeffs holds n taps for every destination pixel. Taps that fall outside
+// the source have zero weight, and the remaining weights are renormalized
+// so that they sum to 1<<coeffBits.
+type coeffs struct {
+	n   int
+	idx []int32
+	w   []int32
+}
+
+func makeCoeffs(sl int, dl int, k *kernel, edge EdgeMode) *coeffs {
+	if sl == dl {
+		c := &coeffs{n: 1, idx: make([]int32, dl), w: make([]int32, dl)}
+		for i := range c.idx {
+			c.idx[i] = int32(i)
+			c.w[i] = 1 << coeffBits
+		}
+		return c
+	}
+
+	scale := float64(sl) / float64(dl)
+	fscale := scale
+	if fscale < 1 {
+		fscale = 1
+	}
+	support := k.support * fscale
+	n := int(math.Ceil(support))*2 + 1
+	c := &coeffs{n: n, idx: make([]int32, dl*n), w: make([]int32, dl*n)}
+	fw := make([]float64, n)
+	for x := 0; x < dl; x++ {
+		center := (float64(x)+0.5)*scale - 0.5
+		left := int(math.Ceil(center - support))
+
+		idx, w := c.idx[x*n:x*n+n], c.w[x*n:x*n+n]
+		var sum float64
+		for i := range fw {
+			fw[i] = 0
+			si := left + i
+			ei, ok := si, si >= 0 && si < sl
+			if !ok {
+				ei, ok = edgeIndex(si, sl, edge)
+			}
+			if ok {
+				fw[i] = k.at((float64(si) - center) / fscale)
+				sum += fw[i]
+			} else if si < 0 {
+				ei = 0
+			} else {
+				ei = sl - 1
+			}
+			idx[i] = int32(ei)
+		}
+
+		var total, peak int32
+		for i := range fw {
+			if sum != 0 {
+				w[i] = int32(math.Floor(fw[i]/sum*(1<<coeffBits) + 0.5))
+			}
+			total += w[i]
+			if w[i] > w[peak] {
+				peak = int32(i)
+			}
+		}
+		w[peak] += 1<<coeffBits - total
+	}
+	return c
+}
+
+// maxTapsPerPixel bounds the source pixels under one destination pixel so
+// that an average tap still gets a few levels of its 1<<coeffBits weight.
+const maxTapsPerPixel = 1 << coeffBits >> 2
+
+// checkKernel reports ErrDegenerateFilter when k has no weight for some
+// destination pixel or when the reduction from sl to dl is beyond
+// maxTapsPerPixel. Taps beyond the source count as edge maps them, as they
+// do in makeCoeffs.
+func checkKernel(sl int, dl int, k *kernel, edge EdgeMode) error {
+	if sl == dl {
+		return nil
+	}
+	if sl > dl*maxTapsPerPixel {
+		return ErrDegenerateFilter
+	}
+	scale := float64(sl) / float64(dl)
+	fscale := scale
+	if fscale < 1 {
+		fscale = 1
+	}
+	support := k.support * fscale
+	n := int(math.Ceil(support))*2 + 1
+	for x := 0; x < dl; x++ {
+		center := (float64(x)+0.5)*scale - 0.5
+		left := int(math.Ceil(center - support))
+		var sum float64
+		for i := 0; i < n; i++ {
+			si := left + i
+			if _, ok := edgeIndex(si, sl, edge); ok || si >= 0 && si < sl {
+				sum += k.at((float64(si) - center) / fscale)
+			}
+		}
+		if !(sum > 0) {
+			return ErrDegenerateFilter
+		}
+	}
+	return nil
+}
+
+// CheckFilter reports whether filter produces meaningful output when
+// scaling an image of srcRect's size into one of dstRect's size. It returns
+// ErrDegenerateFilter when the reduction is too large for the precision of
+// the weights. Only the EdgeMode of opts is used.
+func CheckFilter(srcRect image.Rectangle, dstRect image.Rectangle, filter Filter, opts ...Option) error {
+	if filter < Box || int(filter) >= len(kernels) {
+		return errors.New("downscale: unknown filter")
+	}
+	sw, sh := srcRect.Dx(), srcRect.Dy()
+	dw, dh := dstRect.Dx(), dstRect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if filter == Box {
+		if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+			return ErrTooLarge
+		}
+		return nil
+	}
+	edge := newOptions(opts).edge
+	if err := checkKernel(sw, dw, &kernels[filter], edge); err != nil {
+		return err
+	}
+	return checkKernel(sh, dh, &kernels[filter], edge)
+}
+
+func RGBAFilter(ctx context.Context, dest *image.RGBA, src *image.RGBA, filter Filter, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaFilter(ctx, dest, src, filter, opts)
+	})
+}
+
+func rgbaFilter(ctx context.Context, dest *image.RGBA, src *image.RGBA, filter Filter, opts []Option) error {
+	if filter < Box || int(filter) >= len(kernels) {
+		return errors.New("downscale: unknown filter")
+	}
+	if filter == Box {
+		return RGBA(ctx, dest, src, opts...)
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+	o := newOptions(opts)
+	if err := checkKernel(sw, dw, &kernels[filter], o.edge); err != nil {
+		return err
+	}
+	if err := checkKernel(sh, dh, &kernels[filter], o.edge); err != nil {
+		return err
+	}
+	return filterRGBA(ctx, dest, src, &kernels[filter], o)
+}
+
+func RGBALanczos(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return RGBAFilter(ctx, dest, src, Lanczos3, opts...)
+}
+
+// NRGBAFilter is RGBAFilter for straight alpha. Each sample is premultiplied
+// before it is weighted and the result is un-premultiplied afterwards, so
+// the color of transparent pixels does not darken soft edges.
+func NRGBAFilter(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, filter Filter, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaFilter(ctx, dest, src, filter, opts)
+	})
+}
+
+func nrgbaFilter(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, filter Filter, opts []Option) error {
+	if filter < Box || int(filter) >= len(kernels) {
+		return errors.New("downscale: unknown filter")
+	}
+	if filter == Box {
+		return NRGBA(ctx, dest, src, opts...)
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+	o := newOptions(opts)
+	if err := checkKernel(sw, dw, &kernels[filter], o.edge); err != nil {
+		return err
+	}
+	if err := checkKernel(sh, dh, &kernels[filter], o.edge); err != nil {
+		return err
+	}
+	return filterNRGBA(ctx, dest, src, &kernels[filter], o)
+}
+
+func NRGBALanczos(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error {
+	return NRGBAFilter(ctx, dest, src, Lanczos3, opts...)
+}
+
+func RGBAMitchell(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return RGBAFilter(ctx, dest, src, MitchellNetravali, opts...)
+}
+
+// RGBACatmullRom resamples with the Catmull-Rom cubic (B=0, C=0.5), which
+// keeps edges sharper than RGBA. The undershoot of its negative lobes is
+// clamped, so dark edges do not wrap around.
+func RGBACatmullRom(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return RGBAFilter(ctx, dest, src, CatmullRom, opts...)
+}
+
+// tent falls to zero half a destination pixel from the sample center, so it
+// spans two source pixels at a 2x reduction. It is kernels[Triangle] at half
+// the support.
+func tent(x float64) float64 {
+	if x < 0 {
+		x = -x
+	}
+	if x < 0.5 {
+		return 1 - 2*x
+	}
+	return 0
+}
+
+// RGBATriangle resamples with a tent kernel as wide as one destination
+// pixel. It is cheaper than RGBALanczos and smoother than RGBAFast; a 2x
+// reduction averages the two source pixels under each destination pixel.
+//
+// This is not RGBAFilter with Triangle, whose tent is two destination pixels
+// wide and also reaches the neighbors of those pixels, weighting a 2x
+// reduction 1:3:3:1. RGBATriangle is sharper and reads fewer pixels.
+func RGBATriangle(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return RGBAKernel(ctx, dest, src, tent, 0.5, opts...)
+}
+
+// Preset picks a resampling method by its trade-off between speed and
+// quality.
+type Preset int
+
+const (
+	// Fastest samples the nearest source pixel, as RGBAFast does.
+	Fastest Preset = iota
+	// Balanced averages the covered source pixels, as RGBA does.
+	Balanced
+	// Best uses the Lanczos3 filter, as RGBALanczos does.
+	Best
+)
+
+func RGBAPreset(ctx context.Context, dest *image.RGBA, src *image.RGBA, preset Preset, opts ...Option) error {
+	switch preset {
+	case Fastest:
+		return RGBAFast(ctx, dest, src, opts...)
+	case Balanced:
+		return RGBA(ctx, dest, src, opts...)
+	case Best:
+		return RGBALanczos(ctx, dest, src, opts...)
+	}
+	return errors.New("downscale: unknown preset")
+}
+
+func RGBAGaussian(ctx context.Context, dest *image.RGBA, src *image.RGBA, sigma float64, opts ...Option) error {
+	if !(sigma > 0) || math.IsInf(sigma, 1) {
+		return errors.New("downscale: sigma must be a positive finite number")
+	}
+	k := 0.5 / (sigma * sigma)
+	return RGBAKernel(ctx, dest, src, func(x float64) float64 {
+		return math.Exp(-x * x * k)
+	}, 3*sigma, opts...)
+}
+
+// RGBAKernel resamples src into dest with a custom separable kernel fn that
+// is non-zero only within [-support, support].
+//
+// x is the distance from the sample center in source pixels divided by the
+// downscale ratio, so support is effectively in destination pixel units.
+// The weights are normalized by the package, so fn does not need to
+// integrate to 1.
+func RGBAKernel(ctx context.Context, dest *image.RGBA, src *image.RGBA, fn func(x float64) float64, support float64, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaKernel(ctx, dest, src, fn, support, opts)
+	})
+}
+
+func rgbaKernel(ctx context.Context, dest *image.RGBA, src *image.RGBA, fn func(x float64) float64, support float64, opts []Option) error {
+	if fn == nil {
+		return errors.New("downscale: kernel is nil")
+	}
+	if !(support > 0) || math.IsInf(support, 1) {
+		return errors.New("downscale: support must be a positive finite number")
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+	k := &kernel{support: support, at: fn}
+	o := newOptions(opts)
+	if err := checkKernel(sw, dw, k, o.edge); err != nil {
+		return err
+	}
+	if err := checkKernel(sh, dh, k, o.edge); err != nil {
+		return err
+	}
+	return filterRGBA(ctx, dest, src, k, o)
+}
+
+func filterRGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA, k *kernel, o *options) error {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	var h handle
+	h.wg.Add(1)
+	go func() {
+		defer h.Done()
+		tmp := &i32RGBA{
+			Pix:  make([]int32, (dw<<2)*sh),
+			Rect: image.Rect(0, 0, dw, sh),
+		}
+		h.pass(horzFilterRGBA(ctx, tmp, src, makeCoeffs(sw, dw, k, o.edge), o))
+		if h.Aborted() {
+			return
+		}
+		h.pass(vertFilterRGBA(ctx, dest, tmp, makeCoeffs(sh, dh, k, o.edge), o))
+	}()
+	return h.Wait(ctx)
+}
+
+func horzFilterRGBA(ctx context.Context, dest *i32RGBA, src *image.RGBA, c *coeffs, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+
+	h := &handle{every: o.abortEvery()}
+	h.wg.Add(n)
+	step := dh / n
+	y := 0
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horzFilterRGBAInner(h, yMin, yMin+step, dest.Pix, src.Pix, dw<<2, src.Stride, dw, c)
+		})
+		y += step
+	}
+	spawn(func() {
+		horzFilterRGBAInner(h, y, dh, dest.Pix, src.Pix, dw<<2, src.Stride, dw, c)
+	})
+	return h.Wait(ctx)
+}
+
+func vertFilterRGBA(ctx context.Context, dest *image.RGBA, src *i32RGBA, c *coeffs, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+
+	h := &handle{every: o.abortEvery()}
+	h.wg.Add(n)
+	step := dh / n
+	y := 0
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			vertFilterRGBAInner(h, yMin, yMin+step, dest.Pix, src.Pix, dest.Stride, dw<<2, dw, c)
+		})
+		y += step
+	}
+	spawn(func() {
+		vertFilterRGBAInner(h, y, dh, dest.Pix, src.Pix, dest.Stride, dw<<2, dw, c)
+	})
+	return h.Wait(ctx)
+}
+
+func horzFilterRGBAInner(h *handle, yMin int, yMax int, d []int32, s []byte, ds int, ss int, dw int, c *coeffs) {
+	defer h.Done()
+	n := c.n
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(uint32(y)) {
+			return
+		}
+		row := s[y*ss:]
+		di := y * ds
+		for x := 0; x < dw; x++ {
+			idx, w := c.idx[x*n:x*n+n], c.w[x*n:x*n+n]
+			var r, g, b, a int32
+			for i, si := range idx {
+				si <<= 2
+				r += int32(row[si+0]) * w[i]
+				g += int32(row[si+1]) * w[i]
+				b += int32(row[si+2]) * w[i]
+				a += int32(row[si+3]) * w[i]
+			}
+			d[di+0] = r
+			d[di+1] = g
+			d[di+2] = b
+			d[di+3] = a
+			di += 4
+		}
+	}
+}
+
+func vertFilterRGBAInner(h *handle, yMin int, yMax int, d []byte, s []int32, ds int, ss int, dw int, c *coeffs) {
+	defer h.Done()
+	n := c.n
+	acc := make([]int64, dw<<2)
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(uint32(y)) {
+			return
+		}
+		for i := range acc {
+			acc[i] = 0
+		}
+		idx, w := c.idx[y*n:y*n+n], c.w[y*n:y*n+n]
+		for i, si := range idx {
+			if w[i] == 0 {
+				continue
+			}
+			row, wi := s[int(si)*ss:int(si)*ss+len(acc)], int64(w[i])
+			for j, v := range row {
+				acc[j] += int64(v) * wi
+			}
+		}
+		row := d[y*ds : y*ds+len(acc)]
+		for j := 0; j < len(acc); j += 4 {
+			a := clamp8(acc[j+3])
+			row[j+0] = clampMax8(acc[j+0], a)
+			row[j+1] = clampMax8(acc[j+1], a)
+			row[j+2] = clampMax8(acc[j+2], a)
+			row[j+3] = a
+		}
+	}
+}
+
+func filterNRGBA(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, k *kernel, o *options) error {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	var h handle
+	h.wg.Add(1)
+	go func() {
+		defer h.Done()
+		tmp := &i32RGBA{
+			Pix:  make([]int32, (dw<<2)*sh),
+			Rect: image.Rect(0, 0, dw, sh),
+		}
+		h.pass(horzFilterNRGBA(ctx, tmp, src, makeCoeffs(sw, dw, k, o.edge), o))
+		if h.Aborted() {
+			return
+		}
+		h.pass(vertFilterNRGBA(ctx, dest, tmp, makeCoeffs(sh, dh, k, o.edge), o))
+	}()
+	return h.Wait(ctx)
+}
+
+func horzFilterNRGBA(ctx context.Context, dest *i32RGBA, src *image.NRGBA, c *coeffs, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+
+	h := &handle{every: o.abortEvery()}
+	h.wg.Add(n)
+	step := dh / n
+	y := 0
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horzFilterNRGBAInner(h, yMin, yMin+step, dest.Pix, src.Pix, dw<<2, src.Stride, dw, c)
+		})
+		y += step
+	}
+	spawn(func() {
+		horzFilterNRGBAInner(h, y, dh, dest.Pix, src.Pix, dw<<2, src.Stride, dw, c)
+	})
+	return h.Wait(ctx)
+}
+
+func vertFilterNRGBA(ctx context.Context, dest *image.NRGBA, src *i32RGBA, c *coeffs, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+
+	h := &handle{every: o.abortEvery()}
+	h.wg.Add(n)
+	step := dh / n
+	y := 0
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			vertFilterNRGBAInner(h, yMin, yMin+step, dest.Pix, src.Pix, dest.Stride, dw<<2, dw, c)
+		})
+		y += step
+	}
+	spawn(func() {
+		vertFilterNRGBAInner(h, y, dh, dest.Pix, src.Pix, dest.Stride, dw<<2, dw, c)
+	})
+	return h.Wait(ctx)
+}
+
+// horzFilterNRGBAInner premultiplies each sample before weighting it so that
+// the color of transparent pixels does not leak into their neighbors.
+func horzFilterNRGBAInner(h *handle, yMin int, yMax int, d []int32, s []byte, ds int, ss int, dw int, c *coeffs) {
+	defer h.Done()
+	n := c.n
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(uint32(y)) {
+			return
+		}
+		row := s[y*ss:]
+		di := y * ds
+		for x := 0; x < dw; x++ {
+			idx, w := c.idx[x*n:x*n+n], c.w[x*n:x*n+n]
+			var r, g, b, a int32
+			for i, si := range idx {
+				si <<= 2
+				sa := int32(row[si+3])
+				r += mul8(int32(row[si+0]), sa) * w[i]
+				g += mul8(int32(row[si+1]), sa) * w[i]
+				b += mul8(int32(row[si+2]), sa) * w[i]
+				a += sa * w[i]
+			}
+			d[di+0] = r
+			d[di+1] = g
+			d[di+2] = b
+			d[di+3] = a
+			di += 4
+		}
+	}
+}
+
+func vertFilterNRGBAInner(h *handle, yMin int, yMax int, d []byte, s []int32, ds int, ss int, dw int, c *coeffs) {
+	defer h.Done()
+	n := c.n
+	acc := make([]int64, dw<<2)
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(uint32(y)) {
+			return
+		}
+		for i := range acc {
+			acc[i] = 0
+		}
+		idx, w := c.idx[y*n:y*n+n], c.w[y*n:y*n+n]
+		for i, si := range idx {
+			if w[i] == 0 {
+				continue
+			}
+			row, wi := s[int(si)*ss:int(si)*ss+len(acc)], int64(w[i])
+			for j, v := range row {
+				acc[j] += int64(v) * wi
+			}
+		}
+		row := d[y*ds : y*ds+len(acc)]
+		for j := 0; j < len(acc); j += 4 {
+			a := clamp8(acc[j+3])
+			if a == 0 {
+				row[j+0], row[j+1], row[j+2], row[j+3] = 0, 0, 0, 0
+				continue
+			}
+			row[j+0] = unpremul8(acc[j+0], acc[j+3])
+			row[j+1] = unpremul8(acc[j+1], acc[j+3])
+			row[j+2] = unpremul8(acc[j+2], acc[j+3])
+			row[j+3] = a
+		}
+	}
+}
+
+// mul8 returns round(c * a / 255).
+func mul8(c int32, a int32) int32 {
+	v := c*a + 128
+	return (v + v>>8) >> 8
+}
+
+func unpremul8(v int64, a int64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= a {
+		return 255
+	}
+	return uint8((v*255 + a>>1) / a)
+}
+
+const roundBits = coeffBits * 2
+
+func clamp8(v int64) uint8 {
+	v = (v + 1<<(roundBits-1)) >> roundBits
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// clampMax8 is clamp8 that also keeps premultiplied color within alpha.
+func clampMax8(v int64, max uint8) uint8 {
+	if c := clamp8(v); c < max {
+		return c
+	}
+	return max
+}
@@ -0,0 +1,524 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+var filters = []Filter{Box, Triangle, CatmullRom, MitchellNetravali, Lanczos3}
+
+func TestRGBAFilterFlat(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 97, 61))
+	c := color.RGBA{R: 30, G: 120, B: 200, A: 255}
+	for y := 0; y < 61; y++ {
+		for x := 0; x < 97; x++ {
+			src.SetRGBA(x, y, c)
+		}
+	}
+	for _, f := range filters {
+		dest := image.NewRGBA(image.Rect(0, 0, 23, 17))
+		if err := RGBAFilter(context.Background(), dest, src, f); err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 17; y++ {
+			for x := 0; x < 23; x++ {
+				if got := dest.RGBAAt(x, y); got != c {
+					t.Fatalf("filter %d (%d, %d): want %v, got %v", f, x, y, c, got)
+				}
+			}
+		}
+	}
+}
+
+func TestRGBAMitchellFlat(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	c := color.RGBA{R: 20, G: 60, B: 100, A: 128}
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			src.SetRGBA(x, y, c)
+		}
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, 13, 7))
+	if err := RGBAMitchell(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 13; x++ {
+			if got := dest.RGBAAt(x, y); got != c {
+				t.Errorf("(%d, %d): want %v, got %v", x, y, c, got)
+			}
+		}
+	}
+}
+
+func TestRGBAFilterRinging(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 1))
+	for x := 0; x < 64; x++ {
+		v := uint8(64)
+		if x >= 32 {
+			v = 192
+		}
+		src.SetRGBA(x, 0, color.RGBA{v, v, v, 255})
+	}
+	rings := func(f Filter) bool {
+		dest := image.NewRGBA(image.Rect(0, 0, 24, 1))
+		if err := RGBAFilter(context.Background(), dest, src, f); err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 24; x++ {
+			if v := dest.RGBAAt(x, 0).R; v < 64 || v > 192 {
+				return true
+			}
+		}
+		return false
+	}
+	if rings(Box) {
+		t.Error("Box: unexpected ringing")
+	}
+	if !rings(Lanczos3) {
+		t.Error("Lanczos3: want ringing")
+	}
+}
+
+// refFilterRGBA is a straightforward floating point implementation of the
+// separable resampling used to validate the fixed point one.
+func refFilterRGBA(dest *image.RGBA, src *image.RGBA, k *kernel) {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	weights := func(sl int, dl int, x int) map[int]float64 {
+		scale := float64(sl) / float64(dl)
+		fscale := scale
+		if fscale < 1 {
+			fscale = 1
+		}
+		center := (float64(x)+0.5)*scale - 0.5
+		r := map[int]float64{}
+		var sum float64
+		for i := 0; i < sl; i++ {
+			if w := k.at((float64(i) - center) / fscale); w != 0 {
+				r[i] = w
+				sum += w
+			}
+		}
+		for i := range r {
+			r[i] /= sum
+		}
+		return r
+	}
+	tmp := make([]float64, dw*sh*4)
+	for x := 0; x < dw; x++ {
+		for i, w := range weights(sw, dw, x) {
+			for y := 0; y < sh; y++ {
+				for c := 0; c < 4; c++ {
+					tmp[(y*dw+x)*4+c] += float64(src.Pix[src.PixOffset(i, y)+c]) * w
+				}
+			}
+		}
+	}
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var v [4]float64
+			for i, w := range weights(sh, dh, y) {
+				for c := 0; c < 4; c++ {
+					v[c] += tmp[(i*dw+x)*4+c] * w
+				}
+			}
+			for c := 3; c >= 0; c-- {
+				f := math.Floor(v[c] + 0.5)
+				if f < 0 {
+					f = 0
+				} else if f > 255 {
+					f = 255
+				}
+				if c < 3 && f > float64(dest.Pix[dest.PixOffset(x, y)+3]) {
+					f = float64(dest.Pix[dest.PixOffset(x, y)+3])
+				}
+				dest.Pix[dest.PixOffset(x, y)+c] = uint8(f)
+			}
+		}
+	}
+}
+
+func TestRGBALanczos(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 50, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 50; x++ {
+			a := uint8(128 + (x*y)%128)
+			v := uint8((x*37 + y*11) % 256)
+			if v > a {
+				v = a
+			}
+			src.SetRGBA(x, y, color.RGBA{v, a - v, v / 2, a})
+		}
+	}
+	got := image.NewRGBA(image.Rect(0, 0, 17, 13))
+	if err := RGBALanczos(context.Background(), got, src); err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewRGBA(got.Rect)
+	refFilterRGBA(want, src, &kernels[Lanczos3])
+	for i := range got.Pix {
+		if d := int(got.Pix[i]) - int(want.Pix[i]); d > 2 || d < -2 {
+			t.Errorf("Pix[%d]: want %d, got %d", i, want.Pix[i], got.Pix[i])
+		}
+	}
+}
+
+func TestNRGBALanczos(t *testing.T) {
+	// a white disc with a soft edge on a transparent black background.
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			d := math.Hypot(float64(x)-31.5, float64(y)-31.5)
+			if a := (24 - d) * 32; a > 0 {
+				src.SetNRGBA(x, y, color.NRGBA{255, 255, 255, uint8(math.Min(a, 255))})
+			}
+		}
+	}
+	dest := image.NewNRGBA(image.Rect(0, 0, 21, 21))
+	if err := NRGBALanczos(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	var edge int
+	for y := 0; y < 21; y++ {
+		for x := 0; x < 21; x++ {
+			c := dest.NRGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+			if c.A < 255 {
+				edge++
+			}
+			if c.R != 255 || c.G != 255 || c.B != 255 {
+				t.Errorf("(%d, %d): dark fringe %v", x, y, c)
+			}
+		}
+	}
+	if edge == 0 {
+		t.Error("want a soft edge")
+	}
+}
+
+func TestRGBAGaussian(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 90, 90))
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 90; x++ {
+			v := uint8(0)
+			if (x/2+y/2)&1 == 0 {
+				v = 255
+			}
+			src.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	energy := func(sigma float64) int {
+		dest := image.NewRGBA(image.Rect(0, 0, 40, 40))
+		if err := RGBAGaussian(context.Background(), dest, src, sigma); err != nil {
+			t.Fatal(err)
+		}
+		var e int
+		for y := 0; y < 40; y++ {
+			for x := 1; x < 40; x++ {
+				d := int(dest.RGBAAt(x, y).G) - int(dest.RGBAAt(x-1, y).G)
+				e += d * d
+			}
+		}
+		return e
+	}
+	prev := energy(0.3)
+	for _, sigma := range []float64{0.6, 1, 2} {
+		e := energy(sigma)
+		if e >= prev {
+			t.Errorf("sigma %v: want energy below %d, got %d", sigma, prev, e)
+		}
+		prev = e
+	}
+	if err := RGBAGaussian(context.Background(), image.NewRGBA(image.Rect(0, 0, 4, 4)), src, 0); err == nil {
+		t.Error("sigma 0: want error, got nil")
+	}
+}
+
+func TestRGBAKernel(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 57, 31))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 13)
+		if i&3 == 3 {
+			src.Pix[i] = 255
+		}
+	}
+	got := image.NewRGBA(image.Rect(0, 0, 20, 11))
+	triangle := func(x float64) float64 {
+		if x < 0 {
+			x = -x
+		}
+		if x < 1 {
+			return 1 - x
+		}
+		return 0
+	}
+	if err := RGBAKernel(context.Background(), got, src, triangle, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewRGBA(got.Rect)
+	if err := RGBAFilter(context.Background(), want, src, Triangle); err != nil {
+		t.Fatal(err)
+	}
+	for i := range got.Pix {
+		if got.Pix[i] != want.Pix[i] {
+			t.Fatalf("Pix[%d]: want %d, got %d", i, want.Pix[i], got.Pix[i])
+		}
+	}
+}
+
+func TestRGBACatmullRom(t *testing.T) {
+	// a soft edge, as in a photograph, rising from 0 to 255 over 8 pixels.
+	src := image.NewRGBA(image.Rect(0, 0, 64, 1))
+	for x := 0; x < 64; x++ {
+		v := uint8(255/(1+math.Exp(-(float64(x)-31.5)/2)) + 0.5)
+		src.SetRGBA(x, 0, color.RGBA{v, v, v, 255})
+	}
+	acutance := func(dest *image.RGBA) int {
+		var sum int
+		for x := 1; x < dest.Rect.Dx(); x++ {
+			d := int(dest.RGBAAt(x, 0).R) - int(dest.RGBAAt(x-1, 0).R)
+			sum += d * d
+		}
+		return sum
+	}
+	box := image.NewRGBA(image.Rect(0, 0, 24, 1))
+	if err := RGBA(context.Background(), box, src); err != nil {
+		t.Fatal(err)
+	}
+	got := image.NewRGBA(box.Rect)
+	if err := RGBACatmullRom(context.Background(), got, src); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := acutance(got), acutance(box); a <= b {
+		t.Errorf("want a higher acutance than box %d, got %d", b, a)
+	}
+	for x := 1; x < 24; x++ {
+		if l, r := got.RGBAAt(x-1, 0).R, got.RGBAAt(x, 0).R; l > r {
+			t.Errorf("(%d, 0): want the clamped edge to be monotonic, got %d after %d", x, r, l)
+		}
+	}
+	want := image.NewRGBA(box.Rect)
+	refFilterRGBA(want, src, &kernels[CatmullRom])
+	for i := range got.Pix {
+		if d := int(got.Pix[i]) - int(want.Pix[i]); d > 2 || d < -2 {
+			t.Errorf("Pix[%d]: want %d, got %d", i, want.Pix[i], got.Pix[i])
+		}
+	}
+}
+
+func TestRGBATriangle(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 13)
+	}
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 255
+	}
+	for _, sz := range []image.Point{{20, 30}, {40, 15}, {20, 15}} {
+		got := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBATriangle(context.Background(), got, src); err != nil {
+			t.Fatal(err)
+		}
+		sx, sy := 40/sz.X, 30/sz.Y
+		for y := 0; y < sz.Y; y++ {
+			for x := 0; x < sz.X; x++ {
+				for c := 0; c < 4; c++ {
+					var sum int
+					for j := 0; j < sy; j++ {
+						for i := 0; i < sx; i++ {
+							sum += int(src.Pix[src.PixOffset(x*sx+i, y*sy+j)+c])
+						}
+					}
+					n := sx * sy
+					want := uint8((sum + n/2) / n)
+					if got := got.Pix[got.PixOffset(x, y)+c]; got != want {
+						t.Fatalf("%v (%d, %d)[%d]: want %d, got %d", sz, x, y, c, want, got)
+					}
+				}
+			}
+		}
+	}
+
+	// the Triangle filter is twice as wide and weights a 2x reduction 1:3:3:1.
+	line := image.NewRGBA(image.Rect(0, 0, 8, 1))
+	line.SetRGBA(3, 0, color.RGBA{255, 255, 255, 255})
+	for i := 3; i < len(line.Pix); i += 4 {
+		line.Pix[i] = 255
+	}
+	tri, filt := image.NewRGBA(image.Rect(0, 0, 4, 1)), image.NewRGBA(image.Rect(0, 0, 4, 1))
+	if err := RGBATriangle(context.Background(), tri, line); err != nil {
+		t.Fatal(err)
+	}
+	if err := RGBAFilter(context.Background(), filt, line, Triangle); err != nil {
+		t.Fatal(err)
+	}
+	if got := [2]uint8{tri.Pix[4], tri.Pix[8]}; got != [2]uint8{128, 0} {
+		t.Errorf("RGBATriangle: want [128 0], got %v", got)
+	}
+	if got := [2]uint8{filt.Pix[4], filt.Pix[8]}; got != [2]uint8{96, 32} {
+		t.Errorf("RGBAFilter Triangle: want [96 32], got %v", got)
+	}
+}
+
+func TestCheckFilter(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3000, 2))
+	var sum int
+	for x := 0; x < 3000; x++ {
+		v := uint8(x * 7)
+		sum += int(v)
+		src.SetRGBA(x, 0, color.RGBA{v, v, v, 255})
+		src.SetRGBA(x, 1, color.RGBA{v, v, v, 255})
+	}
+	if err := CheckFilter(src.Rect, image.Rect(0, 0, 1, 1), Lanczos3); err != nil {
+		t.Fatal(err)
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	if err := RGBALanczos(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint8((sum+1500)/3000), dest.Pix[0]; got == 0 || int(got)-int(want) > 2 || int(want)-int(got) > 2 {
+		t.Errorf("want about %d, got %d", want, got)
+	}
+
+	huge := image.Rect(0, 0, 100000, 1)
+	for _, f := range []Filter{Triangle, CatmullRom, Lanczos3} {
+		if err := CheckFilter(huge, image.Rect(0, 0, 1, 1), f); err != ErrDegenerateFilter {
+			t.Errorf("filter %d: want ErrDegenerateFilter, got %v", f, err)
+		}
+	}
+	if err := CheckFilter(huge, image.Rect(0, 0, 1, 1), Box); err != nil {
+		t.Errorf("Box: want nil, got %v", err)
+	}
+	if err := CheckFilter(huge, image.Rect(0, 0, 0, 1), Lanczos3); err != ErrInvalidSize {
+		t.Errorf("want ErrInvalidSize, got %v", err)
+	}
+
+	// a kernel that misses every tap would leave dest black.
+	spike := func(x float64) float64 {
+		if x > 0.1 && x < 0.2 {
+			return 1
+		}
+		return 0
+	}
+	if err := RGBAKernel(context.Background(), image.NewRGBA(image.Rect(0, 0, 2, 2)), image.NewRGBA(image.Rect(0, 0, 4, 4)), spike, 0.2); err != ErrDegenerateFilter {
+		t.Errorf("want ErrDegenerateFilter, got %v", err)
+	}
+
+	// this kernel only weights the tap one pixel left of the first, which
+	// exists only when the edge mode reads beyond the image.
+	left := func(x float64) float64 {
+		if x > -0.8 && x < -0.7 {
+			return 1
+		}
+		return 0
+	}
+	for edge, want := range map[EdgeMode]error{Clamp: ErrDegenerateFilter, Wrap: nil, Reflect: nil} {
+		err := RGBAKernel(context.Background(), image.NewRGBA(image.Rect(0, 0, 2, 2)), image.NewRGBA(image.Rect(0, 0, 4, 4)), left, 1, WithEdgeMode(edge))
+		if err != want {
+			t.Errorf("edge %d: want %v, got %v", edge, want, err)
+		}
+	}
+}
+
+func TestRGBAPreset(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 50, 40))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 255
+	}
+	for _, tc := range []struct {
+		name   string
+		preset Preset
+		fn     func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error
+	}{
+		{"Fastest", Fastest, RGBAFast},
+		{"Balanced", Balanced, RGBA},
+		{"Best", Best, RGBALanczos},
+	} {
+		want := image.NewRGBA(image.Rect(0, 0, 17, 13))
+		if err := tc.fn(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		if err := RGBAPreset(ctx, got, src, tc.preset); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%s: differs from its method", tc.name)
+		}
+	}
+	if err := RGBAPreset(ctx, image.NewRGBA(image.Rect(0, 0, 17, 13)), src, Best+1); err == nil {
+		t.Error("want an error for an unknown preset")
+	}
+}
+
+func TestWithEdgeMode(t *testing.T) {
+	ctx := context.Background()
+	tile := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 30; x++ {
+			v := uint8((x*53 + y*97) % 256)
+			tile.SetRGBA(x, y, color.RGBA{v, 255 - v, uint8(x * 8), 255})
+		}
+	}
+	// the center of a 3x3 tiling sees the same neighbors that Wrap reads.
+	tiled := image.NewRGBA(image.Rect(0, 0, 90, 90))
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 90; x++ {
+			tiled.SetRGBA(x, y, tile.RGBAAt(x%30, y%30))
+		}
+	}
+	want := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	if err := RGBALanczos(ctx, want, tiled); err != nil {
+		t.Fatal(err)
+	}
+	got := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	if err := RGBALanczos(ctx, got, tile, WithEdgeMode(Wrap)); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if g, w := got.RGBAAt(x, y), want.RGBAAt(x+10, y+10); g != w {
+				t.Errorf("Wrap (%d, %d): want %v, got %v", x, y, w, g)
+			}
+		}
+	}
+
+	// mirroring the tile in both directions makes Reflect match likewise.
+	mirrored := image.NewRGBA(image.Rect(0, 0, 90, 90))
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 90; x++ {
+			sx, sy := x%30, y%30
+			if x/30 != 1 {
+				sx = 29 - sx
+			}
+			if y/30 != 1 {
+				sy = 29 - sy
+			}
+			mirrored.SetRGBA(x, y, tile.RGBAAt(sx, sy))
+		}
+	}
+	if err := RGBALanczos(ctx, want, mirrored); err != nil {
+		t.Fatal(err)
+	}
+	if err := RGBALanczos(ctx, got, tile, WithEdgeMode(Reflect)); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if g, w := got.RGBAAt(x, y), want.RGBAAt(x+10, y+10); g != w {
+				t.Errorf("Reflect (%d, %d): want %v, got %v", x, y, w, g)
+			}
+		}
+	}
+}
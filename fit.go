@@ -0,0 +1,107 @@
+package downscale
+
+import (
+	"context"
+	"errors"
+	"image"
+	"math"
+)
+
+// FitRGBA downscales src to the largest size that fits within maxW x maxH
+// while keeping its aspect ratio. src is copied when it already fits.
+func FitRGBA(ctx context.Context, src *image.RGBA, maxW int, maxH int, opts ...Option) (*image.RGBA, error) {
+	if maxW <= 0 || maxH <= 0 {
+		return nil, errors.New("downscale: invalid fit size")
+	}
+	if src.Rect.Empty() {
+		return nil, errors.New("downscale: empty source image")
+	}
+	dw, dh := FitSize(src.Rect.Dx(), src.Rect.Dy(), maxW, maxH)
+	dest := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	if err := RGBA(ctx, dest, src, opts...); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// FitSize returns the size FitRGBA scales a sw x sh image to: the largest
+// that fits within maxW x maxH with the same aspect ratio, at least 1x1, or
+// sw x sh when it already fits.
+func FitSize(sw int, sh int, maxW int, maxH int) (int, int) {
+	if sw <= maxW && sh <= maxH {
+		return sw, sh
+	}
+	var dw, dh int
+	if sw*maxH > sh*maxW {
+		dw, dh = maxW, (sh*maxW+sw/2)/sw
+	} else {
+		dw, dh = (sw*maxH+sh/2)/sh, maxH
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	return dw, dh
+}
+
+// RGBAScaleBy downscales src to its size multiplied by factor, rounded to
+// the nearest pixel and at least 1. factor must be in (0, 1]; RGBAUpscale
+// is for enlarging.
+func RGBAScaleBy(ctx context.Context, src *image.RGBA, factor float64, opts ...Option) (*image.RGBA, error) {
+	if !(factor > 0 && factor <= 1) {
+		return nil, errors.New("downscale: scale factor must be in (0, 1]")
+	}
+	if src.Rect.Empty() {
+		return nil, errors.New("downscale: empty source image")
+	}
+	dw, dh := scaleBySize(src.Rect.Dx(), factor), scaleBySize(src.Rect.Dy(), factor)
+	dest := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	if err := RGBA(ctx, dest, src, opts...); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+func scaleBySize(l int, factor float64) int {
+	if n := int(math.Round(float64(l) * factor)); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// FillRGBA scales src so that it covers w x h and crops the overflow evenly
+// from both sides, producing an image of exactly w x h.
+func FillRGBA(ctx context.Context, src *image.RGBA, w int, h int, opts ...Option) (*image.RGBA, error) {
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("downscale: invalid fill size")
+	}
+	if src.Rect.Empty() {
+		return nil, errors.New("downscale: empty source image")
+	}
+	r := fillRect(src.Rect, w, h)
+	dest := image.NewRGBA(image.Rect(0, 0, w, h))
+	if err := RGBA(ctx, dest, src.SubImage(r).(*image.RGBA), opts...); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// fillRect returns the centered sub-rectangle of r that has the aspect ratio
+// of w x h.
+func fillRect(r image.Rectangle, w int, h int) image.Rectangle {
+	sw, sh := r.Dx(), r.Dy()
+	cw, ch := sw, sh
+	if sw*h > sh*w {
+		if cw = (sh*w + h/2) / h; cw < 1 {
+			cw = 1
+		}
+	} else {
+		if ch = (sw*h + w/2) / w; ch < 1 {
+			ch = 1
+		}
+	}
+	min := r.Min.Add(image.Pt((sw-cw)/2, (sh-ch)/2))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(cw, ch))}
+}
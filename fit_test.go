@@ -0,0 +1,114 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestFitRGBA(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	dest, err := FitRGBA(context.Background(), src, 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dest.Rect.Size(); got != (image.Point{100, 75}) {
+		t.Errorf("want 100x75, got %dx%d", got.X, got.Y)
+	}
+}
+
+func TestFitSize(t *testing.T) {
+	for _, c := range []struct {
+		sw, sh, maxW, maxH int
+		dw, dh             int
+	}{
+		{4000, 3000, 100, 100, 100, 75},
+		{3000, 4000, 100, 100, 75, 100},
+		{640, 480, 320, 320, 320, 240},
+		{100, 50, 200, 200, 100, 50},
+		{10000, 1, 100, 100, 100, 1},
+		{1, 10000, 100, 100, 1, 100},
+		{300, 200, 100, 50, 75, 50},
+	} {
+		dw, dh := FitSize(c.sw, c.sh, c.maxW, c.maxH)
+		if dw != c.dw || dh != c.dh {
+			t.Errorf("%dx%d in %dx%d: want %dx%d, got %dx%d", c.sw, c.sh, c.maxW, c.maxH, c.dw, c.dh, dw, dh)
+		}
+	}
+}
+
+func TestRGBAScaleBy(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	for _, c := range []struct {
+		factor float64
+		w, h   int
+	}{
+		{0.5, 50, 40},
+		{1, 100, 80},
+		{0.333, 33, 27},
+		{0.001, 1, 1},
+	} {
+		dest, err := RGBAScaleBy(ctx, src, c.factor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := dest.Rect.Size(); got != (image.Point{c.w, c.h}) {
+			t.Errorf("%v: want %dx%d, got %dx%d", c.factor, c.w, c.h, got.X, got.Y)
+		}
+	}
+	for _, factor := range []float64{0, -0.5, 1.5, math.NaN()} {
+		if _, err := RGBAScaleBy(ctx, src, factor); err == nil {
+			t.Errorf("%v: want error, got nil", factor)
+		}
+	}
+}
+
+func TestFillRGBA(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.RGBA{G: 255, A: 255}
+			if x < 50 {
+				c = color.RGBA{R: 255, A: 255}
+			} else if x >= 150 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	dest, err := FillRGBA(context.Background(), src, 50, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dest.Rect.Size(); got != (image.Point{50, 50}) {
+		t.Fatalf("want 50x50, got %dx%d", got.X, got.Y)
+	}
+	want := color.RGBA{G: 255, A: 255}
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 50; x++ {
+			if got := dest.RGBAAt(x, y); got != want {
+				t.Fatalf("(%d, %d): want %v, got %v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestFillRect(t *testing.T) {
+	for _, c := range []struct {
+		r    image.Rectangle
+		w, h int
+		want image.Rectangle
+	}{
+		{image.Rect(0, 0, 200, 100), 50, 50, image.Rect(50, 0, 150, 100)},
+		{image.Rect(0, 0, 100, 200), 50, 50, image.Rect(0, 50, 100, 150)},
+		{image.Rect(10, 20, 410, 320), 200, 100, image.Rect(10, 70, 410, 270)},
+		{image.Rect(0, 0, 64, 48), 32, 24, image.Rect(0, 0, 64, 48)},
+	} {
+		if got := fillRect(c.r, c.w, c.h); got != c.want {
+			t.Errorf("%v to %dx%d: want %v, got %v", c.r, c.w, c.h, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package downscale
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// Float32RGBA downscales a sw x sh image of four float32 channels per pixel
+// in sPix into the dw x dh image in dPix, both tightly packed. Each channel
+// is averaged on its own with the same weights as RGBA, without any gamma,
+// premultiplication or clamping, so values above 1.0 of linear HDR images
+// are kept.
+func Float32RGBA(ctx context.Context, dPix []float32, sPix []float32, dw int, dh int, sw int, sh int, opts ...Option) error {
+	return metered(ctx, opts, image.Rect(0, 0, sw, sh), image.Rect(0, 0, dw, dh), func(ctx context.Context) error {
+		return float32RGBA(ctx, dPix, sPix, dw, dh, sw, sh, opts)
+	})
+}
+
+func float32RGBA(ctx context.Context, dPix []float32, sPix []float32, dw int, dh int, sw int, sh int, opts []Option) error {
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if len(dPix) < dw*dh<<2 {
+		return fmt.Errorf("downscale: dPix (len %d) is too small for %dx%d", len(dPix), dw, dh)
+	}
+	if len(sPix) < sw*sh<<2 {
+		return fmt.Errorf("downscale: sPix (len %d) is too small for %dx%d", len(sPix), sw, sh)
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+		return ErrTooLarge
+	}
+	if sw == dw && sh == dh {
+		copy(dPix[:dw*dh<<2], sPix)
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := make([]float32, dw*sh<<2)
+				h.pass(horzF32RGBA(ctx, tmp, sPix, dw, sw, sh, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vertF32RGBA(ctx, dPix, tmp, dw, dh, sh, o))
+			} else {
+				h.pass(vertF32RGBA(ctx, dPix, sPix, dw, dh, sh, o))
+			}
+		} else {
+			h.pass(horzF32RGBA(ctx, dPix, sPix, dw, sw, sh, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+func horzF32RGBA(ctx context.Context, d []float32, s []float32, dw int, sw int, h int, o *options) error {
+	n := o.workers(dw * h)
+	for n > 1 && n<<1 > h {
+		n--
+	}
+
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(uint32(sw), uint32(dw))
+	if err != nil {
+		return err
+	}
+
+	hd := &handle{every: o.abortEvery()}
+	hd.wg.Add(n)
+	step := uint32(h / n)
+	y := uint32(0)
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horzF32RGBAInner(hd, yMin, yMin+step, d, s, uint32(dw), uint32(sw), dlcmlen, slcmlen, tt, ft)
+		})
+		y += step
+	}
+	spawn(func() {
+		horzF32RGBAInner(hd, y, uint32(h), d, s, uint32(dw), uint32(sw), dlcmlen, slcmlen, tt, ft)
+	})
+	return hd.Wait(ctx)
+}
+
+func vertF32RGBA(ctx context.Context, d []float32, s []float32, w int, dh int, sh int, o *options) error {
+	n := o.workers(w * dh)
+	for n > 1 && n<<1 > w {
+		n--
+	}
+
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(uint32(sh), uint32(dh))
+	if err != nil {
+		return err
+	}
+
+	h := &handle{every: o.abortEvery()}
+	h.wg.Add(n)
+	step := uint32(w/n) << 2
+	x := uint32(0)
+	for i := 1; i < n; i++ {
+		xMin := x
+		spawn(func() {
+			vertF32RGBAInner(h, xMin, xMin+step, d, s, uint32(w)<<2, dlcmlen, slcmlen, uint32(dh), tt, ft)
+		})
+		x += step
+	}
+	spawn(func() {
+		vertF32RGBAInner(h, x, uint32(w)<<2, d, s, uint32(w)<<2, dlcmlen, slcmlen, uint32(dh), tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func horzF32RGBAInner(h *handle, yMin uint32, yMax uint32, d []float32, s []float32, dw uint32, sw uint32, dlcmlen uint32, slcmlen uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	// the weights are scaled so that the taps of a pixel sum to one.
+	inv := 1 / float32(dlcmlen)
+	wm := float32(slcmlen) * inv
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		si, di := y*sw<<2, y*dw<<2
+		for x, fr := uint32(0), uint32(0); x < dw; x++ {
+			tl, tr := tt[x], tt[x+1]
+			wl := float32(slcmlen-fr) * inv
+			fr = ft[x]
+			// fl is never zero because ft holds remainders of slcmlen.
+			r := s[si+0] * wl
+			g := s[si+1] * wl
+			b := s[si+2] * wl
+			a := s[si+3] * wl
+			si += 4
+			for i := tl + 1; i < tr; i++ {
+				r += s[si+0] * wm
+				g += s[si+1] * wm
+				b += s[si+2] * wm
+				a += s[si+3] * wm
+				si += 4
+			}
+			if fr != 0 {
+				wr := float32(fr) * inv
+				r += s[si+0] * wr
+				g += s[si+1] * wr
+				b += s[si+2] * wr
+				a += s[si+3] * wr
+			}
+			d[di+0] = r
+			d[di+1] = g
+			d[di+2] = b
+			d[di+3] = a
+			di += 4
+		}
+	}
+}
+
+func vertF32RGBAInner(h *handle, xMin uint32, xMax uint32, d []float32, s []float32, stride uint32, dlcmlen uint32, slcmlen uint32, dh uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	inv := 1 / float32(dlcmlen)
+	wm := float32(slcmlen) * inv
+	n := xMax - xMin
+	for y, fr := uint32(0), uint32(0); y < dh; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		tl, tr := tt[y], tt[y+1]
+		wl := float32(slcmlen-fr) * inv
+		fr = ft[y]
+		acc := d[y*stride+xMin : y*stride+xMax]
+		si := tl*stride + xMin
+		row := s[si : si+n]
+		for i, v := range row {
+			acc[i] = v * wl
+		}
+		for i := tl + 1; i < tr; i++ {
+			si += stride
+			row = s[si : si+n]
+			for j, v := range row {
+				acc[j] += v * wm
+			}
+		}
+		if fr != 0 {
+			wr := float32(fr) * inv
+			si += stride
+			row = s[si : si+n]
+			for j, v := range row {
+				acc[j] += v * wr
+			}
+		}
+	}
+}
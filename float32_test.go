@@ -0,0 +1,60 @@
+package downscale
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestFloat32RGBA(t *testing.T) {
+	ctx := context.Background()
+	const sw, sh, dw, dh = 9, 7, 4, 3
+	src := make([]float32, sw*sh*4)
+	for i := range src {
+		src[i] = float32(i%13) * 2.5
+	}
+	got := make([]float32, dw*dh*4)
+	if err := Float32RGBA(ctx, got, src, dw, dh, sw, sh); err != nil {
+		t.Fatal(err)
+	}
+	// the box filter covers sw/dw x sh/dh source pixels, partially at the
+	// edges.
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			for c := 0; c < 4; c++ {
+				var sum, area float64
+				for sy := 0; sy < sh; sy++ {
+					wy := overlap(float64(sy), float64(dy)*sh/dh, float64(dy+1)*sh/dh)
+					for sx := 0; sx < sw; sx++ {
+						w := wy * overlap(float64(sx), float64(dx)*sw/dw, float64(dx+1)*sw/dw)
+						sum += float64(src[(sy*sw+sx)*4+c]) * w
+						area += w
+					}
+				}
+				want, g := sum/area, float64(got[(dy*dw+dx)*4+c])
+				if math.Abs(want-g) > 1e-4 {
+					t.Errorf("(%d, %d)[%d]: want %v, got %v", dx, dy, c, want, g)
+				}
+			}
+		}
+	}
+
+	// values above 1.0 are not clamped.
+	src = []float32{4, 8, 16, 1, 2, 4, 8, 1, 6, 0, 0, 1, 0, 0, 0, 1}
+	got = make([]float32, 4)
+	if err := Float32RGBA(ctx, got, src, 1, 1, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{3, 3, 6, 1}; got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if err := Float32RGBA(ctx, got, src[:15], 1, 1, 2, 2); err == nil {
+		t.Error("want error for a short sPix, got nil")
+	}
+}
+
+// overlap returns how much of the unit pixel at p lies within [l, r).
+func overlap(p float64, l float64, r float64) float64 {
+	return math.Max(0, math.Min(p+1, r)-math.Max(p, l))
+}
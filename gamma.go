@@ -2,9 +2,8 @@ package downscale
 
 import (
 	"context"
-	"errors"
 	"image"
-	"runtime"
+	"math"
 )
 
 type u16NRGBA struct {
@@ -12,228 +11,243 @@ type u16NRGBA struct {
 	Pix  []uint16
 }
 
-func NRGBAGamma(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, gamma float64) error {
-	sw, sh := src.Rect.Dx(), src.Rect.Dy()
-	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
-	if sw < dw || sh < dh {
-		return errors.New("upscale is not supported")
-	}
-	if sw == dw && sh == dh {
-		copy(dest.Pix, src.Pix)
-		return nil
+func NRGBAGamma(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, gamma float64, opts ...Option) error {
+	if err := checkGamma(gamma); err != nil {
+		return err
 	}
+	t8, t16 := getGammaTable(gamma)
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaGamma(ctx, dest, src, [3]*[256]uint16{t8, t8, t8}, tableEncoder([3]*[65536]uint8{t16, t16, t16}), newOptions(opts))
+	})
+}
 
-	var h handle
-	h.wg.Add(1)
-	go func() {
-		defer h.Done()
-
-		t8, t16 := makeGammaTable(gamma)
-		tmpSrc := &u16NRGBA{
-			Pix:  make([]uint16, len(src.Pix)),
-			Rect: src.Rect,
-		}
-		tmpDest := &u16NRGBA{
-			Pix:  make([]uint16, len(dest.Pix)),
-			Rect: dest.Rect,
+// NRGBAGammaPerChannel is NRGBAGamma with its own gamma for each of R, G and
+// B. Alpha is scaled linearly as in NRGBAGamma.
+func NRGBAGammaPerChannel(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, gammas [3]float64, opts ...Option) error {
+	var t8 [3]*[256]uint16
+	var t16 [3]*[65536]uint8
+	for i, g := range gammas {
+		if err := checkGamma(g); err != nil {
+			return err
 		}
+		t8[i], t16[i] = getGammaTable(g)
+	}
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaGamma(ctx, dest, src, t8, tableEncoder(t16), newOptions(opts))
+	})
+}
 
-		{
-			s, d := src.Pix, tmpSrc.Pix
-			for i := 0; i < len(d); i += 4 {
-				d[i+3] = uint16(s[i+3]) * 0x101
-				d[i+0] = t8[s[i+0]]
-				d[i+1] = t8[s[i+1]]
-				d[i+2] = t8[s[i+2]]
-			}
-			if h.Aborted() {
-				return
-			}
-		}
+// NRGBAGammaApprox is NRGBAGamma that encodes the result with a polynomial
+// approximation of the gamma curve instead of the 64KiB reverse table, so a
+// gamma used once does not leave a table behind. The result stays within a
+// level of NRGBAGamma.
+func NRGBAGammaApprox(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, gamma float64, opts ...Option) error {
+	if err := checkGamma(gamma); err != nil {
+		return err
+	}
+	t8 := makeDecodeTable(gamma)
+	inv := float32(1 / gamma)
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaGamma(ctx, dest, src, [3]*[256]uint16{&t8, &t8, &t8}, func(d []byte, s []uint16) {
+			encodeGammaNRGBAApprox(d, s, inv)
+		}, newOptions(opts))
+	})
+}
 
-		if sh != dh {
-			if sw != dw {
-				tmp := &u16NRGBA{
-					Pix:  make([]uint16, (dw<<2)*sh),
-					Rect: image.Rect(0, 0, dw, sh),
-				}
-				horz16NRGBA(ctx, tmp, tmpSrc)
-				if h.Aborted() {
-					return
-				}
-				vert16NRGBA(ctx, tmpDest, tmp)
-			} else {
-				vert16NRGBA(ctx, tmpDest, tmpSrc)
-			}
-		} else {
-			horz16NRGBA(ctx, tmpDest, tmpSrc)
-		}
-		if h.Aborted() {
-			return
-		}
+func RGBAGamma(ctx context.Context, dest *image.RGBA, src *image.RGBA, gamma float64, opts ...Option) error {
+	if err := checkGamma(gamma); err != nil {
+		return err
+	}
+	t8, t16 := getGammaTable(gamma)
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaGamma(ctx, dest, src, t8, t16, newOptions(opts))
+	})
+}
 
-		{
-			s, d := tmpDest.Pix, dest.Pix
-			for i := 0; i < len(d); i += 4 {
-				d[i+3] = uint8(s[i+3] >> 8)
-				d[i+0] = t16[s[i+0]]
-				d[i+1] = t16[s[i+1]]
-				d[i+2] = t16[s[i+2]]
-			}
-		}
-	}()
-	return h.Wait(ctx)
+func rgbaGamma(ctx context.Context, dest *image.RGBA, src *image.RGBA, t8 *[256]uint16, t16 *[65536]uint8, o *options) error {
+	s := newScaler(src.Rect.Dx(), src.Rect.Dy(), dest.Rect.Dx(), dest.Rect.Dy())
+	s.o, s.t8, s.t16 = *o, t8, t16
+	return s.RGBAGamma(ctx, dest, src)
 }
 
-func RGBAGamma(ctx context.Context, dest *image.RGBA, src *image.RGBA, gamma float64) error {
+func nrgbaGamma(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, t8 [3]*[256]uint16, encode func(d []byte, s []uint16), o *options) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
 	sw, sh := src.Rect.Dx(), src.Rect.Dy()
 	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
 	if sw < dw || sh < dh {
-		return errors.New("upscale is not supported")
+		return ErrUpscaleUnsupported
 	}
-	if sw == dw && sh == dh {
-		copy(dest.Pix, src.Pix)
-		return nil
+	if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+		return ErrTooLarge
 	}
+	s := newScaler(sw, sh, dw, dh)
+	s.o = *o
+	return s.nrgbaGamma(ctx, dest, src, t8, encode)
+}
 
-	var h handle
-	h.wg.Add(1)
-	go func() {
-		defer h.Done()
-
-		t8, t16 := makeGammaTable(gamma)
-		tmpSrc := &u16NRGBA{
-			Pix:  make([]uint16, len(src.Pix)),
-			Rect: src.Rect,
-		}
-		tmpDest := &u16NRGBA{
-			Pix:  make([]uint16, len(dest.Pix)),
-			Rect: dest.Rect,
+// tableEncoder returns the encoder of nrgbaGamma that looks up R, G and B in
+// their own table of t16.
+func tableEncoder(t16 [3]*[65536]uint8) func(d []byte, s []uint16) {
+	r16, g16, b16 := t16[0], t16[1], t16[2]
+	return func(d []byte, s []uint16) {
+		for i := 0; i < len(d); i += 4 {
+			d[i+3] = uint8(s[i+3] >> 8)
+			d[i+0] = r16[s[i+0]]
+			d[i+1] = g16[s[i+1]]
+			d[i+2] = b16[s[i+2]]
 		}
+	}
+}
 
-		{
-			s, d := src.Pix, tmpSrc.Pix
-			var a uint32
-			for i := 0; i < len(d); i += 4 {
-				if a = uint32(s[i+3]); a == 255 {
-					d[i+3] = 65535
-					d[i+0] = t8[s[i+0]]
-					d[i+1] = t8[s[i+1]]
-					d[i+2] = t8[s[i+2]]
-				} else if a > 0 {
-					d[i+3] = uint16(a * 0x101)
-					d[i+0] = t8[divTable[(uint32(s[i+0])<<8)+a]]
-					d[i+1] = t8[divTable[(uint32(s[i+1])<<8)+a]]
-					d[i+2] = t8[divTable[(uint32(s[i+2])<<8)+a]]
-				}
-			}
-			if h.Aborted() {
-				return
-			}
-		}
+func encodeGammaNRGBAApprox(d []byte, s []uint16, inv float32) {
+	for i := 0; i < len(d); i += 4 {
+		d[i+3] = uint8(s[i+3] >> 8)
+		d[i+0] = uint8(powApprox(float32(s[i+0])/65535, inv) * 255)
+		d[i+1] = uint8(powApprox(float32(s[i+1])/65535, inv) * 255)
+		d[i+2] = uint8(powApprox(float32(s[i+2])/65535, inv) * 255)
+	}
+}
 
-		if sh != dh {
-			if sw != dw {
-				tmp := &u16NRGBA{
-					Pix:  make([]uint16, (dw<<2)*sh),
-					Rect: image.Rect(0, 0, dw, sh),
-				}
-				horz16NRGBA(ctx, tmp, tmpSrc)
-				if h.Aborted() {
-					return
-				}
-				vert16NRGBA(ctx, tmpDest, tmp)
-			} else {
-				vert16NRGBA(ctx, tmpDest, tmpSrc)
-			}
+// powApprox returns about x**y for x in [0, 1] as exp2(y*log2(x)), with both
+// taken from polynomials good to 1.5e-5.
+func powApprox(x float32, y float32) float32 {
+	if x <= 0 {
+		return 0
+	}
+	// log2 of the mantissa m in [1, 2) plus the exponent.
+	b := math.Float32bits(x)
+	e := float32(int32(b>>23) - 127)
+	t := math.Float32frombits(b&0x7fffff|0x3f800000) - 1
+	l := e + (((((0.043928627*t-0.18983244)*t+0.41156148)*t-0.70725343)*t+1.4415921)*t + 0.000014390933)
+
+	// exp2 of the fraction f in [0, 1) scaled by the integer part.
+	p := y * l
+	if p < -126 {
+		return 0
+	}
+	n := float32(math.Floor(float64(p)))
+	f := p - n
+	r := (((0.013683983*f+0.051717735)*f+0.24162132)*f+0.69296955)*f + 1.0000036
+	return math.Float32frombits(math.Float32bits(r) + uint32(int32(n))<<23)
+}
+
+func encodeGammaRGBA(d []byte, s []uint16, t16 *[65536]uint8) {
+	var a uint32
+	for i := 0; i < len(d); i += 4 {
+		if a = uint32(s[i+3]); a == 65535 {
+			d[i+3] = 255
+			d[i+0] = t16[s[i+0]]
+			d[i+1] = t16[s[i+1]]
+			d[i+2] = t16[s[i+2]]
+		} else if a == 0 {
+			d[i+3] = 0
+			d[i+0] = 0
+			d[i+1] = 0
+			d[i+2] = 0
 		} else {
-			horz16NRGBA(ctx, tmpDest, tmpSrc)
-		}
-		if h.Aborted() {
-			return
+			a >>= 8
+			d[i+3] = uint8(a)
+			a *= 32897
+			d[i+0] = uint8(uint32(t16[s[i+0]]) * a >> 23)
+			d[i+1] = uint8(uint32(t16[s[i+1]]) * a >> 23)
+			d[i+2] = uint8(uint32(t16[s[i+2]]) * a >> 23)
 		}
+	}
+}
 
-		{
-			s, d := tmpDest.Pix, dest.Pix
-			var a uint32
-			for i := 0; i < len(d); i += 4 {
-				if a = uint32(s[i+3]); a == 65535 {
-					d[i+3] = 255
-					d[i+0] = t16[s[i+0]]
-					d[i+1] = t16[s[i+1]]
-					d[i+2] = t16[s[i+2]]
-				} else if a == 0 {
-					d[i+3] = 0
-					d[i+0] = 0
-					d[i+1] = 0
-					d[i+2] = 0
-				} else {
-					a >>= 8
-					d[i+3] = uint8(a)
-					a *= 32897
-					d[i+0] = uint8(uint32(t16[s[i+0]]) * a >> 23)
-					d[i+1] = uint8(uint32(t16[s[i+1]]) * a >> 23)
-					d[i+2] = uint8(uint32(t16[s[i+2]]) * a >> 23)
-				}
+// downscale16NRGBA runs the passes required to scale src into dest and
+// reports whether h is still alive afterwards. tmp must hold dest.Dx() x
+// src.Dy() pixels when both axes are scaled.
+func downscale16NRGBA(ctx context.Context, h *handle, dest *u16NRGBA, src *u16NRGBA, tmp *u16NRGBA, horz *WeightTable, vert *WeightTable, o *options) bool {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sh != dh {
+		if sw != dw {
+			h.pass(horz16NRGBA(ctx, tmp, src, horz, o))
+			if h.Aborted() {
+				return false
 			}
+			h.pass(vert16NRGBA(ctx, dest, tmp, vert, o))
+		} else {
+			h.pass(vert16NRGBA(ctx, dest, src, vert, o))
 		}
-	}()
-	return h.Wait(ctx)
+	} else {
+		h.pass(horz16NRGBA(ctx, dest, src, horz, o))
+	}
+	return !h.Aborted()
 }
 
-func horz16NRGBA(ctx context.Context, dest *u16NRGBA, src *u16NRGBA) error {
-	n := runtime.GOMAXPROCS(0)
+func horz16NRGBA(ctx context.Context, dest *u16NRGBA, src *u16NRGBA, t *WeightTable, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
 	for n > 1 && n<<1 > dest.Rect.Dy() {
 		n--
 	}
 
 	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
-	lcmlen := lcm(sw, dw)
-	slcmlen, dlcmlen := lcmlen/sw, lcmlen/dw
-	tt, ft := makeTable(dw, dlcmlen, slcmlen)
+	slcmlen, dlcmlen, tt, ft := t.slcmlen, t.dlcmlen, t.tt, t.ft
 	dh := uint32(dest.Rect.Dy())
 
-	h := &handle{}
+	h := &handle{every: o.abortEvery()}
 	h.wg.Add(n)
 	step := dh / uint32(n)
 	y := uint32(0)
 	for i := 1; i < n; i++ {
-		go horz16NRGBAInner(h, src.Pix, dest.Pix, y, y+step, uint64(slcmlen), uint64(dlcmlen), sw, dw, tt, ft)
+		yMin := y
+		spawn(func() {
+			horz16NRGBAInner(h, src.Pix, dest.Pix, yMin, yMin+step, uint64(slcmlen), uint64(dlcmlen), sw, dw, tt, ft)
+		})
 		y += step
 	}
-	go horz16NRGBAInner(h, src.Pix, dest.Pix, y, dh, uint64(slcmlen), uint64(dlcmlen), sw, dw, tt, ft)
+	spawn(func() {
+		horz16NRGBAInner(h, src.Pix, dest.Pix, y, dh, uint64(slcmlen), uint64(dlcmlen), sw, dw, tt, ft)
+	})
 	return h.Wait(ctx)
 }
 
-func vert16NRGBA(ctx context.Context, dest *u16NRGBA, src *u16NRGBA) error {
-	n := runtime.GOMAXPROCS(0)
+func vert16NRGBA(ctx context.Context, dest *u16NRGBA, src *u16NRGBA, t *WeightTable, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
 	for n > 1 && n<<1 > dest.Rect.Dx() {
 		n--
 	}
 
 	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
-	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
-	lcmlen := lcm(sh, dh)
-	slcmlen, dlcmlen := lcmlen/sh, lcmlen/dh
-	tt, ft := makeTable(dh, dlcmlen, slcmlen)
+	dh := uint32(dest.Rect.Dy())
+	slcmlen, dlcmlen, tt, ft := t.slcmlen, t.dlcmlen, t.tt, t.ft
 
-	h := &handle{}
+	h := &handle{every: o.abortEvery()}
 	h.wg.Add(n)
 	step := (dw / uint32(n)) << 2
 	x := uint32(0)
 	for i := 1; i < n; i++ {
-		go vert16NRGBAInner(h, src.Pix, dest.Pix, x, x+step, uint64(slcmlen), uint64(dlcmlen), sw, dw, dh, tt, ft)
+		xMin := x
+		spawn(func() {
+			vert16NRGBAInner(h, src.Pix, dest.Pix, xMin, xMin+step, uint64(slcmlen), uint64(dlcmlen), sw, dw, dh, tt, ft)
+		})
 		x += step
 	}
-	go vert16NRGBAInner(h, src.Pix, dest.Pix, x, dw<<2, uint64(slcmlen), uint64(dlcmlen), sw, dw, dh, tt, ft)
+	spawn(func() {
+		vert16NRGBAInner(h, src.Pix, dest.Pix, x, dw<<2, uint64(slcmlen), uint64(dlcmlen), sw, dw, dh, tt, ft)
+	})
 	return h.Wait(ctx)
 }
 
+// The weights of one destination pixel add up to dlcmlen, so a color sum is
+// at most 65535*65535*dlcmlen, and dlcmlen is below 1<<32 as lcmFits keeps
+// the whole lcm there. The uint64 sums of horz16NRGBAInner and
+// vert16NRGBAInner therefore cannot overflow, however large the ratio.
 func horz16NRGBAInner(h *handle, s []uint16, d []uint16, yMin uint32, yMax uint32, slcmlen uint64, dlcmlen uint64, sw uint32, dw uint32, tt []uint32, ft []uint32) {
 	defer h.Done()
 	swx4, dwx4 := sw<<2, dw<<2
 	for y := yMin; y < yMax; y++ {
-		if y&7 == 7 && h.Aborted() {
+		if h.abortedAt(y) {
 			return
 		}
 		di := y * dwx4
@@ -266,11 +280,17 @@ func horz16NRGBAInner(h *handle, s []uint16, d []uint16, yMin uint32, yMax uint3
 				b += uint64(s[si+2]) * w
 				a += w
 			}
-			if a > 0 {
-				d[di+0] = uint16(r / a)
-				d[di+1] = uint16(g / a)
-				d[di+2] = uint16(b / a)
-				d[di+3] = uint16(a / dlcmlen)
+			if a == 0 {
+				d[di+0] = 0
+				d[di+1] = 0
+				d[di+2] = 0
+				d[di+3] = 0
+			} else {
+				half := a >> 1
+				d[di+0] = uint16((r + half) / a)
+				d[di+1] = uint16((g + half) / a)
+				d[di+2] = uint16((b + half) / a)
+				d[di+3] = uint16((a + dlcmlen>>1) / dlcmlen)
 			}
 			di += 4
 		}
@@ -281,7 +301,7 @@ func vert16NRGBAInner(h *handle, s []uint16, d []uint16, xMin uint32, xMax uint3
 	defer h.Done()
 	swx4, dwx4 := sw<<2, dw<<2
 	for x := xMin; x < xMax; x += 4 {
-		if (x>>2)&7 == 7 && h.Aborted() {
+		if h.abortedAt(x >> 2) {
 			return
 		}
 		di, si := x, x
@@ -313,11 +333,17 @@ func vert16NRGBAInner(h *handle, s []uint16, d []uint16, xMin uint32, xMax uint3
 				b += uint64(s[si+2]) * w
 				a += w
 			}
-			if a > 0 {
-				d[di+0] = uint16(r / a)
-				d[di+1] = uint16(g / a)
-				d[di+2] = uint16(b / a)
-				d[di+3] = uint16(a / dlcmlen)
+			if a == 0 {
+				d[di+0] = 0
+				d[di+1] = 0
+				d[di+2] = 0
+				d[di+3] = 0
+			} else {
+				half := a >> 1
+				d[di+0] = uint16((r + half) / a)
+				d[di+1] = uint16((g + half) / a)
+				d[di+2] = uint16((b + half) / a)
+				d[di+3] = uint16((a + dlcmlen>>1) / dlcmlen)
 			}
 			di += dwx4
 		}
@@ -0,0 +1,169 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"math"
+	"sync"
+)
+
+type gammaTable16 struct {
+	decode [65536]uint16
+	encode [65536]uint16
+}
+
+// gammaTables16 memoizes makeGammaTable16 by gamma value, as gammaTables
+// does for the 8-bit tables.
+var gammaTables16 sync.Map
+
+func getGammaTable16(g float64) (*[65536]uint16, *[65536]uint16) {
+	if v, ok := gammaTables16.Load(g); ok {
+		t := v.(*gammaTable16)
+		return &t.decode, &t.encode
+	}
+	t := makeGammaTable16(g)
+	if v, loaded := gammaTables16.LoadOrStore(g, t); loaded {
+		t = v.(*gammaTable16)
+	}
+	return &t.decode, &t.encode
+}
+
+func makeGammaTable16(g float64) *gammaTable16 {
+	t := &gammaTable16{}
+	for i := range t.decode {
+		t.decode[i] = uint16(math.Pow(float64(i)/65535, g)*65535 + 0.5)
+	}
+	g = 1.0 / g
+	for i := range t.encode {
+		t.encode[i] = uint16(math.Pow(float64(i)/65535, g)*65535 + 0.5)
+	}
+	return t
+}
+
+// RGBA64Gamma is RGBAGamma for 16-bit images. Each channel goes through a
+// 65536-entry table, so no precision is lost to an 8-bit intermediate.
+func RGBA64Gamma(ctx context.Context, dest *image.RGBA64, src *image.RGBA64, gamma float64, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgba64Gamma(ctx, dest, src, gamma, opts)
+	})
+}
+
+func rgba64Gamma(ctx context.Context, dest *image.RGBA64, src *image.RGBA64, gamma float64, opts []Option) error {
+	if err := checkGamma(gamma); err != nil {
+		return err
+	}
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 8); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 8); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<3], src.Pix[y*src.Stride:y*src.Stride+sw<<3])
+		}
+		return nil
+	}
+
+	o := newOptions(opts)
+	dec, enc := getGammaTable16(gamma)
+	h := handle{every: o.abortEvery()}
+	h.wg.Add(1)
+	go func() {
+		defer h.Done()
+
+		tmpSrc := &u16NRGBA{
+			Pix:  make([]uint16, (sw<<2)*sh),
+			Rect: src.Rect,
+		}
+		tmpDest := &u16NRGBA{
+			Pix:  make([]uint16, (dw<<2)*dh),
+			Rect: dest.Rect,
+		}
+
+		swx4 := sw << 2
+		for y := 0; y < sh; y++ {
+			if h.abortedAt(uint32(y)) {
+				return
+			}
+			s, d := src.Pix[y*src.Stride:y*src.Stride+sw<<3], tmpSrc.Pix[y*swx4:(y+1)*swx4]
+			decodeGammaRGBA64(d, s, dec)
+		}
+
+		sw, dw := uint32(sw), uint32(dw)
+		sh, dh := uint32(sh), uint32(dh)
+		var tmp *u16NRGBA
+		if sw != dw && sh != dh {
+			tmp = &u16NRGBA{
+				Pix:  make([]uint16, (dw<<2)*sh),
+				Rect: image.Rect(0, 0, int(dw), int(sh)),
+			}
+		}
+		if !downscale16NRGBA(ctx, &h, tmpDest, tmpSrc, tmp, NewWeightTable(sw, dw), NewWeightTable(sh, dh), o) {
+			return
+		}
+
+		dwx4 := int(dw) << 2
+		for y := 0; y < int(dh); y++ {
+			if h.abortedAt(uint32(y)) {
+				return
+			}
+			s, d := tmpDest.Pix[y*dwx4:(y+1)*dwx4], dest.Pix[y*dest.Stride:y*dest.Stride+int(dw)<<3]
+			encodeGammaRGBA64(d, s, enc)
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// decodeGammaRGBA64 converts a row of big-endian premultiplied samples into
+// straight-alpha linear ones.
+func decodeGammaRGBA64(d []uint16, s []byte, dec *[65536]uint16) {
+	for i, j := 0, 0; i < len(d); i, j = i+4, j+8 {
+		a := uint32(s[j+6])<<8 | uint32(s[j+7])
+		d[i+3] = uint16(a)
+		switch a {
+		case 0:
+			d[i+0], d[i+1], d[i+2] = 0, 0, 0
+		case 65535:
+			d[i+0] = dec[uint32(s[j+0])<<8|uint32(s[j+1])]
+			d[i+1] = dec[uint32(s[j+2])<<8|uint32(s[j+3])]
+			d[i+2] = dec[uint32(s[j+4])<<8|uint32(s[j+5])]
+		default:
+			d[i+0] = dec[unpremul16(uint32(s[j+0])<<8|uint32(s[j+1]), a)]
+			d[i+1] = dec[unpremul16(uint32(s[j+2])<<8|uint32(s[j+3]), a)]
+			d[i+2] = dec[unpremul16(uint32(s[j+4])<<8|uint32(s[j+5]), a)]
+		}
+	}
+}
+
+func unpremul16(c uint32, a uint32) uint32 {
+	if c >= a {
+		return 65535
+	}
+	return (c*65535 + a>>1) / a
+}
+
+// encodeGammaRGBA64 is the inverse of decodeGammaRGBA64.
+func encodeGammaRGBA64(d []byte, s []uint16, enc *[65536]uint16) {
+	for i, j := 0, 0; i < len(s); i, j = i+4, j+8 {
+		a := uint32(s[i+3])
+		r := (uint32(enc[s[i+0]])*a + 32767) / 65535
+		g := (uint32(enc[s[i+1]])*a + 32767) / 65535
+		b := (uint32(enc[s[i+2]])*a + 32767) / 65535
+		d[j+0], d[j+1] = uint8(r>>8), uint8(r)
+		d[j+2], d[j+3] = uint8(g>>8), uint8(g)
+		d[j+4], d[j+5] = uint8(b>>8), uint8(b)
+		d[j+6], d[j+7] = uint8(a>>8), uint8(a)
+	}
+}
@@ -0,0 +1,54 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestRGBA64Gamma(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA64(image.Rect(0, 0, 2, 1))
+	src.SetRGBA64(0, 0, color.RGBA64{0, 0, 0, 65535})
+	src.SetRGBA64(1, 0, color.RGBA64{65535, 65535, 65535, 65535})
+	dest := image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	if err := RGBA64Gamma(ctx, dest, src, 2.2); err != nil {
+		t.Fatal(err)
+	}
+	want := uint16(math.Pow(0.5, 1/2.2)*65535 + 0.5)
+	if got := dest.RGBA64At(0, 0); got.R != want || got.G != want || got.B != want || got.A != 65535 {
+		t.Errorf("want %d, got %v", want, got)
+	}
+	naive := image.NewRGBA64(dest.Rect)
+	if err := RGBA64(ctx, naive, src); err != nil {
+		t.Fatal(err)
+	}
+	if naive.Pix[0] == dest.Pix[0] {
+		t.Errorf("want gamma-correct averaging to differ from %v", naive.RGBA64At(0, 0))
+	}
+
+	// a flat translucent color stays as it is.
+	c := color.RGBA64{R: 0x1234, G: 0x5678, B: 0x0abc, A: 0x8000}
+	flat := image.NewRGBA64(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			flat.SetRGBA64(x, y, c)
+		}
+	}
+	out := image.NewRGBA64(image.Rect(0, 0, 7, 9))
+	if err := RGBA64Gamma(ctx, out, flat, 2.2); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 7; x++ {
+			got := out.RGBA64At(x, y)
+			for i, v := range [...][2]uint16{{c.R, got.R}, {c.G, got.G}, {c.B, got.B}, {c.A, got.A}} {
+				if d := int(v[0]) - int(v[1]); d > 2 || d < -2 {
+					t.Fatalf("(%d, %d)[%d]: want %d, got %d", x, y, i, v[0], v[1])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package downscale
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestNRGBAGammaPerChannel(t *testing.T) {
+	ctx := context.Background()
+	src := testPattern(64, 48)
+	gammas := [3]float64{1.0, 1.8, 2.4}
+	got := image.NewNRGBA(image.Rect(0, 0, 23, 17))
+	if err := NRGBAGammaPerChannel(ctx, got, src, gammas); err != nil {
+		t.Fatal(err)
+	}
+	for c, g := range gammas {
+		want := image.NewNRGBA(got.Rect)
+		if err := NRGBAGamma(ctx, want, src, g); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(want.Pix); i += 4 {
+			if want.Pix[i+c] != got.Pix[i+c] {
+				t.Fatalf("gamma %v: Pix[%d]: want %d, got %d", g, i+c, want.Pix[i+c], got.Pix[i+c])
+			}
+			if want.Pix[i+3] != got.Pix[i+3] {
+				t.Fatalf("alpha at %d: want %d, got %d", i>>2, want.Pix[i+3], got.Pix[i+3])
+			}
+		}
+	}
+}
+
+func TestErrInvalidGamma(t *testing.T) {
+	ctx := context.Background()
+	src, dest := image.NewRGBA(image.Rect(0, 0, 8, 8)), image.NewRGBA(image.Rect(0, 0, 4, 4))
+	nsrc, ndest := image.NewNRGBA(src.Rect), image.NewNRGBA(dest.Rect)
+	for _, g := range []float64{0, -1, math.NaN(), math.Inf(1), 10.5} {
+		_, serr := NewScaler(8, 8, 4, 4, WithGamma(g))
+		errs := map[string]error{
+			"RGBAGamma":            RGBAGamma(ctx, dest, src, g),
+			"NRGBAGamma":           NRGBAGamma(ctx, ndest, nsrc, g),
+			"NRGBAGammaPerChannel": NRGBAGammaPerChannel(ctx, ndest, nsrc, [3]float64{2.2, g, 2.2}),
+			"RGBALinear":           RGBALinear(ctx, dest, src, g),
+			"RGBA64Gamma":          RGBA64Gamma(ctx, image.NewRGBA64(dest.Rect), image.NewRGBA64(src.Rect), g),
+			"NewScaler":            serr,
+		}
+		for name, err := range errs {
+			if !errors.Is(err, ErrInvalidGamma) {
+				t.Errorf("%s(%v): want ErrInvalidGamma, got %v", name, g, err)
+			}
+		}
+	}
+	if err := RGBAGamma(ctx, dest, src, 10); err != nil {
+		t.Errorf("gamma 10: want nil, got %v", err)
+	}
+}
+
+func TestNRGBAGammaApprox(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewNRGBA(image.Rect(0, 0, 90, 60))
+	draw.Draw(src, src.Rect, testPattern(90, 60), image.Point{}, draw.Src)
+	for _, g := range []float64{0.5, 1.8, 2.2, 3} {
+		want := image.NewNRGBA(image.Rect(0, 0, 37, 23))
+		if err := NRGBAGamma(ctx, want, src, g); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewNRGBA(want.Rect)
+		if err := NRGBAGammaApprox(ctx, got, src, g); err != nil {
+			t.Fatal(err)
+		}
+		for i := range want.Pix {
+			if d := int(want.Pix[i]) - int(got.Pix[i]); d < -1 || d > 1 {
+				t.Fatalf("gamma %v, #%d: want %d, got %d", g, i, want.Pix[i], got.Pix[i])
+			}
+		}
+	}
+	if err := NRGBAGammaApprox(ctx, image.NewNRGBA(image.Rect(0, 0, 1, 1)), src, 0); err != ErrInvalidGamma {
+		t.Errorf("want ErrInvalidGamma, got %v", err)
+	}
+}
+
+func TestPowApprox(t *testing.T) {
+	for _, y := range []float64{1 / 2.2, 1 / 0.5, 1 / 10.0, 10} {
+		for i := 0; i <= 65535; i += 7 {
+			x := float64(i) / 65535
+			want, got := math.Pow(x, y), float64(powApprox(float32(x), float32(y)))
+			if math.Abs(want-got) > 1e-4 {
+				t.Fatalf("%v**%v: want %v, got %v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestGammaOverflow(t *testing.T) {
+	ctx := context.Background()
+	// 65537 and 65535 are coprime and their lcm is exactly 1<<32-1, the
+	// largest that lcmFits allows. Opaque white drives every sum of the
+	// 16-bit passes to its maximum.
+	const sl, dl = 65537, 65535
+	for _, sz := range [][2]image.Point{
+		{{sl, 1}, {dl, 1}},
+		{{1, sl}, {1, dl}},
+	} {
+		src := image.NewNRGBA(image.Rectangle{Max: sz[0]})
+		for i := range src.Pix {
+			src.Pix[i] = 0xff
+		}
+		dest := image.NewNRGBA(image.Rectangle{Max: sz[1]})
+		if err := NRGBAGamma(ctx, dest, src, 2.2); err != nil {
+			t.Fatal(err)
+		}
+		rdest := image.NewRGBA(dest.Rect)
+		if err := RGBAGamma(ctx, rdest, (*image.RGBA)(src), 2.2); err != nil {
+			t.Fatal(err)
+		}
+		for i := range dest.Pix {
+			if dest.Pix[i] != 0xff || rdest.Pix[i] != 0xff {
+				t.Fatalf("%v: Pix[%d] = %#x and %#x, want 0xff", sz[0], i, dest.Pix[i], rdest.Pix[i])
+			}
+		}
+	}
+
+	// one more destination pixel takes the lcm past 32 bits.
+	src := image.NewNRGBA(image.Rect(0, 0, 65537, 1))
+	if err := NRGBAGamma(ctx, image.NewNRGBA(image.Rect(0, 0, 65536, 1)), src, 2.2); err != ErrTooLarge {
+		t.Errorf("want ErrTooLarge, got %v", err)
+	}
+}
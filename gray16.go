@@ -0,0 +1,196 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+func Gray16(ctx context.Context, dest *image.Gray16, src *image.Gray16, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return gray16(ctx, dest, src, opts)
+	})
+}
+
+func gray16(ctx context.Context, dest *image.Gray16, src *image.Gray16, opts []Option) error {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<1], src.Pix[y*src.Stride:y*src.Stride+sw<<1])
+		}
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := image.NewGray16(image.Rect(0, 0, dw, sh))
+				h.pass(horz16Gray(ctx, tmp, src, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vert16Gray(ctx, dest, tmp, o))
+			} else {
+				h.pass(vert16Gray(ctx, dest, src, o))
+			}
+		} else {
+			h.pass(horz16Gray(ctx, dest, src, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+func horz16Gray(ctx context.Context, dest *image.Gray16, src *image.Gray16, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sw, dw)
+	if err != nil {
+		return err
+	}
+	dh := uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := dh / uint32(n)
+	y := uint32(0)
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horz16GrayInner(h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft)
+		})
+		y += step
+	}
+	spawn(func() {
+		horz16GrayInner(h, y, dh, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func vert16Gray(ctx context.Context, dest *image.Gray16, src *image.Gray16, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dx() {
+		n--
+	}
+
+	dw := uint32(dest.Rect.Dx())
+	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sh, dh)
+	if err != nil {
+		return err
+	}
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := dw / uint32(n)
+	x := uint32(0)
+	for i := 1; i < n; i++ {
+		xMin := x
+		spawn(func() {
+			vert16GrayInner(h, xMin, xMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft)
+		})
+		x += step
+	}
+	spawn(func() {
+		vert16GrayInner(h, x, dw, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func horz16GrayInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dw uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	sl, dl := uint64(slcmlen), uint64(dlcmlen)
+	rnd := h.round().or(RoundNearest)
+	bias := rnd.bias(dl)
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		di := y * ds
+		si := y * ss
+		carry := bias
+		for x, fr := uint32(0), uint64(0); x < dw; x++ {
+			tl, tr := tt[x], tt[x+1]
+			fl := sl - fr
+			fr = uint64(ft[x])
+			var v uint64
+			if fl != 0 {
+				v += (uint64(s[si])<<8 | uint64(s[si+1])) * fl
+				si += 2
+			}
+			for i := tl + 1; i < tr; i++ {
+				v += (uint64(s[si])<<8 | uint64(s[si+1])) * sl
+				si += 2
+			}
+			if fr != 0 {
+				v += (uint64(s[si])<<8 | uint64(s[si+1])) * fr
+			}
+			v += carry
+			q := v / dl
+			if rnd == RoundDiffuse {
+				carry = v - q*dl
+			}
+			v = q
+			d[di+0] = uint8(v >> 8)
+			d[di+1] = uint8(v)
+			di += 2
+		}
+	}
+}
+
+func vert16GrayInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dh uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	sl, dl := uint64(slcmlen), uint64(dlcmlen)
+	rnd := h.round().or(RoundNearest)
+	bias := rnd.bias(dl)
+	for x := xMin; x < xMax; x++ {
+		if h.abortedAt(x) {
+			return
+		}
+		di, si := x<<1, x<<1
+		carry := bias
+		for y, fr := uint32(0), uint64(0); y < dh; y++ {
+			tl, tr := tt[y], tt[y+1]
+			fl := sl - fr
+			fr = uint64(ft[y])
+			var v uint64
+			if fl != 0 {
+				v += (uint64(s[si])<<8 | uint64(s[si+1])) * fl
+				si += ss
+			}
+			for i := tl + 1; i < tr; i++ {
+				v += (uint64(s[si])<<8 | uint64(s[si+1])) * sl
+				si += ss
+			}
+			if fr != 0 {
+				v += (uint64(s[si])<<8 | uint64(s[si+1])) * fr
+			}
+			v += carry
+			q := v / dl
+			if rnd == RoundDiffuse {
+				carry = v - q*dl
+			}
+			v = q
+			d[di+0] = uint8(v >> 8)
+			d[di+1] = uint8(v)
+			di += ds
+		}
+	}
+}
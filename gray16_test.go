@@ -0,0 +1,45 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestGray16(t *testing.T) {
+	src := image.NewGray16(image.Rect(0, 0, 300, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 300; x++ {
+			v := uint16(x * 200)
+			i := src.PixOffset(x, y)
+			src.Pix[i+0] = uint8(v >> 8)
+			src.Pix[i+1] = uint8(v)
+		}
+	}
+	dest := image.NewGray16(image.Rect(0, 0, 7, 1))
+	if err := Gray16(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 7; x++ {
+		// each destination pixel covers 300/7 source pixels of the ramp.
+		l, r := float64(x)*300/7, float64(x+1)*300/7
+		var sum float64
+		for sx := 0; sx < 300; sx++ {
+			cl, cr := float64(sx), float64(sx+1)
+			if cl < l {
+				cl = l
+			}
+			if cr > r {
+				cr = r
+			}
+			if cr > cl {
+				sum += float64(sx*200) * (cr - cl)
+			}
+		}
+		want := sum / (r - l)
+		got := float64(dest.Gray16At(x, 0).Y)
+		if d := got - want; d > 1 || d < -1 {
+			t.Errorf("x=%d: want %f, got %f", x, want, got)
+		}
+	}
+}
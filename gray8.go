@@ -0,0 +1,221 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+func Gray(ctx context.Context, dest *image.Gray, src *image.Gray, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return gray8(ctx, dest, src, opts)
+	})
+}
+
+func gray8(ctx context.Context, dest *image.Gray, src *image.Gray, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 1); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 1); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8) || !sumFits(sh, dh, peak8) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw], src.Pix[y*src.Stride:y*src.Stride+sw])
+		}
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := image.NewGray(image.Rect(0, 0, dw, sh))
+				h.pass(horz8Gray(ctx, tmp, src, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vert8Gray(ctx, dest, tmp, o))
+			} else {
+				h.pass(vert8Gray(ctx, dest, src, o))
+			}
+		} else {
+			h.pass(horz8Gray(ctx, dest, src, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// GrayToNRGBA downscales src like Gray and writes the result into dest as
+// opaque gray, with R, G and B set to the averaged Y. Only the one channel is
+// averaged, so it is cheaper than converting src to NRGBA first.
+func GrayToNRGBA(ctx context.Context, dest *image.NRGBA, src *image.Gray, opts ...Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	tmp := image.NewGray(image.Rect(0, 0, dest.Rect.Dx(), dest.Rect.Dy()))
+	if err := Gray(ctx, tmp, src, opts...); err != nil {
+		return err
+	}
+	dw := tmp.Rect.Dx()
+	for y := 0; y < tmp.Rect.Dy(); y++ {
+		s, d := tmp.Pix[y*tmp.Stride:y*tmp.Stride+dw], dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2]
+		for i, v := range s {
+			d[i<<2+0] = v
+			d[i<<2+1] = v
+			d[i<<2+2] = v
+			d[i<<2+3] = 255
+		}
+	}
+	return nil
+}
+
+func horz8Gray(ctx context.Context, dest *image.Gray, src *image.Gray, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sw, dw)
+	if err != nil {
+		return err
+	}
+	dh := uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := dh / uint32(n)
+	y := uint32(0)
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horz8GrayInner(h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft)
+		})
+		y += step
+	}
+	spawn(func() {
+		horz8GrayInner(h, y, dh, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func vert8Gray(ctx context.Context, dest *image.Gray, src *image.Gray, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dx() {
+		n--
+	}
+
+	dw := uint32(dest.Rect.Dx())
+	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sh, dh)
+	if err != nil {
+		return err
+	}
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := dw / uint32(n)
+	x := uint32(0)
+	for i := 1; i < n; i++ {
+		xMin := x
+		spawn(func() {
+			vert8GrayInner(h, xMin, xMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft)
+		})
+		x += step
+	}
+	spawn(func() {
+		vert8GrayInner(h, x, dw, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func horz8GrayInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dw uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	rnd := h.round().or(RoundNearest)
+	bias := uint32(rnd.bias(uint64(dlcmlen)))
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		di := y * ds
+		si := y * ss
+		// with RoundDiffuse, carry is what the last pixel rounded off.
+		carry := bias
+		for x, fr := uint32(0), uint32(0); x < dw; x++ {
+			tl, tr := tt[x], tt[x+1]
+			fl := slcmlen - fr
+			fr = ft[x]
+			var v uint32
+			if fl != 0 {
+				v += uint32(s[si]) * fl
+				si++
+			}
+			for i := tl + 1; i < tr; i++ {
+				v += uint32(s[si]) * slcmlen
+				si++
+			}
+			if fr != 0 {
+				v += uint32(s[si]) * fr
+			}
+			v += carry
+			q := v / dlcmlen
+			if rnd == RoundDiffuse {
+				carry = v - q*dlcmlen
+			}
+			d[di] = uint8(q)
+			di++
+		}
+	}
+}
+
+func vert8GrayInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dh uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	rnd := h.round().or(RoundNearest)
+	bias := uint32(rnd.bias(uint64(dlcmlen)))
+	for x := xMin; x < xMax; x++ {
+		if h.abortedAt(x) {
+			return
+		}
+		di, si := x, x
+		carry := bias
+		for y, fr := uint32(0), uint32(0); y < dh; y++ {
+			tl, tr := tt[y], tt[y+1]
+			fl := slcmlen - fr
+			fr = ft[y]
+			var v uint32
+			if fl != 0 {
+				v += uint32(s[si]) * fl
+				si += ss
+			}
+			for i := tl + 1; i < tr; i++ {
+				v += uint32(s[si]) * slcmlen
+				si += ss
+			}
+			if fr != 0 {
+				v += uint32(s[si]) * fr
+			}
+			v += carry
+			q := v / dlcmlen
+			if rnd == RoundDiffuse {
+				carry = v - q*dlcmlen
+			}
+			d[di] = uint8(q)
+			di += ds
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestGray(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			src.Pix[y*src.Stride+x] = uint8(x*4 + y)
+		}
+	}
+	dest := image.NewGray(image.Rect(0, 0, 16, 12))
+	if err := Gray(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			var sum int
+			for sy := 0; sy < 4; sy++ {
+				for sx := 0; sx < 4; sx++ {
+					sum += int(src.Pix[(y*4+sy)*src.Stride+x*4+sx])
+				}
+			}
+			want := uint8((sum + 8) / 16)
+			if got := dest.Pix[y*dest.Stride+x]; got != want {
+				t.Errorf("(%d, %d): want %d, got %d", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestGrayUpscale(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 4, 4))
+	dest := image.NewGray(image.Rect(0, 0, 8, 4))
+	if err := Gray(context.Background(), dest, src); err == nil {
+		t.Fatal("want error, got nil")
+	}
+}
+
+func TestGrayToNRGBA(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewGray(image.Rect(0, 0, 100, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 100; x++ {
+			src.Pix[y*src.Stride+x] = uint8(x*255/99) ^ uint8(y)
+		}
+	}
+	want := image.NewGray(image.Rect(0, 0, 33, 7))
+	if err := Gray(ctx, want, src); err != nil {
+		t.Fatal(err)
+	}
+	// a sub-image checks that dest.Stride is followed.
+	dest := image.NewNRGBA(image.Rect(0, 0, 40, 10))
+	got := dest.SubImage(image.Rect(5, 2, 38, 9)).(*image.NRGBA)
+	if err := GrayToNRGBA(ctx, got, src); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 33; x++ {
+			v := want.GrayAt(x, y).Y
+			if c := got.NRGBAAt(x+5, y+2); c.R != v || c.G != v || c.B != v || c.A != 255 {
+				t.Errorf("(%d, %d): want %d, got %v", x, y, v, c)
+			}
+		}
+	}
+	if c := dest.NRGBAAt(4, 2); c.A != 0 {
+		t.Errorf("want pixels outside of the sub-image untouched, got %v", c)
+	}
+}
+
+func TestGrayShortPix(t *testing.T) {
+	ctx := context.Background()
+	short := &image.Gray{Pix: make([]byte, 10), Stride: 40, Rect: image.Rect(0, 0, 40, 30)}
+	for name, err := range map[string]error{
+		"src":  Gray(ctx, image.NewGray(image.Rect(0, 0, 10, 10)), short),
+		"dest": Gray(ctx, short, image.NewGray(image.Rect(0, 0, 80, 60))),
+	} {
+		if _, ok := err.(*PanicError); ok || err == nil {
+			t.Errorf("short %s: want a size error, got %v", name, err)
+		}
+	}
+}
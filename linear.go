@@ -0,0 +1,31 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+// RGBALinear decodes src with gamma, downscales it in linear light and
+// writes the premultiplied result to dest without encoding it back.
+func RGBALinear(ctx context.Context, dest *image.RGBA, src *image.RGBA, gamma float64, opts ...Option) error {
+	if err := checkGamma(gamma); err != nil {
+		return err
+	}
+	t8, _ := getGammaTable(gamma)
+	s := newScaler(src.Rect.Dx(), src.Rect.Dy(), dest.Rect.Dx(), dest.Rect.Dy())
+	s.o, s.t8 = *newOptions(opts), t8
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return s.rgbaLinear(ctx, dest, src, encodeLinearRGBA)
+	})
+}
+
+func encodeLinearRGBA(d []byte, s []uint16) {
+	const div = 65535 * 257
+	for i := 0; i < len(d); i += 4 {
+		a := uint64(s[i+3])
+		d[i+3] = uint8((a + 128) / 257)
+		d[i+0] = uint8((uint64(s[i+0])*a + div/2) / div)
+		d[i+1] = uint8((uint64(s[i+1])*a + div/2) / div)
+		d[i+2] = uint8((uint64(s[i+2])*a + div/2) / div)
+	}
+}
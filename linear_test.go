@@ -0,0 +1,48 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRGBALinear(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 6, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			a := uint8(255 - x*40)
+			src.SetRGBA(x, y, color.RGBA{a, a / 2, uint8(int(a) * y / 3), a})
+		}
+	}
+	ctx := context.Background()
+	got := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	if err := RGBALinear(ctx, got, src, 2.2); err != nil {
+		t.Fatal(err)
+	}
+
+	var linear []uint16
+	s, err := NewScaler(6, 3, 4, 2, WithGamma(2.2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.rgbaLinear(ctx, image.NewRGBA(got.Rect), src, func(d []byte, s []uint16) {
+		linear = append(linear, s...)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(linear); i += 4 {
+		a := float64(linear[i+3]) / 65535
+		want := []float64{
+			float64(linear[i+0]) / 257 * a,
+			float64(linear[i+1]) / 257 * a,
+			float64(linear[i+2]) / 257 * a,
+			a * 255,
+		}
+		for j, w := range want {
+			if d := float64(got.Pix[i+j]) - w; d > 0.5 || d < -0.5 {
+				t.Errorf("Pix[%d]: want %f, got %d", i+j, w, got.Pix[i+j])
+			}
+		}
+	}
+}
@@ -3,64 +3,94 @@ package downscale
 import (
 	"context"
 	"image"
-	"runtime"
 )
 
-func NRGBAFast(ctx context.Context, dest *image.NRGBA, src *image.NRGBA) error {
-	return nn(
-		ctx,
-		dest.Pix,
-		src.Pix,
-		dest.Rect.Dx(),
-		dest.Rect.Dy(),
-		src.Rect.Dx(),
-		src.Rect.Dy(),
-	)
+// NRGBAFast resizes src into dest with nearest-neighbor sampling.
+// Unlike NRGBA it can also enlarge the image.
+func NRGBAFast(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nn(
+			ctx,
+			dest.Pix,
+			src.Pix,
+			dest.Stride,
+			src.Stride,
+			dest.Rect.Dx(),
+			dest.Rect.Dy(),
+			src.Rect.Dx(),
+			src.Rect.Dy(),
+			newOptions(opts),
+		)
+	})
 }
 
-func RGBAFast(ctx context.Context, dest *image.RGBA, src *image.RGBA) error {
-	return nn(
-		ctx,
-		dest.Pix,
-		src.Pix,
-		dest.Rect.Dx(),
-		dest.Rect.Dy(),
-		src.Rect.Dx(),
-		src.Rect.Dy(),
-	)
+// RGBAFast resizes src into dest with nearest-neighbor sampling.
+// Unlike RGBA it can also enlarge the image.
+func RGBAFast(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nn(
+			ctx,
+			dest.Pix,
+			src.Pix,
+			dest.Stride,
+			src.Stride,
+			dest.Rect.Dx(),
+			dest.Rect.Dy(),
+			src.Rect.Dx(),
+			src.Rect.Dy(),
+			newOptions(opts),
+		)
+	})
 }
 
-func nn(ctx context.Context, dPix []byte, sPix []byte, dw int, dh int, sw int, sh int) error {
-	n := runtime.GOMAXPROCS(0)
+func nn(ctx context.Context, dPix []byte, sPix []byte, ds int, ss int, dw int, dh int, sw int, sh int, o *options) error {
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	n := o.workers(dw * dh)
 	for n > 1 && n<<1 > dh {
 		n--
 	}
 
-	h := &handle{}
+	h := &handle{every: o.abortEvery()}
 	h.wg.Add(n)
 	step := dh / n
 	y := 0
 	for i := 1; i < n; i++ {
-		go nnInner(h, y, y+step, dPix, sPix, dw, dh, sw, sh)
+		yMin := y
+		spawn(func() {
+			nnInner(h, yMin, yMin+step, dPix, sPix, ds, ss, dw, dh, sw, sh)
+		})
 		y += step
 	}
-	go nnInner(h, y, dh, dPix, sPix, dw, dh, sw, sh)
+	spawn(func() {
+		nnInner(h, y, dh, dPix, sPix, ds, ss, dw, dh, sw, sh)
+	})
 	return h.Wait(ctx)
 }
 
-func nnInner(h *handle, yMin int, yMax int, dPix []byte, sPix []byte, dw int, dh int, sw int, sh int) {
+func nnInner(h *handle, yMin int, yMax int, dPix []byte, sPix []byte, ds int, ss int, dw int, dh int, sw int, sh int) {
 	defer h.Done()
 	mx := float32(sw) / float32(dw)
 	my := float32(sh) / float32(dh)
-	dwx4, swx4 := dw<<2, sw<<2
+	dwx4 := dw << 2
 	for dy := yMin; dy < yMax; dy++ {
-		if dy&7 == 7 && h.Aborted() {
+		if h.abortedAt(uint32(dy)) {
 			return
 		}
-		s := sPix[int((float32(dy)+0.5)*my)*swx4:]
-		d := dPix[dy*dwx4:]
+		sy := int((float32(dy) + 0.5) * my)
+		if sy >= sh {
+			sy = sh - 1
+		}
+		s := sPix[sy*ss:]
+		d := dPix[dy*ds:]
 		for dx, sx := 0, 0; dx < dwx4; dx += 4 {
-			sx = int((float32(dx>>2)+0.5)*mx) << 2
+			// rounding errors in float32 must not push the last sample
+			// out of the source.
+			if sx = int((float32(dx>>2) + 0.5) * mx); sx >= sw {
+				sx = sw - 1
+			}
+			sx <<= 2
 			d[dx+3] = s[sx+3]
 			d[dx+2] = s[sx+2]
 			d[dx+1] = s[sx+1]
@@ -0,0 +1,44 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRGBAFastUpscale(t *testing.T) {
+	sizes := []struct {
+		sw, sh, dw, dh int
+	}{
+		{3, 2, 6, 4},
+		{3, 3, 7, 7},
+		{5, 3, 7, 8},
+		{1, 1, 9, 5},
+	}
+	for _, sz := range sizes {
+		src := image.NewRGBA(image.Rect(0, 0, sz.sw, sz.sh))
+		for y := 0; y < sz.sh; y++ {
+			for x := 0; x < sz.sw; x++ {
+				src.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+			}
+		}
+		dest := image.NewRGBA(image.Rect(0, 0, sz.dw, sz.dh))
+		if err := RGBAFast(context.Background(), dest, src); err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < sz.dh; y++ {
+			for x := 0; x < sz.dw; x++ {
+				want := color.RGBA{
+					uint8((2*x + 1) * sz.sw / (2 * sz.dw)),
+					uint8((2*y + 1) * sz.sh / (2 * sz.dh)),
+					0,
+					255,
+				}
+				if got := dest.RGBAAt(x, y); got != want {
+					t.Errorf("%dx%d -> %dx%d (%d, %d): want %v, got %v", sz.sw, sz.sh, sz.dw, sz.dh, x, y, want, got)
+				}
+			}
+		}
+	}
+}
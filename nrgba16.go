@@ -0,0 +1,220 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+func NRGBA64(ctx context.Context, dest *image.NRGBA64, src *image.NRGBA64, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgba64(ctx, dest, src, opts)
+	})
+}
+
+func nrgba64(ctx context.Context, dest *image.NRGBA64, src *image.NRGBA64, opts []Option) error {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<3], src.Pix[y*src.Stride:y*src.Stride+sw<<3])
+		}
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := image.NewNRGBA64(image.Rect(0, 0, dw, sh))
+				h.pass(horzNRGBA64(ctx, tmp, src, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vertNRGBA64(ctx, dest, tmp, o))
+			} else {
+				h.pass(vertNRGBA64(ctx, dest, src, o))
+			}
+		} else {
+			h.pass(horzNRGBA64(ctx, dest, src, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+func horzNRGBA64(ctx context.Context, dest *image.NRGBA64, src *image.NRGBA64, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sw, dw)
+	if err != nil {
+		return err
+	}
+	dh := uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := dh / uint32(n)
+	y := uint32(0)
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horzNRGBA64Inner(h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dw, tt, ft)
+		})
+		y += step
+	}
+	spawn(func() {
+		horzNRGBA64Inner(h, y, dh, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dw, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func vertNRGBA64(ctx context.Context, dest *image.NRGBA64, src *image.NRGBA64, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dx() {
+		n--
+	}
+
+	dw := uint32(dest.Rect.Dx())
+	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sh, dh)
+	if err != nil {
+		return err
+	}
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := (dw / uint32(n)) << 3
+	x := uint32(0)
+	for i := 1; i < n; i++ {
+		xMin := x
+		spawn(func() {
+			vertNRGBA64Inner(h, xMin, xMin+step, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dh, tt, ft)
+		})
+		x += step
+	}
+	spawn(func() {
+		vertNRGBA64Inner(h, x, dw<<3, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dh, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func horzNRGBA64Inner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint64, slcmlen uint64, dw uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		di := y * ds
+		si := y * ss
+		var f diffuser
+		for x, fr := uint32(0), uint64(0); x < dw; x++ {
+			tl, tr := tt[x], tt[x+1]
+			fl := slcmlen - fr
+			fr = uint64(ft[x])
+			var a, r, g, b, w uint64
+			if fl != 0 {
+				w = (uint64(s[si+6])<<8 | uint64(s[si+7])) * fl
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * w
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * w
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * w
+				a += w
+				si += 8
+			}
+			for i := tl + 1; i < tr; i++ {
+				w = (uint64(s[si+6])<<8 | uint64(s[si+7])) * slcmlen
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * w
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * w
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * w
+				a += w
+				si += 8
+			}
+			if fr != 0 {
+				w = (uint64(s[si+6])<<8 | uint64(s[si+7])) * fr
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * w
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * w
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * w
+				a += w
+			}
+			putNRGBA64(d[di:di+8], r, g, b, a, dlcmlen, h.round(), &f)
+			di += 8
+		}
+	}
+}
+
+func vertNRGBA64Inner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint64, slcmlen uint64, dh uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	for x := xMin; x < xMax; x += 8 {
+		if h.abortedAt(x >> 3) {
+			return
+		}
+		di, si := x, x
+		var f diffuser
+		for y, fr := uint32(0), uint64(0); y < dh; y++ {
+			tl, tr := tt[y], tt[y+1]
+			fl := slcmlen - fr
+			fr = uint64(ft[y])
+			var a, r, g, b, w uint64
+			if fl != 0 {
+				w = (uint64(s[si+6])<<8 | uint64(s[si+7])) * fl
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * w
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * w
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * w
+				a += w
+				si += ss
+			}
+			for i := tl + 1; i < tr; i++ {
+				w = (uint64(s[si+6])<<8 | uint64(s[si+7])) * slcmlen
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * w
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * w
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * w
+				a += w
+				si += ss
+			}
+			if fr != 0 {
+				w = (uint64(s[si+6])<<8 | uint64(s[si+7])) * fr
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * w
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * w
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * w
+				a += w
+			}
+			putNRGBA64(d[di:di+8], r, g, b, a, dlcmlen, h.round(), &f)
+			di += ds
+		}
+	}
+}
+
+func putNRGBA64(d []byte, r uint64, g uint64, b uint64, a uint64, dlcmlen uint64, rnd Rounding, f *diffuser) {
+	if a == 0 {
+		d[0], d[1], d[2], d[3], d[4], d[5], d[6], d[7] = 0, 0, 0, 0, 0, 0, 0, 0
+		return
+	}
+	if rnd == RoundDiffuse {
+		r, g, b = f.next(0, r, a), f.next(1, g, a), f.next(2, b, a)
+		a = f.next(3, a, dlcmlen)
+	} else {
+		rnd = rnd.or(RoundNearest)
+		bias := rnd.bias(a)
+		r, g, b = (r+bias)/a, (g+bias)/a, (b+bias)/a
+		a = (a + rnd.bias(dlcmlen)) / dlcmlen
+	}
+	d[0], d[1] = uint8(r>>8), uint8(r)
+	d[2], d[3] = uint8(g>>8), uint8(g)
+	d[4], d[5] = uint8(b>>8), uint8(b)
+	d[6], d[7] = uint8(a>>8), uint8(a)
+}
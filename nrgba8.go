@@ -2,100 +2,252 @@ package downscale
 
 import (
 	"context"
-	"errors"
 	"image"
-	"runtime"
 )
 
-func NRGBA(ctx context.Context, dest *image.NRGBA, src *image.NRGBA) error {
+func NRGBA(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgba8(ctx, dest, src, opts)
+	})
+}
+
+func nrgba8(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	// as in RGBA, an aliased src is copied before a single pass overwrites it.
+	if (sw == dw || sh == dh) && overlaps(dest.Pix, src.Pix) {
+		c := image.NewNRGBA(image.Rect(0, 0, sw, sh))
+		copyNRGBA(c, src)
+		src = c
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := image.NewNRGBA(image.Rect(0, 0, dw, sh))
+				h.pass(horz8NRGBA(ctx, tmp, src, false, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vert8NRGBA(ctx, dest, tmp, false, o))
+			} else {
+				h.pass(vert8NRGBA(ctx, dest, src, false, o))
+			}
+		} else {
+			h.pass(horz8NRGBA(ctx, dest, src, false, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// NRGBAToRGBA downscales like NRGBA, weighting by straight alpha, and writes
+// the result premultiplied into dest.
+func NRGBAToRGBA(ctx context.Context, dest *image.RGBA, src *image.NRGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaToRGBA(ctx, dest, src, opts)
+	})
+}
+
+func nrgbaToRGBA(ctx context.Context, dest *image.RGBA, src *image.NRGBA, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
 	sw, sh := src.Rect.Dx(), src.Rect.Dy()
 	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
 	if sw < dw || sh < dh {
-		return errors.New("upscale is not supported")
+		return ErrUpscaleUnsupported
 	}
-	if sw == dw && sh == dh {
-		copy(dest.Pix, src.Pix)
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			s, d := src.Pix[y*src.Stride:y*src.Stride+sw<<2], dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2]
+			for i := 0; i < len(d); i += 4 {
+				a := uint32(s[i+3])
+				d[i+0] = uint8((uint32(s[i+0])*a + 127) / 255)
+				d[i+1] = uint8((uint32(s[i+1])*a + 127) / 255)
+				d[i+2] = uint8((uint32(s[i+2])*a + 127) / 255)
+				d[i+3] = s[i+3]
+			}
+		}
 		return nil
 	}
+	// the passes write dest through an NRGBA view of the same pixels.
+	d := &image.NRGBA{Pix: dest.Pix, Stride: dest.Stride, Rect: dest.Rect}
 	var h handle
 	h.wg.Add(1)
+	o := newOptions(opts)
 	go func() {
 		defer h.Done()
 		if sh != dh {
 			if sw != dw {
 				tmp := image.NewNRGBA(image.Rect(0, 0, dw, sh))
-				horz8NRGBA(ctx, tmp, src)
+				h.pass(horz8NRGBA(ctx, tmp, src, false, o))
 				if h.Aborted() {
 					return
 				}
-				vert8NRGBA(ctx, dest, tmp)
+				h.pass(vert8NRGBA(ctx, d, tmp, true, o))
 			} else {
-				vert8NRGBA(ctx, dest, src)
+				h.pass(vert8NRGBA(ctx, d, src, true, o))
 			}
 		} else {
-			horz8NRGBA(ctx, dest, src)
+			h.pass(horz8NRGBA(ctx, d, src, true, o))
 		}
 	}()
 	return h.Wait(ctx)
 }
 
-func horz8NRGBA(ctx context.Context, dest *image.NRGBA, src *image.NRGBA) error {
-	n := runtime.GOMAXPROCS(0)
+// NRGBAHorizontal scales only the width of src into dest, which must have the
+// same height as src.
+func NRGBAHorizontal(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaHorizontal(ctx, dest, src, opts)
+	})
+}
+
+func nrgbaHorizontal(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts []Option) error {
+	if err := checkAxis(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect, dest.Rect.Dy() == src.Rect.Dy()); err != nil {
+		return err
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		copyNRGBA(dest, src)
+		return nil
+	}
+	return horz8NRGBA(ctx, dest, src, false, newOptions(opts))
+}
+
+// NRGBAVertical scales only the height of src into dest, which must have the
+// same width as src.
+func NRGBAVertical(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaVertical(ctx, dest, src, opts)
+	})
+}
+
+func nrgbaVertical(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts []Option) error {
+	if err := checkAxis(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect, dest.Rect.Dx() == src.Rect.Dx()); err != nil {
+		return err
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		copyNRGBA(dest, src)
+		return nil
+	}
+	return vert8NRGBA(ctx, dest, src, false, newOptions(opts))
+}
+
+func copyNRGBA(dest *image.NRGBA, src *image.NRGBA) {
+	w := src.Rect.Dx() << 2
+	for y := 0; y < src.Rect.Dy(); y++ {
+		copy(dest.Pix[y*dest.Stride:y*dest.Stride+w], src.Pix[y*src.Stride:y*src.Stride+w])
+	}
+}
+
+func horz8NRGBA(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, premul bool, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
 	for n > 1 && n<<1 > dest.Rect.Dy() {
 		n--
 	}
 
 	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
-	lcmlen := lcm(sw, dw)
-	slcmlen, dlcmlen := lcmlen/sw, lcmlen/dw
-	tt, ft := makeTable(dw, dlcmlen, slcmlen)
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sw, dw)
+	if err != nil {
+		return err
+	}
 	dh := uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
 
-	h := &handle{}
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
 	h.wg.Add(n)
 	step := dh / uint32(n)
 	y := uint32(0)
 	for i := 1; i < n; i++ {
-		go horz8NRGBAInner(h, y, y+step, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, sw, tt, ft)
+		yMin := y
+		spawn(func() {
+			horz8NRGBAInner(h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft, premul)
+		})
 		y += step
 	}
-	go horz8NRGBAInner(h, y, dh, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, sw, tt, ft)
+	spawn(func() {
+		horz8NRGBAInner(h, y, dh, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft, premul)
+	})
 	return h.Wait(ctx)
 }
 
-func vert8NRGBA(ctx context.Context, dest *image.NRGBA, src *image.NRGBA) error {
-	n := runtime.GOMAXPROCS(0)
+func vert8NRGBA(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, premul bool, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
 	for n > 1 && n<<1 > dest.Rect.Dx() {
 		n--
 	}
 
-	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
+	dw := uint32(dest.Rect.Dx())
 	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
-	lcmlen := lcm(sh, dh)
-	slcmlen, dlcmlen := lcmlen/sh, lcmlen/dh
-	tt, ft := makeTable(dh, dlcmlen, slcmlen)
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sh, dh)
+	if err != nil {
+		return err
+	}
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
 
-	h := &handle{}
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
 	h.wg.Add(n)
 	step := (dw / uint32(n)) << 2
 	x := uint32(0)
 	for i := 1; i < n; i++ {
-		go vert8NRGBAInner(h, x, x+step, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, dh, sw, tt, ft)
+		xMin := x
+		spawn(func() {
+			vert8NRGBAInner(h, xMin, xMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft, premul)
+		})
 		x += step
 	}
-	go vert8NRGBAInner(h, x, dw<<2, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, dh, sw, tt, ft)
+	spawn(func() {
+		vert8NRGBAInner(h, x, dw<<2, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft, premul)
+	})
 	return h.Wait(ctx)
 }
 
-func horz8NRGBAInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, dlcmlen uint32, slcmlen uint32, dw uint32, sw uint32, tt []uint32, ft []uint32) {
+func horz8NRGBAInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dw uint32, tt []uint32, ft []uint32, premul bool) {
 	defer h.Done()
-	swx4, dwx4 := sw<<2, dw<<2
+	rnd := h.round().or(RoundNearest)
+	ab := uint32(rnd.bias(uint64(dlcmlen)))
+	// colors are weighted by alpha, so the stored color of a transparent
+	// pixel never reaches its neighbors.
 	for y := yMin; y < yMax; y++ {
-		if y&7 == 7 && h.Aborted() {
+		if h.abortedAt(y) {
 			return
 		}
-		di := y * dwx4
-		si := y * swx4
+		di := y * ds
+		si := y * ss
+		var f diffuser
 		for x, fr := uint32(0), uint32(0); x < dw; x++ {
 			tl, tr := tt[x], tt[x+1]
 			fl := slcmlen - fr
@@ -129,25 +281,49 @@ func horz8NRGBAInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, dl
 				d[di+1] = 0
 				d[di+2] = 0
 				d[di+3] = 0
+			} else if rnd == RoundDiffuse {
+				al := f.next(3, uint64(a), uint64(dlcmlen))
+				if premul {
+					q := uint64(dlcmlen) * 255
+					d[di+0] = uint8(f.nextMax(0, uint64(r), q, al))
+					d[di+1] = uint8(f.nextMax(1, uint64(g), q, al))
+					d[di+2] = uint8(f.nextMax(2, uint64(b), q, al))
+				} else {
+					d[di+0] = uint8(f.next(0, uint64(r), uint64(a)))
+					d[di+1] = uint8(f.next(1, uint64(g), uint64(a)))
+					d[di+2] = uint8(f.next(2, uint64(b), uint64(a)))
+				}
+				d[di+3] = uint8(al)
+			} else if premul {
+				// r/a*(a/dlcmlen)/255 without dividing by a.
+				q := dlcmlen * 255
+				cb := uint32(rnd.bias(uint64(q)))
+				d[di+0] = uint8((r + cb) / q)
+				d[di+1] = uint8((g + cb) / q)
+				d[di+2] = uint8((b + cb) / q)
+				d[di+3] = uint8((a + ab) / dlcmlen)
 			} else {
-				d[di+0] = uint8(r / a)
-				d[di+1] = uint8(g / a)
-				d[di+2] = uint8(b / a)
-				d[di+3] = uint8(a / dlcmlen)
+				cb := uint32(rnd.bias(uint64(a)))
+				d[di+0] = uint8((r + cb) / a)
+				d[di+1] = uint8((g + cb) / a)
+				d[di+2] = uint8((b + cb) / a)
+				d[di+3] = uint8((a + ab) / dlcmlen)
 			}
 			di += 4
 		}
 	}
 }
 
-func vert8NRGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, dlcmlen uint32, slcmlen uint32, dw uint32, dh uint32, sw uint32, tt []uint32, ft []uint32) {
+func vert8NRGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dh uint32, tt []uint32, ft []uint32, premul bool) {
 	defer h.Done()
-	swx4, dwx4 := sw<<2, dw<<2
+	rnd := h.round().or(RoundNearest)
+	ab := uint32(rnd.bias(uint64(dlcmlen)))
 	for x := xMin; x < xMax; x += 4 {
-		if (x>>2)&7 == 7 && h.Aborted() {
+		if h.abortedAt(x >> 2) {
 			return
 		}
 		di, si := x, x
+		var f diffuser
 		for y, fr := uint32(0), uint32(0); y < dh; y++ {
 			tl, tr := tt[y], tt[y+1]
 			fl := slcmlen - fr
@@ -159,7 +335,7 @@ func vert8NRGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, dl
 				g += uint32(s[si+1]) * w
 				b += uint32(s[si+2]) * w
 				a += w
-				si += swx4
+				si += ss
 			}
 			for i := tl + 1; i < tr; i++ {
 				w = uint32(s[si+3]) * slcmlen
@@ -167,7 +343,7 @@ func vert8NRGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, dl
 				g += uint32(s[si+1]) * w
 				b += uint32(s[si+2]) * w
 				a += w
-				si += swx4
+				si += ss
 			}
 			if fr != 0 {
 				w = uint32(s[si+3]) * fr
@@ -181,13 +357,35 @@ func vert8NRGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, dl
 				d[di+1] = 0
 				d[di+2] = 0
 				d[di+3] = 0
+			} else if rnd == RoundDiffuse {
+				al := f.next(3, uint64(a), uint64(dlcmlen))
+				if premul {
+					q := uint64(dlcmlen) * 255
+					d[di+0] = uint8(f.nextMax(0, uint64(r), q, al))
+					d[di+1] = uint8(f.nextMax(1, uint64(g), q, al))
+					d[di+2] = uint8(f.nextMax(2, uint64(b), q, al))
+				} else {
+					d[di+0] = uint8(f.next(0, uint64(r), uint64(a)))
+					d[di+1] = uint8(f.next(1, uint64(g), uint64(a)))
+					d[di+2] = uint8(f.next(2, uint64(b), uint64(a)))
+				}
+				d[di+3] = uint8(al)
+			} else if premul {
+				// r/a*(a/dlcmlen)/255 without dividing by a.
+				q := dlcmlen * 255
+				cb := uint32(rnd.bias(uint64(q)))
+				d[di+0] = uint8((r + cb) / q)
+				d[di+1] = uint8((g + cb) / q)
+				d[di+2] = uint8((b + cb) / q)
+				d[di+3] = uint8((a + ab) / dlcmlen)
 			} else {
-				d[di+0] = uint8(r / a)
-				d[di+1] = uint8(g / a)
-				d[di+2] = uint8(b / a)
-				d[di+3] = uint8(a / dlcmlen)
+				cb := uint32(rnd.bias(uint64(a)))
+				d[di+0] = uint8((r + cb) / a)
+				d[di+1] = uint8((g + cb) / a)
+				d[di+2] = uint8((b + cb) / a)
+				d[di+3] = uint8((a + ab) / dlcmlen)
 			}
-			di += dwx4
+			di += ds
 		}
 	}
 }
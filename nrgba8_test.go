@@ -0,0 +1,204 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestNRGBASubImage(t *testing.T) {
+	ctx := context.Background()
+	full := testPattern(64, 48)
+	r := image.Rect(10, 7, 50, 37)
+	sub := full.SubImage(r).(*image.NRGBA)
+	cp := image.NewNRGBA(r)
+	draw.Draw(cp, r, full, r.Min, draw.Src)
+
+	for _, size := range []image.Point{{40, 30}, {13, 30}, {40, 11}, {13, 11}} {
+		want := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+		if err := NRGBA(ctx, want, cp); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+		if err := NRGBA(ctx, got, sub); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: want %v, got %v", size, want.Pix, got.Pix)
+		}
+	}
+}
+
+func TestNRGBADirection(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.NRGBA{R: 200, G: 10, B: 0, A: 255}
+			if x >= 2 {
+				c = color.NRGBA{R: 0, G: 10, B: 200, A: 128}
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+	dest := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	if err := NRGBA(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	want := []color.NRGBA{{R: 200, G: 10, B: 0, A: 255}, {R: 0, G: 10, B: 200, A: 128}}
+	for x, w := range want {
+		if got := dest.NRGBAAt(x, 0); got != w {
+			t.Errorf("(%d, 0): want %v, got %v", x, w, got)
+		}
+	}
+	if err := NRGBA(context.Background(), src, dest); err == nil {
+		t.Error("want error when dest is larger than src, got nil")
+	}
+}
+
+func TestNRGBARounding(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		a, b   color.NRGBA
+		sw, sh int
+		want   color.NRGBA
+	}{
+		{"flat horz", color.NRGBA{37, 128, 201, 200}, color.NRGBA{37, 128, 201, 200}, 6, 1, color.NRGBA{37, 128, 201, 200}},
+		{"flat vert", color.NRGBA{37, 128, 201, 200}, color.NRGBA{37, 128, 201, 200}, 1, 6, color.NRGBA{37, 128, 201, 200}},
+		{"half horz", color.NRGBA{10, 20, 30, 254}, color.NRGBA{11, 21, 31, 255}, 2, 1, color.NRGBA{11, 21, 31, 255}},
+		{"half vert", color.NRGBA{10, 20, 30, 254}, color.NRGBA{11, 21, 31, 255}, 1, 2, color.NRGBA{11, 21, 31, 255}},
+	} {
+		src := image.NewNRGBA(image.Rect(0, 0, tc.sw, tc.sh))
+		for i := 0; i < tc.sw*tc.sh; i++ {
+			c := tc.a
+			if i&1 == 1 {
+				c = tc.b
+			}
+			src.SetNRGBA(i%tc.sw, i/tc.sw, c)
+		}
+		dest := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		if err := NRGBA(ctx, dest, src); err != nil {
+			t.Fatal(err)
+		}
+		if got := dest.NRGBAAt(0, 0); got != tc.want {
+			t.Errorf("%s: want %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestNRGBATransparentColor(t *testing.T) {
+	ctx := context.Background()
+	// transparent pixels carry a stored color that must not bleed into
+	// their opaque neighbors.
+	hidden := color.NRGBA{255, 255, 0, 0}
+	blue := color.NRGBA{0, 0, 255, 255}
+	for _, tc := range []struct {
+		name   string
+		sw, sh int
+		dw, dh int
+	}{
+		{"horz", 6, 1, 2, 1},
+		{"vert", 1, 6, 1, 2},
+		{"both", 6, 6, 4, 4},
+	} {
+		src := image.NewNRGBA(image.Rect(0, 0, tc.sw, tc.sh))
+		for y := 0; y < tc.sh; y++ {
+			for x := 0; x < tc.sw; x++ {
+				c := blue
+				if (x+y)&1 == 1 {
+					c = hidden
+				}
+				src.SetNRGBA(x, y, c)
+			}
+		}
+		dest := image.NewNRGBA(image.Rect(0, 0, tc.dw, tc.dh))
+		if err := NRGBA(ctx, dest, src); err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < tc.dh; y++ {
+			for x := 0; x < tc.dw; x++ {
+				if c := dest.NRGBAAt(x, y); c.R != 0 || c.G != 0 || c.B != 255 {
+					t.Errorf("%s (%d, %d): want pure blue, got %v", tc.name, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func TestNRGBAToRGBA(t *testing.T) {
+	ctx := context.Background()
+	src := testPattern(64, 48)
+	for _, sz := range []image.Point{{31, 17}, {64, 17}, {31, 48}, {64, 48}} {
+		tmp := image.NewNRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := NRGBA(ctx, tmp, src); err != nil {
+			t.Fatal(err)
+		}
+		want := image.NewRGBA(tmp.Rect)
+		draw.Draw(want, want.Rect, tmp, image.Point{}, draw.Src)
+
+		got := image.NewRGBA(tmp.Rect)
+		if err := NRGBAToRGBA(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		for i := range want.Pix {
+			if d := int(want.Pix[i]) - int(got.Pix[i]); d < -1 || d > 1 {
+				t.Fatalf("%v: Pix[%d]: want %d, got %d", sz, i, want.Pix[i], got.Pix[i])
+			}
+		}
+	}
+}
+
+func TestNRGBAOneAxis(t *testing.T) {
+	ctx := context.Background()
+	src := testPattern(64, 48)
+	for _, tc := range []struct {
+		name string
+		fn   func(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error
+		size image.Point
+		bad  image.Point
+	}{
+		{"NRGBAHorizontal", NRGBAHorizontal, image.Pt(23, 48), image.Pt(23, 47)},
+		{"NRGBAVertical", NRGBAVertical, image.Pt(64, 19), image.Pt(63, 19)},
+		{"NRGBAVertical", NRGBAVertical, image.Pt(64, 48), image.Pt(64, 48)},
+		{"NRGBAHorizontal", NRGBAHorizontal, image.Pt(64, 48), image.Pt(65, 48)},
+	} {
+		want := image.NewNRGBA(image.Rect(0, 0, tc.size.X, tc.size.Y))
+		if err := NRGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewNRGBA(want.Rect)
+		if err := tc.fn(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%s %v: differs from NRGBA", tc.name, tc.size)
+		}
+		if tc.bad != tc.size {
+			if err := tc.fn(ctx, image.NewNRGBA(image.Rect(0, 0, tc.bad.X, tc.bad.Y)), src); err == nil {
+				t.Errorf("%s %v: want an error", tc.name, tc.bad)
+			}
+		}
+	}
+}
+
+func TestNRGBAInPlace(t *testing.T) {
+	ctx := context.Background()
+	img := testPattern(64, 48)
+	want := image.NewNRGBA(image.Rect(0, 0, 64, 19))
+	if err := NRGBA(ctx, want, testPattern(64, 48)); err != nil {
+		t.Fatal(err)
+	}
+	dest := img.SubImage(image.Rect(0, 5, 64, 24)).(*image.NRGBA)
+	if err := NRGBA(ctx, dest, img); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 19; y++ {
+		if !bytes.Equal(want.Pix[y*want.Stride:(y+1)*want.Stride], dest.Pix[y*dest.Stride:y*dest.Stride+64*4]) {
+			t.Errorf("row %d differs from the non-aliased result", y)
+			break
+		}
+	}
+}
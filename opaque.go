@@ -0,0 +1,289 @@
+package downscale
+
+import (
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+)
+
+// RGBAOpaque is RGBA for images whose pixels are all opaque. It averages the
+// color channels directly, skipping the alpha weighting. The alpha of src is
+// not read and every pixel of dest is written with an alpha of 255.
+func RGBAOpaque(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaOpaque(ctx, dest, src, opts)
+	})
+}
+
+func rgbaOpaque(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8) || !sumFits(sh, dh, peak8) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			d := dest.Pix[y*dest.Stride : y*dest.Stride+dw<<2]
+			copy(d, src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+			for i := 3; i < len(d); i += 4 {
+				d[i] = 255
+			}
+		}
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := image.NewRGBA(image.Rect(0, 0, dw, sh))
+				h.pass(horzOpaque8RGBA(ctx, tmp, src, true, false, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vertOpaque8RGBA(ctx, dest, tmp, true, false, false, o))
+			} else {
+				h.pass(vertOpaque8RGBA(ctx, dest, src, true, false, false, o))
+			}
+		} else {
+			h.pass(horzOpaque8RGBA(ctx, dest, src, true, false, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// RGBAFlatten is RGBA that also composites the result over bg, so that the
+// transparent areas of src become bg. The composite is a single pass over
+// dest, which is far cheaper than compositing src beforehand.
+func RGBAFlatten(ctx context.Context, dest *image.RGBA, src *image.RGBA, bg color.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaFlatten(ctx, dest, src, bg, opts)
+	})
+}
+
+func rgbaFlatten(ctx context.Context, dest *image.RGBA, src *image.RGBA, bg color.RGBA, opts []Option) error {
+	if err := RGBA(ctx, dest, src, opts...); err != nil {
+		return err
+	}
+	dw, dh := dest.Rect.Dx()<<2, dest.Rect.Dy()
+	r, g, b, a := uint32(bg.R), uint32(bg.G), uint32(bg.B), uint32(bg.A)
+	for y := 0; y < dh; y++ {
+		d := dest.Pix[y*dest.Stride : y*dest.Stride+dw]
+		for i := 0; i < len(d); i += 4 {
+			inv := 255 - uint32(d[i+3])
+			if inv == 0 {
+				continue
+			}
+			d[i+0] += uint8((r*inv + 127) / 255)
+			d[i+1] += uint8((g*inv + 127) / 255)
+			d[i+2] += uint8((b*inv + 127) / 255)
+			d[i+3] += uint8((a*inv + 127) / 255)
+		}
+	}
+	return nil
+}
+
+// isOpaque8 reports whether every alpha in the w*4 bytes wide rows of pix is
+// 255. It stops at the first translucent pixel, so translucent images rarely
+// pay for more than a few rows.
+func isOpaque8(pix []byte, stride int, w int, h int) bool {
+	const mask = 0xff000000ff000000
+	for y := 0; y < h; y++ {
+		row := pix[y*stride : y*stride+w<<2]
+		i := 0
+		for ; i+8 <= len(row); i += 8 {
+			if binary.LittleEndian.Uint64(row[i:])&mask != mask {
+				return false
+			}
+		}
+		if i < len(row) && row[i+3] != 255 {
+			return false
+		}
+	}
+	return true
+}
+
+// horzOpaque8RGBA and vertOpaque8RGBA average all four channels of src
+// without alpha weighting. With keepA the fourth channel is written as
+// averaged, otherwise as 255.
+func horzOpaque8RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA, round bool, keepA bool, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sw, dw)
+	if err != nil {
+		return err
+	}
+	dh := uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := dh / uint32(n)
+	y := uint32(0)
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horzOpaque8RGBAInner(h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft, round, keepA)
+		})
+		y += step
+	}
+	spawn(func() {
+		horzOpaque8RGBAInner(h, y, dh, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft, round, keepA)
+	})
+	return h.Wait(ctx)
+}
+
+func vertOpaque8RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA, round bool, flip bool, keepA bool, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dx() {
+		n--
+	}
+
+	dw := uint32(dest.Rect.Dx())
+	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sh, dh)
+	if err != nil {
+		return err
+	}
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := (dw / uint32(n)) << 2
+	x := uint32(0)
+	for i := 1; i < n; i++ {
+		xMin := x
+		spawn(func() {
+			vertOpaque8RGBAInner(h, xMin, xMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft, round, flip, keepA)
+		})
+		x += step
+	}
+	spawn(func() {
+		vertOpaque8RGBAInner(h, x, dw<<2, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft, round, flip, keepA)
+	})
+	return h.Wait(ctx)
+}
+
+func horzOpaque8RGBAInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dw uint32, tt []uint32, ft []uint32, round bool, keepA bool) {
+	defer h.Done()
+	rnd := opaqueRounding(h.round(), round)
+	// the row is widened to uint32 so that the taps of RGBA can be shared.
+	swx4, dwx4 := tt[dw]<<2, dw<<2
+	buf := make([]uint32, swx4)
+	acc := make([]uint32, dwx4)
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		for i := range buf {
+			buf[i] = 0
+		}
+		si := y * ss
+		accumulate8(buf, s[si:si+swx4], 1)
+		horzTaps8RGBA(acc, buf, tt, ft, slcmlen)
+		di := y * ds
+		storeOpaque8(d[di:di+dwx4], acc, dlcmlen, rnd, keepA)
+	}
+}
+
+func vertOpaque8RGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dh uint32, tt []uint32, ft []uint32, round bool, flip bool, keepA bool) {
+	defer h.Done()
+	rnd := opaqueRounding(h.round(), round)
+	n := xMax - xMin
+	acc := make([]uint32, n)
+	for y, fr := uint32(0), uint32(0); y < dh; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		tl, tr := tt[y], tt[y+1]
+		fl := slcmlen - fr
+		fr = ft[y]
+		si := tl*ss + xMin
+		for i := range acc {
+			acc[i] = 0
+		}
+		accumulate8(acc, s[si:si+n], fl)
+		for i := tl + 1; i < tr; i++ {
+			si += ss
+			accumulate8(acc, s[si:si+n], slcmlen)
+		}
+		if fr != 0 {
+			si += ss
+			accumulate8(acc, s[si:si+n], fr)
+		}
+		dy := y
+		if flip {
+			dy = dh - 1 - y
+		}
+		di := dy*ds + xMin
+		storeOpaque8(d[di:di+n], acc, dlcmlen, rnd, keepA)
+	}
+}
+
+// accumulate8Generic adds every byte of row to acc, weighted by w.
+func accumulate8Generic(acc []uint32, row []byte, w uint32) {
+	row = row[:len(acc)]
+	for i, v := range row {
+		acc[i] += uint32(v) * w
+	}
+}
+
+// opaqueRounding resolves the default rounding of storeOpaque8. Without
+// round the averages are truncated, which is what RGBA gives for opaque
+// pixels.
+func opaqueRounding(r Rounding, round bool) Rounding {
+	if round {
+		return r.or(RoundNearest)
+	}
+	return r.or(RoundDown)
+}
+
+// storeOpaque8 writes the averages of acc to d with an alpha of 255, or with
+// the averaged alpha when keepA is set.
+func storeOpaque8(d []byte, acc []uint32, dlcmlen uint32, rnd Rounding, keepA bool) {
+	d = d[:len(acc)]
+	div := newDivider(dlcmlen)
+	bias := uint32(rnd.bias(uint64(dlcmlen)))
+	if rnd == RoundDiffuse {
+		var f diffuser
+		for i, v := range acc {
+			if c := i & 3; c != 3 || keepA {
+				d[i] = uint8(f.next(c, uint64(v), uint64(dlcmlen)))
+			} else {
+				d[i] = 255
+			}
+		}
+		return
+	}
+	if keepA {
+		for i, v := range acc {
+			d[i] = uint8(div.div(v + bias))
+		}
+		return
+	}
+	for i := 0; i < len(acc); i += 4 {
+		d[i+0] = uint8(div.div(acc[i+0] + bias))
+		d[i+1] = uint8(div.div(acc[i+1] + bias))
+		d[i+2] = uint8(div.div(acc[i+2] + bias))
+		d[i+3] = 255
+	}
+}
@@ -0,0 +1,111 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestRGBAOpaque(t *testing.T) {
+	ctx := context.Background()
+	pattern := testPattern(64, 48)
+	for i := 3; i < len(pattern.Pix); i += 4 {
+		pattern.Pix[i] = 255
+	}
+	src := image.NewRGBA(pattern.Rect)
+	draw.Draw(src, src.Rect, pattern, image.Point{}, draw.Src)
+	for _, sz := range []image.Point{{23, 17}, {64, 17}, {23, 48}, {64, 48}, {1, 1}} {
+		want := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		if err := RGBAOpaque(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		// RGBA truncates in each pass where RGBAOpaque rounds.
+		for i := range want.Pix {
+			if d := int(got.Pix[i]) - int(want.Pix[i]); d < 0 || d > 2 {
+				t.Fatalf("%v: Pix[%d]: want %d, got %d", sz, i, want.Pix[i], got.Pix[i])
+			}
+		}
+	}
+}
+
+func TestRGBAOpaqueIgnoresAlpha(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(src, src.Rect, image.NewUniform(color.RGBA{10, 20, 30, 40}), image.Point{}, draw.Src)
+	dest := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	if err := RGBAOpaque(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(dest.Pix); i += 4 {
+		if got := (color.RGBA{dest.Pix[i], dest.Pix[i+1], dest.Pix[i+2], dest.Pix[i+3]}); got != (color.RGBA{10, 20, 30, 255}) {
+			t.Fatalf("pixel %d: want {10 20 30 255}, got %v", i>>2, got)
+		}
+	}
+}
+
+func TestRGBAOpaqueSource(t *testing.T) {
+	ctx := context.Background()
+	pattern := testPattern(64, 48)
+	for i := 3; i < len(pattern.Pix); i += 4 {
+		pattern.Pix[i] = 255
+	}
+	src := image.NewRGBA(pattern.Rect)
+	draw.Draw(src, src.Rect, pattern, image.Point{}, draw.Src)
+	o := newOptions(nil)
+	for _, sz := range []image.Point{{23, 17}, {64, 17}, {23, 48}, {1, 1}} {
+		tmp := image.NewRGBA(image.Rect(0, 0, sz.X, src.Rect.Dy()))
+		want := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		horz8RGBA(ctx, tmp, src, o)
+		vert8RGBA(ctx, want, tmp, o)
+		got := image.NewRGBA(want.Rect)
+		if err := RGBA(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: the opaque path differs from the alpha weighted one", sz)
+		}
+	}
+}
+
+func TestRGBAFlatten(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(src, src.Rect, image.NewUniform(color.NRGBA{255, 0, 0, 128}), image.Point{}, draw.Src)
+	src.SetRGBA(3, 3, color.RGBA{})
+	dest := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if err := RGBAFlatten(context.Background(), dest, src, color.RGBA{255, 255, 255, 255}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dest.RGBAAt(0, 0), (color.RGBA{255, 127, 127, 255}); got != want {
+		t.Errorf("want pink %v, got %v", want, got)
+	}
+	// a quarter of the bottom right pixel is fully transparent.
+	if got, want := dest.RGBAAt(1, 1), (color.RGBA{255, 159, 159, 255}); got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestIsOpaque8(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 7, 3))
+	draw.Draw(src, src.Rect, image.Opaque, image.Point{}, draw.Src)
+	if !isOpaque8(src.Pix, src.Stride, 7, 3) {
+		t.Error("want opaque")
+	}
+	for _, p := range []image.Point{{0, 0}, {5, 1}, {6, 2}} {
+		src.Pix[src.PixOffset(p.X, p.Y)+3] = 254
+		if isOpaque8(src.Pix, src.Stride, 7, 3) {
+			t.Errorf("%v: want translucent", p)
+		}
+		src.Pix[src.PixOffset(p.X, p.Y)+3] = 255
+	}
+	sub := src.SubImage(image.Rect(0, 0, 6, 3)).(*image.RGBA)
+	src.Pix[src.PixOffset(6, 0)+3] = 0
+	if !isOpaque8(sub.Pix, sub.Stride, 6, 3) {
+		t.Error("pixels outside the rows must not be read")
+	}
+}
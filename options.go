@@ -0,0 +1,247 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"math/bits"
+	"runtime"
+	"time"
+)
+
+// Option adjusts how a single call or a Scaler does its work.
+type Option func(*options)
+
+type options struct {
+	gamma       float64
+	concurrency int
+	abortRows   int
+	tiles       bool
+	vertFirst   bool
+	forceFilter bool
+	edge        EdgeMode
+	metrics     MetricsFunc
+	rounding    Rounding
+}
+
+func defaultOptions() options {
+	return options{
+		gamma: 2.2,
+	}
+}
+
+// WithGamma sets the gamma used by the gamma-correct methods of Scaler.
+func WithGamma(gamma float64) Option {
+	return func(o *options) {
+		o.gamma = gamma
+	}
+}
+
+// WithConcurrency limits the number of goroutines a single call runs its
+// work on. Zero or less means runtime.GOMAXPROCS(0).
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithAbortInterval sets how many rows each worker processes between checks
+// for cancellation. The default is 8; latency-sensitive callers can lower it
+// down to 1 at the cost of a little overhead. Zero or less means the default.
+func WithAbortInterval(rows int) Option {
+	return func(o *options) {
+		o.abortRows = rows
+	}
+}
+
+// WithParallelTiles makes RGBAPartialRect recompute the destination areas
+// of separate dirty rects concurrently. Areas that overlap are merged first,
+// so that no two workers write the same pixel.
+func WithParallelTiles(enabled bool) Option {
+	return func(o *options) {
+		o.tiles = enabled
+	}
+}
+
+// WithVerticalFirst makes RGBA and RGBAFlipV scale the height before the
+// width whenever that leaves the smaller intermediate image, as for tall
+// sources reduced mostly in height. The intermediate is rounded at a
+// different point, so the result may differ by one level from the default
+// order.
+func WithVerticalFirst(enabled bool) Option {
+	return func(o *options) {
+		o.vertFirst = enabled
+	}
+}
+
+// WithForceFilter makes RGBA and RGBAFlipV run the box filter even when src
+// and dest have the same size, instead of copying the pixels. The filter is
+// an identity at 1:1 for opaque pixels, while translucent ones may come out
+// one level lower as they are unpremultiplied and rounded.
+func WithForceFilter(enabled bool) Option {
+	return func(o *options) {
+		o.forceFilter = enabled
+	}
+}
+
+// WithEdgeMode sets how the filter kernels of RGBAFilter, NRGBAFilter and
+// RGBAKernel sample beyond the image bounds. The default is Clamp.
+func WithEdgeMode(edge EdgeMode) Option {
+	return func(o *options) {
+		o.edge = edge
+	}
+}
+
+// Rounding selects how the box filter rounds the averages it writes.
+type Rounding int
+
+const (
+	// RoundDefault keeps the rounding each function has always used: RGBA
+	// and RGBAFlipV truncate, while the others round to nearest.
+	RoundDefault Rounding = iota
+	// RoundDown truncates.
+	RoundDown
+	// RoundNearest rounds halves up.
+	RoundNearest
+	// RoundUp rounds any fraction up.
+	RoundUp
+	// RoundDiffuse rounds to nearest and carries what was rounded off to
+	// the next pixel of the row or column, so that the mean of the image is
+	// kept within a fraction of a level.
+	RoundDiffuse
+)
+
+// or returns r, or def for RoundDefault.
+func (r Rounding) or(def Rounding) Rounding {
+	if r == RoundDefault {
+		return def
+	}
+	return r
+}
+
+// bias returns what to add to a sum before dividing it by d.
+func (r Rounding) bias(d uint64) uint64 {
+	switch r {
+	case RoundNearest, RoundDiffuse:
+		return d >> 1
+	case RoundUp:
+		return d - 1
+	}
+	return 0
+}
+
+// diffuser carries what RoundDiffuse rounded off of each channel to the next
+// pixel. The zero value starts by rounding to nearest.
+type diffuser struct {
+	carry, div [4]uint64
+}
+
+// next returns v/div for channel c. A carry left by another divisor is
+// rescaled to div first, as straight colors are divided by the alpha sum of
+// their own pixel.
+func (f *diffuser) next(c int, v uint64, div uint64) uint64 {
+	switch f.div[c] {
+	case 0:
+		v += div >> 1
+	case div:
+		v += f.carry[c]
+	default:
+		hi, lo := bits.Mul64(f.carry[c], div)
+		q, _ := bits.Div64(hi, lo, f.div[c])
+		v += q
+	}
+	q := v / div
+	f.carry[c], f.div[c] = v-q*div, div
+	return q
+}
+
+// nextMax is next for a premultiplied color, which never exceeds alpha a.
+func (f *diffuser) nextMax(c int, v uint64, div uint64, a uint64) uint64 {
+	if q := f.next(c, v, div); q < a {
+		return q
+	}
+	return a
+}
+
+// WithRounding sets how the box filter of RGBA, NRGBA, Gray, Gray16,
+// RGBA64, NRGBA64 and the functions built on them rounds the averages each
+// pass writes. The default, RoundDefault, keeps the existing output.
+func WithRounding(r Rounding) Option {
+	return func(o *options) {
+		o.rounding = r
+	}
+}
+
+// MetricsFunc receives the number of source and destination pixels of a
+// finished call and the time it took.
+type MetricsFunc func(srcPixels int, dstPixels int, dur time.Duration)
+
+// WithMetrics makes Scale and the per-type functions such as RGBA, NRGBA,
+// Gray, RGBAGamma and RGBAFilter call fn after each call that succeeds.
+// A call that delegates to another one is reported once, as itself.
+func WithMetrics(fn MetricsFunc) Option {
+	return func(o *options) {
+		o.metrics = fn
+	}
+}
+
+type meteredKey struct{}
+
+// metered runs fn and reports it to the MetricsFunc of opts, unless there is
+// none or an outer call already reports the work.
+func metered(ctx context.Context, opts []Option, sr image.Rectangle, dr image.Rectangle, fn func(ctx context.Context) error) error {
+	return meteredPixels(ctx, opts, sr.Dx()*sr.Dy(), dr.Dx()*dr.Dy(), fn)
+}
+
+// meteredPixels is metered for work that is not a single source and
+// destination rectangle, such as a batch.
+func meteredPixels(ctx context.Context, opts []Option, srcPixels int, dstPixels int, fn func(ctx context.Context) error) error {
+	if len(opts) == 0 || ctx.Value(meteredKey{}) != nil {
+		return fn(ctx)
+	}
+	o := newOptions(opts)
+	if o.metrics == nil {
+		return fn(ctx)
+	}
+	start := time.Now()
+	if err := fn(context.WithValue(ctx, meteredKey{}, struct{}{})); err != nil {
+		return err
+	}
+	o.metrics(srcPixels, dstPixels, time.Since(start))
+	return nil
+}
+
+func newOptions(opts []Option) *options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &o
+}
+
+// minWorkPerWorker is the least number of destination pixels a worker of a
+// pass gets, so that starting it and its buffers stays small next to its
+// share of the work.
+const minWorkPerWorker = 1 << 13
+
+// workers returns how many workers a pass writing pixels destination pixels
+// runs on. WithConcurrency overrides it.
+func (o *options) workers(pixels int) int {
+	if o.concurrency > 0 {
+		return o.concurrency
+	}
+	n := runtime.GOMAXPROCS(0)
+	if m := pixels / minWorkPerWorker; m < n {
+		n = m
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (o *options) abortEvery() uint32 {
+	if o.abortRows > 0 {
+		return uint32(o.abortRows)
+	}
+	return 8
+}
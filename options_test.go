@@ -0,0 +1,482 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWithConcurrency(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 200, 150))
+	draw.Draw(src, src.Rect, testPattern(200, 150), image.Point{}, draw.Src)
+	funcs := map[string]func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error{
+		"RGBA": RGBA,
+		"RGBAGamma": func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+			return RGBAGamma(ctx, dest, src, 2.2, opts...)
+		},
+		"RGBALanczos": RGBALanczos,
+		"RGBAFast":    RGBAFast,
+	}
+	for name, fn := range funcs {
+		want := image.NewRGBA(image.Rect(0, 0, 57, 41))
+		if err := fn(ctx, want, src, WithConcurrency(1)); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{0, 2, 7} {
+			got := image.NewRGBA(want.Rect)
+			if err := fn(ctx, got, src, WithConcurrency(n)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want.Pix, got.Pix) {
+				t.Errorf("%s: concurrency %d differs from concurrency 1", name, n)
+			}
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	if got := newOptions([]Option{WithConcurrency(3)}).workers(1); got != 3 {
+		t.Errorf("want 3, got %d", got)
+	}
+	if got := newOptions(nil).workers(1 << 30); got != runtime.GOMAXPROCS(0) {
+		t.Errorf("want %d, got %d", runtime.GOMAXPROCS(0), got)
+	}
+	if got := newOptions(nil).workers(minWorkPerWorker - 1); got != 1 {
+		t.Errorf("want 1, got %d", got)
+	}
+	if runtime.GOMAXPROCS(0) >= 2 {
+		if got := newOptions(nil).workers(minWorkPerWorker * 2); got != 2 {
+			t.Errorf("want 2, got %d", got)
+		}
+	}
+}
+
+func TestWithAbortInterval(t *testing.T) {
+	const sw, sh, dw = 8, 32, 4
+	src := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	tt, ft, err := makeTable(dw, sw/4, dw/4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		opts []Option
+		rows int
+	}{
+		{nil, 7},
+		{[]Option{WithAbortInterval(1)}, 0},
+		{[]Option{WithAbortInterval(4)}, 3},
+		{[]Option{WithAbortInterval(64)}, sh},
+	} {
+		// the handle is aborted up front, so rows are only processed until
+		// the first check.
+		h := &handle{every: newOptions(tc.opts).abortEvery()}
+		h.wg.Add(1)
+		h.SetAbort()
+		dest := image.NewRGBA(image.Rect(0, 0, dw, sh))
+		horz8RGBAInner(h, 0, sh, dest.Pix, src.Pix, uint32(dest.Stride), uint32(src.Stride), sw/4, dw/4, dw, tt, ft, false)
+		rows := 0
+		for y := 0; y < sh; y++ {
+			if dest.Pix[y*dest.Stride+3] != 0 {
+				rows++
+			}
+		}
+		if rows != tc.rows {
+			t.Errorf("want %d, got %d", tc.rows, rows)
+		}
+	}
+}
+
+func TestWithVerticalFirst(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 60, 400))
+	draw.Draw(src, src.Rect, testPattern(60, 400), image.Point{}, draw.Src)
+	for _, fn := range []func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error{RGBA, RGBAFlipV} {
+		want := image.NewRGBA(image.Rect(0, 0, 45, 30))
+		if err := fn(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		if err := fn(ctx, got, src, WithVerticalFirst(true)); err != nil {
+			t.Fatal(err)
+		}
+		for i := range want.Pix {
+			if d := int(got.Pix[i]) - int(want.Pix[i]); d < -1 || d > 1 {
+				t.Fatalf("Pix[%d]: want about %d, got %d", i, want.Pix[i], got.Pix[i])
+			}
+		}
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	ctx := context.Background()
+	var calls, srcPixels, dstPixels int
+	var dur time.Duration
+	opt := WithMetrics(func(s int, d int, t time.Duration) {
+		calls++
+		srcPixels, dstPixels, dur = s, d, t
+	})
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(src, src.Rect, testPattern(300, 200), image.Point{}, draw.Src)
+	dest := image.NewNRGBA(image.Rect(0, 0, 70, 40))
+	// Scale delegates to NRGBA, but the call is reported once.
+	if err := Scale(ctx, dest, src, opt); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("want 1 call, got %d", calls)
+	}
+	if srcPixels != 300*200 || dstPixels != 70*40 {
+		t.Errorf("want 60000 and 2800 pixels, got %d and %d", srcPixels, dstPixels)
+	}
+	if dur <= 0 {
+		t.Errorf("want a positive duration, got %v", dur)
+	}
+
+	if err := NRGBA(ctx, image.NewNRGBA(image.Rect(0, 0, 400, 400)), src, opt); err == nil {
+		t.Fatal("want an error for an upscale")
+	}
+	if calls != 1 {
+		t.Errorf("a failed call was reported")
+	}
+}
+
+func TestWithRounding(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		pix  []uint8
+		rnd  Rounding
+		want uint8
+	}{
+		// 10.5
+		{[]uint8{10, 11}, RoundDown, 10},
+		{[]uint8{10, 11}, RoundNearest, 11},
+		{[]uint8{10, 11}, RoundUp, 11},
+		// 10.33...
+		{[]uint8{10, 10, 11}, RoundNearest, 10},
+		{[]uint8{10, 10, 11}, RoundUp, 11},
+	} {
+		w := len(tc.pix)
+		gray := image.NewGray(image.Rect(0, 0, w, 1))
+		rgba := image.NewRGBA(image.Rect(0, 0, w, 1))
+		nrgba := image.NewNRGBA(image.Rect(0, 0, w, 1))
+		for x, v := range tc.pix {
+			gray.Pix[x] = v
+			copy(rgba.Pix[x*4:], []uint8{v, v, v, 255})
+			copy(nrgba.Pix[x*4:], []uint8{v, v, v, 255})
+		}
+		gotGray := image.NewGray(image.Rect(0, 0, 1, 1))
+		if err := Gray(ctx, gotGray, gray, WithRounding(tc.rnd)); err != nil {
+			t.Fatal(err)
+		}
+		gotRGBA := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		if err := RGBA(ctx, gotRGBA, rgba, WithRounding(tc.rnd)); err != nil {
+			t.Fatal(err)
+		}
+		gotNRGBA := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		if err := NRGBA(ctx, gotNRGBA, nrgba, WithRounding(tc.rnd)); err != nil {
+			t.Fatal(err)
+		}
+		if gotGray.Pix[0] != tc.want || gotRGBA.Pix[0] != tc.want || gotNRGBA.Pix[0] != tc.want {
+			t.Errorf("%v %d: want %d, got Gray %d, RGBA %d, NRGBA %d", tc.pix, tc.rnd, tc.want, gotGray.Pix[0], gotRGBA.Pix[0], gotNRGBA.Pix[0])
+		}
+	}
+
+	// by default RGBA truncates and Gray rounds to nearest.
+	rgba := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	copy(rgba.Pix, []uint8{10, 10, 10, 255, 11, 11, 11, 255})
+	got := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	if err := RGBA(ctx, got, rgba); err != nil {
+		t.Fatal(err)
+	}
+	if got.Pix[0] != 10 {
+		t.Errorf("RGBA: want 10, got %d", got.Pix[0])
+	}
+	gray := &image.Gray{Pix: []uint8{10, 11}, Stride: 2, Rect: image.Rect(0, 0, 2, 1)}
+	gotGray := image.NewGray(image.Rect(0, 0, 1, 1))
+	if err := Gray(ctx, gotGray, gray); err != nil {
+		t.Fatal(err)
+	}
+	if gotGray.Pix[0] != 11 {
+		t.Errorf("Gray: want 11, got %d", gotGray.Pix[0])
+	}
+}
+
+func TestWithForceFilter(t *testing.T) {
+	ctx := context.Background()
+	translucent := image.NewRGBA(image.Rect(0, 0, 37, 23))
+	draw.Draw(translucent, translucent.Rect, testPattern(37, 23), image.Point{}, draw.Src)
+	opaque := image.NewRGBA(translucent.Rect)
+	draw.Draw(opaque, opaque.Rect, testPattern(37, 23), image.Point{}, draw.Over)
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 255
+	}
+	for _, s := range []*image.RGBA{opaque, translucent} {
+		for _, flip := range []bool{false, true} {
+			f := RGBA
+			if flip {
+				f = RGBAFlipV
+			}
+			want := image.NewRGBA(s.Rect)
+			if err := f(ctx, want, s); err != nil {
+				t.Fatal(err)
+			}
+			got := image.NewRGBA(s.Rect)
+			if err := f(ctx, got, s, WithForceFilter(true)); err != nil {
+				t.Fatal(err)
+			}
+			for i := range want.Pix {
+				if d := int(want.Pix[i]) - int(got.Pix[i]); d < 0 || d > 1 || s == opaque && d != 0 {
+					t.Fatalf("flip %v, #%d: want %d, got %d", flip, i, want.Pix[i], got.Pix[i])
+				}
+			}
+		}
+	}
+}
+
+func TestRoundDiffuse(t *testing.T) {
+	ctx := context.Background()
+	// every destination pixel averages to x.4, so rounding each to nearest
+	// loses 0.4 of the mean.
+	pattern := []uint16{1000, 1000, 1000, 1001, 1001}
+	src := image.NewGray(image.Rect(0, 0, 200, 90))
+	src16 := image.NewGray16(src.Rect)
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 200; x++ {
+			v := pattern[(x+y)%5]
+			src.Pix[y*src.Stride+x] = uint8(v - 990)
+			src16.SetGray16(x, y, color.Gray16{Y: v})
+		}
+	}
+	for _, rnd := range []Rounding{RoundNearest, RoundDiffuse} {
+		dest := image.NewGray(image.Rect(0, 0, 40, 30))
+		if err := Gray(ctx, dest, src, WithRounding(rnd)); err != nil {
+			t.Fatal(err)
+		}
+		dest16 := image.NewGray16(dest.Rect)
+		if err := Gray16(ctx, dest16, src16, WithRounding(rnd)); err != nil {
+			t.Fatal(err)
+		}
+		var sum, sum16 float64
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				sum += float64(dest.GrayAt(x, y).Y)
+				sum16 += float64(dest16.Gray16At(x, y).Y)
+			}
+		}
+		mean, mean16 := sum/1200-10.4, sum16/1200-1000.4
+		if rnd == RoundDiffuse && (math.Abs(mean) > 0.02 || math.Abs(mean16) > 0.02) {
+			t.Errorf("mean is off by %v and %v", mean, mean16)
+		}
+		if rnd == RoundNearest && math.Abs(mean) < 0.3 {
+			t.Errorf("want RoundNearest to drift, off by %v", mean)
+		}
+	}
+}
+
+func TestRoundDiffuseColor(t *testing.T) {
+	ctx := context.Background()
+	// as in TestRoundDiffuse, every destination pixel averages to x.4.
+	pattern := []uint16{1000, 1000, 1000, 1001, 1001}
+	sr, dr := image.Rect(0, 0, 200, 90), image.Rect(0, 0, 40, 30)
+	fill := func(set func(x, y int, v uint16)) {
+		for y := 0; y < 90; y++ {
+			for x := 0; x < 200; x++ {
+				set(x, y, pattern[(x+y)%5])
+			}
+		}
+	}
+	// mean averages the color channels of pix, skipping alpha.
+	mean := func(pix []byte, size int) float64 {
+		var sum float64
+		n := 0
+		for i := 0; i < len(pix); i += size {
+			if i/size%4 == 3 {
+				continue
+			}
+			v := uint(pix[i])
+			if size == 2 {
+				v = v<<8 | uint(pix[i+1])
+			}
+			sum += float64(v)
+			n++
+		}
+		return sum / float64(n)
+	}
+	tests := map[string]func(rnd Rounding) (float64, error){
+		"RGBA": func(rnd Rounding) (float64, error) {
+			src, dest := image.NewRGBA(sr), image.NewRGBA(dr)
+			fill(func(x, y int, v uint16) {
+				src.SetRGBA(x, y, color.RGBA{uint8(v - 990), uint8(v - 990), uint8(v - 990), 0xff})
+			})
+			err := RGBA(ctx, dest, src, WithRounding(rnd))
+			return mean(dest.Pix, 1) - 10.4, err
+		},
+		"RGBAOpaque": func(rnd Rounding) (float64, error) {
+			src, dest := image.NewRGBA(sr), image.NewRGBA(dr)
+			fill(func(x, y int, v uint16) {
+				src.SetRGBA(x, y, color.RGBA{uint8(v - 990), uint8(v - 990), uint8(v - 990), 0xff})
+			})
+			err := RGBAOpaque(ctx, dest, src, WithRounding(rnd))
+			return mean(dest.Pix, 1) - 10.4, err
+		},
+		"NRGBA": func(rnd Rounding) (float64, error) {
+			src, dest := image.NewNRGBA(sr), image.NewNRGBA(dr)
+			fill(func(x, y int, v uint16) {
+				src.SetNRGBA(x, y, color.NRGBA{uint8(v - 990), uint8(v - 990), uint8(v - 990), uint8(0x80 + x%3)})
+			})
+			err := NRGBA(ctx, dest, src, WithRounding(rnd))
+			return mean(dest.Pix, 1) - 10.4, err
+		},
+		"RGBA64": func(rnd Rounding) (float64, error) {
+			src, dest := image.NewRGBA64(sr), image.NewRGBA64(dr)
+			fill(func(x, y int, v uint16) { src.SetRGBA64(x, y, color.RGBA64{v, v, v, 0xffff}) })
+			err := RGBA64(ctx, dest, src, WithRounding(rnd))
+			return mean(dest.Pix, 2) - 1000.4, err
+		},
+		"NRGBA64": func(rnd Rounding) (float64, error) {
+			src, dest := image.NewNRGBA64(sr), image.NewNRGBA64(dr)
+			fill(func(x, y int, v uint16) { src.SetNRGBA64(x, y, color.NRGBA64{v, v, v, uint16(0x8000 + x%3)}) })
+			err := NRGBA64(ctx, dest, src, WithRounding(rnd))
+			return mean(dest.Pix, 2) - 1000.4, err
+		},
+	}
+	for name, fn := range tests {
+		for _, rnd := range []Rounding{RoundNearest, RoundDiffuse} {
+			off, err := fn(rnd)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if rnd == RoundDiffuse && math.Abs(off) > 0.02 {
+				t.Errorf("%s: mean is off by %v", name, off)
+			}
+			if rnd == RoundNearest && math.Abs(off) < 0.3 {
+				t.Errorf("%s: want RoundNearest to drift, off by %v", name, off)
+			}
+		}
+	}
+}
+
+func TestWithMetricsOnce(t *testing.T) {
+	ctx := context.Background()
+	var calls int
+	opt := WithMetrics(func(int, int, time.Duration) { calls++ })
+
+	const sw, sh, dw, dh = 40, 30, 10, 8
+	sr, dr := image.Rect(0, 0, sw, sh), image.Rect(0, 0, dw, dh)
+	nsrc := image.NewNRGBA(sr)
+	draw.Draw(nsrc, sr, testPattern(sw, sh), image.Point{}, draw.Src)
+	src := image.NewRGBA(sr)
+	draw.Draw(src, sr, nsrc, image.Point{}, draw.Src)
+	gsrc := image.NewGray(sr)
+	draw.Draw(gsrc, sr, nsrc, image.Point{}, draw.Src)
+	ysrc := image.NewYCbCr(sr, image.YCbCrSubsampleRatio420)
+	asrc := image.NewNYCbCrA(sr, image.YCbCrSubsampleRatio420)
+	fsrc := make([]float32, sw*sh*4)
+	nd := func() *image.NRGBA { return image.NewNRGBA(dr) }
+	rd := func() *image.RGBA { return image.NewRGBA(dr) }
+
+	for name, fn := range map[string]func() error{
+		"RGBA":      func() error { return RGBA(ctx, rd(), src, opt) },
+		"RGBAFlipV": func() error { return RGBAFlipV(ctx, rd(), src, opt) },
+		"NRGBA":     func() error { return NRGBA(ctx, nd(), nsrc, opt) },
+		"Gray":      func() error { return Gray(ctx, image.NewGray(dr), gsrc, opt) },
+		"Gray16":    func() error { return Gray16(ctx, image.NewGray16(dr), image.NewGray16(sr), opt) },
+		"Alpha":     func() error { return Alpha(ctx, image.NewAlpha(dr), image.NewAlpha(sr), opt) },
+		"Alpha16":   func() error { return Alpha16(ctx, image.NewAlpha16(dr), image.NewAlpha16(sr), opt) },
+		"RGBA64":    func() error { return RGBA64(ctx, image.NewRGBA64(dr), image.NewRGBA64(sr), opt) },
+		"NRGBA64":   func() error { return NRGBA64(ctx, image.NewNRGBA64(dr), image.NewNRGBA64(sr), opt) },
+		"CMYK":      func() error { return CMYK(ctx, image.NewCMYK(dr), image.NewCMYK(sr), opt) },
+		"Paletted": func() error {
+			return Paletted(ctx, image.NewPaletted(dr, nil), image.NewPaletted(sr, color.Palette{color.Black}), opt)
+		},
+		"YCbCr":             func() error { return YCbCr(ctx, rd(), ysrc, opt) },
+		"NYCbCrA":           func() error { return NYCbCrA(ctx, nd(), asrc, opt) },
+		"Scale":             func() error { return Scale(ctx, rd(), src, opt) },
+		"GrayToNRGBA":       func() error { return GrayToNRGBA(ctx, nd(), gsrc, opt) },
+		"NRGBAToRGBA":       func() error { return NRGBAToRGBA(ctx, rd(), nsrc, opt) },
+		"RGBAToNRGBA":       func() error { return RGBAToNRGBA(ctx, nd(), src, opt) },
+		"RGBAToNRGBADirect": func() error { return RGBAToNRGBADirect(ctx, nd(), src, opt) },
+		"RGBAOpaque":        func() error { return RGBAOpaque(ctx, rd(), src, opt) },
+		"RGBAFlatten":       func() error { return RGBAFlatten(ctx, rd(), src, color.RGBA{A: 255}, opt) },
+		"RGBAFast":          func() error { return RGBAFast(ctx, rd(), src, opt) },
+		"NRGBAFast":         func() error { return NRGBAFast(ctx, nd(), nsrc, opt) },
+		"RGBAAdaptive":      func() error { return RGBAAdaptive(ctx, rd(), src, opt) },
+		"RGBAAdaptive deadline": func() error {
+			ctx, cancel := context.WithTimeout(ctx, time.Hour)
+			defer cancel()
+			return RGBAAdaptive(ctx, rd(), src, opt)
+		},
+		"RGBAProgressive": func() error { return RGBAProgressive(ctx, rd(), src, opt) },
+		"RGBARaw":         func() error { return RGBARaw(ctx, make([]byte, dw*dh*4), dw, dh, src.Pix, sw, sh, opt) },
+		"RGBAInto":        func() error { return RGBAInto(ctx, image.NewRGBA(image.Rect(0, 0, 20, 20)), dr, src, opt) },
+		"RGBAHorizontal":  func() error { return RGBAHorizontal(ctx, image.NewRGBA(image.Rect(0, 0, dw, sh)), src, opt) },
+		"RGBAVertical":    func() error { return RGBAVertical(ctx, image.NewRGBA(image.Rect(0, 0, sw, dh)), src, opt) },
+		"NRGBAHorizontal": func() error { return NRGBAHorizontal(ctx, image.NewNRGBA(image.Rect(0, 0, dw, sh)), nsrc, opt) },
+		"NRGBAVertical":   func() error { return NRGBAVertical(ctx, image.NewNRGBA(image.Rect(0, 0, sw, dh)), nsrc, opt) },
+		"RGBAWithTables": func() error {
+			return RGBAWithTables(ctx, rd(), src, NewWeightTable(sw, dw), NewWeightTable(sh, dh), opt)
+		},
+		"RGBAPartialRect":      func() error { return RGBAPartialRect(ctx, rd(), src, []image.Rectangle{dr}, opt) },
+		"RGBAResume":           func() error { return RGBAResume(ctx, rd(), src, &ResumeToken{}, opt) },
+		"RGBARows":             func() error { return RGBARows(ctx, rd(), rgbaRows{src}, sw, sh, opt) },
+		"RGBAWriteTo":          func() error { return RGBAWriteTo(ctx, rd(), src, func(int, []byte) {}, opt) },
+		"RGBABatch":            func() error { return RGBABatch(ctx, []*image.RGBA{rd(), rd()}, []*image.RGBA{src, src}, opt) },
+		"Float32RGBA":          func() error { return Float32RGBA(ctx, make([]float32, dw*dh*4), fsrc, dw, dh, sw, sh, opt) },
+		"RGBAGamma":            func() error { return RGBAGamma(ctx, rd(), src, 2.2, opt) },
+		"NRGBAGamma":           func() error { return NRGBAGamma(ctx, nd(), nsrc, 2.2, opt) },
+		"NRGBAGammaPerChannel": func() error { return NRGBAGammaPerChannel(ctx, nd(), nsrc, [3]float64{2.2, 2.2, 2.2}, opt) },
+		"NRGBAGammaApprox":     func() error { return NRGBAGammaApprox(ctx, nd(), nsrc, 2.2, opt) },
+		"RGBA64Gamma":          func() error { return RGBA64Gamma(ctx, image.NewRGBA64(dr), image.NewRGBA64(sr), 2.2, opt) },
+		"RGBALinear":           func() error { return RGBALinear(ctx, rd(), src, 2.2, opt) },
+		"RGBASRGB":             func() error { return RGBASRGB(ctx, rd(), src, opt) },
+		"NRGBASRGB":            func() error { return NRGBASRGB(ctx, nd(), nsrc, opt) },
+		"RGBAFilter":           func() error { return RGBAFilter(ctx, rd(), src, Lanczos3, opt) },
+		"NRGBAFilter":          func() error { return NRGBAFilter(ctx, nd(), nsrc, Lanczos3, opt) },
+		"RGBALanczos":          func() error { return RGBALanczos(ctx, rd(), src, opt) },
+		"NRGBALanczos":         func() error { return NRGBALanczos(ctx, nd(), nsrc, opt) },
+		"RGBAMitchell":         func() error { return RGBAMitchell(ctx, rd(), src, opt) },
+		"RGBACatmullRom":       func() error { return RGBACatmullRom(ctx, rd(), src, opt) },
+		"RGBATriangle":         func() error { return RGBATriangle(ctx, rd(), src, opt) },
+		"RGBAGaussian":         func() error { return RGBAGaussian(ctx, rd(), src, 0.5, opt) },
+		"RGBAKernel":           func() error { return RGBAKernel(ctx, rd(), src, func(float64) float64 { return 1 }, 0.5, opt) },
+		"RGBAPreset":           func() error { return RGBAPreset(ctx, rd(), src, Best, opt) },
+		"RGBAUpscale":          func() error { return RGBAUpscale(ctx, image.NewRGBA(image.Rect(0, 0, 50, 50)), src, opt) },
+		"NRGBAUpscale":         func() error { return NRGBAUpscale(ctx, image.NewNRGBA(image.Rect(0, 0, 50, 50)), nsrc, opt) },
+		"RGBABicubic":          func() error { return RGBABicubic(ctx, image.NewRGBA(image.Rect(0, 0, 50, 50)), src, opt) },
+		"FitRGBA": func() error {
+			_, err := FitRGBA(ctx, src, dw, dh, opt)
+			return err
+		},
+		"RGBAScaleBy": func() error {
+			_, err := RGBAScaleBy(ctx, src, 0.25, opt)
+			return err
+		},
+		"FillRGBA": func() error {
+			_, err := FillRGBA(ctx, src, dw, dh, opt)
+			return err
+		},
+		"RGBAMipmaps": func() error {
+			_, err := RGBAMipmaps(ctx, src, opt)
+			return err
+		},
+	} {
+		calls = 0
+		if err := fn(); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if calls != 1 {
+			t.Errorf("%s: want 1 report, got %d", name, calls)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package downscale
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+)
+
+func Paletted(ctx context.Context, dest *image.Paletted, src *image.Paletted, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return paletted(ctx, dest, src, opts)
+	})
+}
+
+func paletted(ctx context.Context, dest *image.Paletted, src *image.Paletted, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 1); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 1); err != nil {
+		return err
+	}
+	pal := dest.Palette
+	if len(pal) == 0 {
+		pal = src.Palette
+	}
+	if len(pal) == 0 || len(src.Palette) == 0 {
+		return errors.New("downscale: empty palette")
+	}
+
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+
+	var colors [256]color.RGBA
+	for i, c := range src.Palette {
+		if i == len(colors) {
+			break
+		}
+		colors[i] = color.RGBAModel.Convert(c).(color.RGBA)
+	}
+	every := int(newOptions(opts).abortEvery())
+	tmpSrc := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	for y := 0; y < sh; y++ {
+		if y%every == every-1 && ctx.Err() != nil {
+			return ErrAborted
+		}
+		s := src.Pix[y*src.Stride : y*src.Stride+sw]
+		d := tmpSrc.Pix[y*tmpSrc.Stride:]
+		for x, idx := range s {
+			c := colors[idx]
+			d[x<<2+0] = c.R
+			d[x<<2+1] = c.G
+			d[x<<2+2] = c.B
+			d[x<<2+3] = c.A
+		}
+	}
+
+	tmpDest := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	if err := RGBA(ctx, tmpDest, tmpSrc, opts...); err != nil {
+		return err
+	}
+
+	cache := map[color.RGBA]uint8{}
+	for y := 0; y < dh; y++ {
+		if y%every == every-1 && ctx.Err() != nil {
+			return ErrAborted
+		}
+		s := tmpDest.Pix[y*tmpDest.Stride:]
+		d := dest.Pix[y*dest.Stride : y*dest.Stride+dw]
+		for x := range d {
+			c := color.RGBA{s[x<<2+0], s[x<<2+1], s[x<<2+2], s[x<<2+3]}
+			idx, ok := cache[c]
+			if !ok {
+				idx = uint8(pal.Index(c))
+				cache[c] = idx
+			}
+			d[x] = idx
+		}
+	}
+	dest.Palette = pal
+	return nil
+}
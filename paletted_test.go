@@ -0,0 +1,71 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPaletted(t *testing.T) {
+	pal := make(color.Palette, 256)
+	for i := range pal {
+		pal[i] = color.Gray{Y: uint8(i)}
+	}
+	pal[0] = color.Transparent
+
+	src := image.NewPaletted(image.Rect(0, 0, 64, 4), pal)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 64; x++ {
+			src.Pix[y*src.Stride+x] = uint8(x * 4)
+		}
+	}
+	// the leftmost block is fully transparent.
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.Pix[y*src.Stride+x] = 0
+		}
+	}
+	dest := image.NewPaletted(image.Rect(0, 0, 16, 1), nil)
+	if err := Paletted(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	if len(dest.Palette) != len(pal) {
+		t.Fatalf("want palette of %d colors, got %d", len(pal), len(dest.Palette))
+	}
+	if got := dest.Pix[0]; got != 0 {
+		t.Errorf("x=0: want transparent index 0, got %d", got)
+	}
+	for x := 1; x < 16; x++ {
+		want := x*16 + 6
+		if got := int(dest.Pix[x]); got < want-1 || got > want+1 {
+			t.Errorf("x=%d: want %d, got %d", x, want, got)
+		}
+	}
+}
+
+func TestPalettedEmptyPalette(t *testing.T) {
+	src := image.NewPaletted(image.Rect(0, 0, 4, 4), nil)
+	dest := image.NewPaletted(image.Rect(0, 0, 2, 2), nil)
+	if err := Paletted(context.Background(), dest, src); err == nil {
+		t.Fatal("want error, got nil")
+	}
+}
+
+func TestPalettedShortPix(t *testing.T) {
+	pal := color.Palette{color.Black, color.White}
+	// a short Pix with spare capacity must not be read past its length.
+	spare := image.NewPaletted(image.Rect(0, 0, 40, 40), pal)
+	spare.Pix = spare.Pix[:10]
+	noCap := image.NewPaletted(spare.Rect, pal)
+	noCap.Pix = noCap.Pix[:10:10]
+	for name, src := range map[string]*image.Paletted{"spare": spare, "noCap": noCap} {
+		dest := image.NewPaletted(image.Rect(0, 0, 10, 10), pal)
+		if err := Paletted(context.Background(), dest, src); err == nil {
+			t.Errorf("%s src: want error, got nil", name)
+		}
+		if err := Paletted(context.Background(), src, image.NewPaletted(image.Rect(0, 0, 80, 80), pal)); err == nil {
+			t.Errorf("%s dest: want error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"sort"
+)
+
+// RGBAPartialRect updates dest, which must already hold the result of RGBA
+// for an earlier version of src, after the pixels of src inside rects have
+// changed. Only the destination pixels whose box covers a changed source
+// pixel are recomputed, and they come out exactly as RGBA would produce them.
+// rects are in the coordinates of src and may overlap.
+func RGBAPartialRect(ctx context.Context, dest *image.RGBA, src *image.RGBA, rects []image.Rectangle, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaPartialRect(ctx, dest, src, rects, opts)
+	})
+}
+
+func rgbaPartialRect(ctx context.Context, dest *image.RGBA, src *image.RGBA, rects []image.Rectangle, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	var horz, vert *WeightTable
+	if sw != dw {
+		horz = NewWeightTable(uint32(sw), uint32(dw))
+	}
+	if sh != dh {
+		vert = NewWeightTable(uint32(sh), uint32(dh))
+	}
+	o := newOptions(opts)
+	if !o.tiles {
+		for _, r := range rects {
+			if ctx.Err() != nil {
+				return ErrAborted
+			}
+			if d, ok := partialArea(r, src.Rect, horz, vert); ok {
+				partial8RGBA(dest, src, horz, vert, d, o.rounding)
+			}
+		}
+		return nil
+	}
+
+	var areas []image.Rectangle
+	for _, r := range rects {
+		if d, ok := partialArea(r, src.Rect, horz, vert); ok {
+			areas = mergeArea(areas, d)
+		}
+	}
+	if len(areas) == 0 {
+		return nil
+	}
+	pixels := 0
+	for _, d := range areas {
+		pixels += d.Dx() * d.Dy()
+	}
+	n := o.workers(pixels)
+	if n > len(areas) {
+		n = len(areas)
+	}
+	h := &handle{}
+	h.wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		spawn(func() {
+			defer h.Done()
+			for j := i; j < len(areas); j += n {
+				if h.Aborted() {
+					return
+				}
+				partial8RGBA(dest, src, horz, vert, areas[j], o.rounding)
+			}
+		})
+	}
+	return h.Wait(ctx)
+}
+
+// partialArea returns the destination pixels, relative to dest.Rect, whose
+// box covers a pixel of the dirty rect r of src.
+func partialArea(r image.Rectangle, srcRect image.Rectangle, horz *WeightTable, vert *WeightTable) (image.Rectangle, bool) {
+	r = r.Intersect(srcRect).Sub(srcRect.Min)
+	if r.Empty() {
+		return image.Rectangle{}, false
+	}
+	x0, x1 := horz.cover(r.Min.X, r.Max.X)
+	y0, y1 := vert.cover(r.Min.Y, r.Max.Y)
+	if x0 >= x1 || y0 >= y1 {
+		return image.Rectangle{}, false
+	}
+	return image.Rect(x0, y0, x1, y1), true
+}
+
+// mergeArea adds d to the disjoint areas, replacing the ones it overlaps
+// with their bounding box so that the areas stay disjoint.
+func mergeArea(areas []image.Rectangle, d image.Rectangle) []image.Rectangle {
+	for i := 0; i < len(areas); {
+		if areas[i].Overlaps(d) {
+			d = d.Union(areas[i])
+			areas[i] = areas[len(areas)-1]
+			areas = areas[:len(areas)-1]
+			i = 0
+			continue
+		}
+		i++
+	}
+	return append(areas, d)
+}
+
+// cover returns the range of destination pixels whose box overlaps the
+// source pixels from s0 to s1. A nil table maps pixels one to one.
+func (t *WeightTable) cover(s0 int, s1 int) (int, int) {
+	if t == nil {
+		return s0, s1
+	}
+	n := len(t.tt) - 1
+	d0 := sort.Search(n, func(x int) bool {
+		return t.end(x) > s0
+	})
+	d1 := sort.Search(n, func(x int) bool {
+		return int(t.tt[x]) >= s1
+	})
+	return d0, d1
+}
+
+// end returns one past the last source pixel in the box of destination pixel
+// x.
+func (t *WeightTable) end(x int) int {
+	if t.ft[x] != 0 {
+		return int(t.tt[x+1]) + 1
+	}
+	return int(t.tt[x+1])
+}
+
+// partial8RGBA recomputes the pixels of dest inside d, which is relative to
+// dest.Rect, with the same passes and intermediate rounding as RGBA.
+func partial8RGBA(dest *image.RGBA, src *image.RGBA, horz *WeightTable, vert *WeightTable, d image.Rectangle, rnd Rounding) {
+	sx0, sx1, sy0, sy1 := d.Min.X, d.Max.X, d.Min.Y, d.Max.Y
+	if horz != nil {
+		sx0, sx1 = int(horz.tt[d.Min.X]), horz.end(d.Max.X-1)
+	}
+	if vert != nil {
+		sy0, sy1 = int(vert.tt[d.Min.Y]), vert.end(d.Max.Y-1)
+	}
+
+	// rows holds the horizontally scaled source rows from sy0 to sy1,
+	// limited to the columns of d.
+	dwx4 := d.Dx() << 2
+	rows := make([][]byte, sy1-sy0)
+	buf := make([]uint32, (sx1-sx0)<<2)
+	acc := make([]uint32, dwx4)
+	for y := sy0; y < sy1; y++ {
+		s := src.Pix[y*src.Stride+sx0<<2 : y*src.Stride+sx1<<2]
+		if horz == nil {
+			rows[y-sy0] = s
+			continue
+		}
+		for i := range buf {
+			buf[i] = 0
+		}
+		accumulate8RGBA(buf, s, 1)
+		horz.taps(acc, buf, d.Min.X, sx0)
+		row := make([]byte, dwx4)
+		store8RGBA(row, acc, horz.dlcmlen, rnd)
+		rows[y-sy0] = row
+	}
+
+	for y := d.Min.Y; y < d.Max.Y; y++ {
+		di := y*dest.Stride + d.Min.X<<2
+		if vert == nil {
+			copy(dest.Pix[di:di+dwx4], rows[y-sy0])
+			continue
+		}
+		tl, tr := int(vert.tt[y]), int(vert.tt[y+1])
+		fl := vert.slcmlen
+		if y > 0 {
+			fl -= vert.ft[y-1]
+		}
+		fr := vert.ft[y]
+		for i := range acc {
+			acc[i] = 0
+		}
+		accumulate8RGBA(acc, rows[tl-sy0], fl)
+		for i := tl + 1; i < tr; i++ {
+			accumulate8RGBA(acc, rows[i-sy0], vert.slcmlen)
+		}
+		if fr != 0 {
+			accumulate8RGBA(acc, rows[tr-sy0], fr)
+		}
+		store8RGBA(dest.Pix[di:di+dwx4], acc, vert.dlcmlen, rnd)
+	}
+}
+
+// taps is horzTaps8RGBA for the destination pixels from x0 on, where buf
+// holds the expanded source row from pixel s0 on.
+func (t *WeightTable) taps(acc []uint32, buf []uint32, x0 int, s0 int) {
+	for i, x := 0, x0; i < len(acc); i, x = i+4, x+1 {
+		tl, tr := int(t.tt[x]), int(t.tt[x+1])
+		fl := t.slcmlen
+		if x > 0 {
+			fl -= t.ft[x-1]
+		}
+		fr := t.ft[x]
+		si := (tl - s0) << 2
+		r := buf[si+0] * fl
+		g := buf[si+1] * fl
+		b := buf[si+2] * fl
+		a := buf[si+3] * fl
+		si += 4
+		for j := tl + 1; j < tr; j++ {
+			r += buf[si+0] * t.slcmlen
+			g += buf[si+1] * t.slcmlen
+			b += buf[si+2] * t.slcmlen
+			a += buf[si+3] * t.slcmlen
+			si += 4
+		}
+		if fr != 0 {
+			r += buf[si+0] * fr
+			g += buf[si+1] * fr
+			b += buf[si+2] * fr
+			a += buf[si+3] * fr
+		}
+		acc[i+0] = r
+		acc[i+1] = g
+		acc[i+2] = b
+		acc[i+3] = a
+	}
+}
@@ -0,0 +1,180 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+func TestRGBAPartialRect(t *testing.T) {
+	ctx := context.Background()
+	full := image.NewRGBA(image.Rect(0, 0, 110, 80))
+	draw.Draw(full, full.Rect, testPattern(110, 80), image.Point{}, draw.Src)
+	// a sub-image checks that rects are taken in the coordinates of src.
+	r := image.Rect(3, 2, 104, 79)
+	rects := []image.Rectangle{
+		image.Rect(10, 10, 30, 25),
+		image.Rect(25, 20, 41, 33),
+		image.Rect(90, 70, 200, 200),
+		image.Rect(3, 40, 4, 41),
+	}
+	for _, sz := range []image.Point{{37, 29}, {101, 29}, {37, 77}, {101, 77}, {1, 1}} {
+		src := image.NewRGBA(full.Rect)
+		copy(src.Pix, full.Pix)
+		sub := src.SubImage(r).(*image.RGBA)
+		dest := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(ctx, dest, sub); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, dr := range rects {
+			draw.Draw(src, dr, image.NewUniform(color.RGBA{uint8(i * 60), 200, 0, 255}), image.Point{}, draw.Src)
+		}
+		if err := RGBAPartialRect(ctx, dest, sub, rects); err != nil {
+			t.Fatal(err)
+		}
+		want := image.NewRGBA(dest.Rect)
+		if err := RGBA(ctx, want, sub); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, dest.Pix) {
+			t.Errorf("%v: differs from a full recompute", sz)
+		}
+	}
+}
+
+func TestRGBAPartialRectUnion(t *testing.T) {
+	ctx := context.Background()
+	for _, rects := range [][]image.Rectangle{
+		{image.Rect(5, 5, 20, 20), image.Rect(15, 15, 30, 30)},
+		{image.Rect(5, 5, 20, 30), image.Rect(20, 5, 30, 30)},
+	} {
+		src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+		stale := image.NewRGBA(image.Rect(0, 0, 23, 19))
+		if err := RGBA(ctx, stale, src); err != nil {
+			t.Fatal(err)
+		}
+		var union image.Rectangle
+		for i, r := range rects {
+			draw.Draw(src, r, image.NewUniform(color.RGBA{uint8(i * 60), 0, 200, 255}), image.Point{}, draw.Src)
+			union = union.Union(r)
+		}
+
+		want := image.NewRGBA(stale.Rect)
+		copy(want.Pix, stale.Pix)
+		if err := RGBAPartialRect(ctx, want, src, []image.Rectangle{union}); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(stale.Rect)
+		copy(got.Pix, stale.Pix)
+		if err := RGBAPartialRect(ctx, got, src, rects); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: differs from the union", rects)
+		}
+	}
+}
+
+func TestRGBAPartialRectParallel(t *testing.T) {
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(1))
+	full := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(full, full.Rect, testPattern(300, 200), image.Point{}, draw.Src)
+	for _, sz := range []image.Point{{97, 61}, {300, 61}, {97, 200}} {
+		src := image.NewRGBA(full.Rect)
+		copy(src.Pix, full.Pix)
+		stale := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(ctx, stale, src); err != nil {
+			t.Fatal(err)
+		}
+		// many small tiles, some sharing edges and some overlapping.
+		var rects []image.Rectangle
+		for i := 0; i < 200; i++ {
+			x, y := rnd.Intn(300), rnd.Intn(200)
+			r := image.Rect(x, y, x+1+rnd.Intn(16), y+1+rnd.Intn(16))
+			if i%3 == 0 {
+				x, y = x&^15, y&^15
+				r = image.Rect(x, y, x+16, y+16)
+			}
+			draw.Draw(src, r, image.NewUniform(color.RGBA{uint8(i), uint8(i * 7), 90, 255}), image.Point{}, draw.Src)
+			rects = append(rects, r)
+		}
+
+		want := image.NewRGBA(stale.Rect)
+		copy(want.Pix, stale.Pix)
+		if err := RGBAPartialRect(ctx, want, src, rects); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(stale.Rect)
+		copy(got.Pix, stale.Pix)
+		if err := RGBAPartialRect(ctx, got, src, rects, WithParallelTiles(true), WithConcurrency(4)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: the parallel result differs from the serial one", sz)
+		}
+	}
+
+	areas := mergeArea(mergeArea(mergeArea(nil, image.Rect(0, 0, 4, 4)), image.Rect(8, 0, 12, 4)), image.Rect(3, 3, 9, 5))
+	if len(areas) != 1 || areas[0] != image.Rect(0, 0, 12, 5) {
+		t.Errorf("want the overlapping areas merged, got %v", areas)
+	}
+}
+
+func TestCover(t *testing.T) {
+	tbl := NewWeightTable(10, 4)
+	for _, tc := range []struct{ s0, s1, d0, d1 int }{
+		{0, 1, 0, 1},
+		{2, 3, 0, 2},
+		{3, 5, 1, 2},
+		{9, 10, 3, 4},
+		{0, 10, 0, 4},
+	} {
+		d0, d1 := tbl.cover(tc.s0, tc.s1)
+		if d0 != tc.d0 || d1 != tc.d1 {
+			t.Errorf("[%d, %d): want [%d, %d), got [%d, %d)", tc.s0, tc.s1, tc.d0, tc.d1, d0, d1)
+		}
+	}
+}
+
+func TestRGBAPartialRectTiles(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		sw, sh, dw, dh, tile int
+	}{
+		{128, 128, 37, 41, 48},
+		{128, 96, 64, 48, 48},
+		{300, 200, 77, 53, 256},
+		{129, 131, 128, 3, 32},
+		{97, 61, 13, 61, 10},
+	} {
+		src := image.NewRGBA(image.Rect(0, 0, tc.sw, tc.sh))
+		draw.Draw(src, src.Rect, testPattern(tc.sw, tc.sh), image.Point{}, draw.Src)
+		var rects []image.Rectangle
+		for y := 0; y < tc.sh; y += tc.tile {
+			for x := 0; x < tc.sw; x += tc.tile {
+				// the last tiles are cut off by src.Rect.
+				rects = append(rects, image.Rect(x, y, x+tc.tile, y+tc.tile))
+			}
+		}
+		want := image.NewRGBA(image.Rect(0, 0, tc.dw, tc.dh))
+		if err := RGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		for _, tiles := range []bool{false, true} {
+			got := image.NewRGBA(want.Rect)
+			if err := RGBAPartialRect(ctx, got, src, rects, WithParallelTiles(tiles)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want.Pix, got.Pix) {
+				t.Errorf("%+v, parallel %v: differs from RGBA", tc, tiles)
+			}
+		}
+	}
+}
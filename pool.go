@@ -0,0 +1,73 @@
+package downscale
+
+import (
+	"image"
+	"sync"
+)
+
+// pool bounds the number of goroutines running pass workers across every
+// call in the process. A nil tasks channel means no bound, which is the
+// default.
+var pool struct {
+	m     sync.RWMutex
+	tasks chan func()
+}
+
+// SetMaxWorkers bounds the total number of goroutines that run the scaling
+// passes, no matter how many calls are in flight. Calls that find every
+// worker busy wait for one to become free. Zero or less removes the bound.
+//
+// Workers of the previous setting finish the work already handed to them.
+func SetMaxWorkers(n int) {
+	pool.m.Lock()
+	defer pool.m.Unlock()
+	if pool.tasks != nil {
+		close(pool.tasks)
+		pool.tasks = nil
+	}
+	if n <= 0 {
+		return
+	}
+	tasks := make(chan func())
+	for i := 0; i < n; i++ {
+		go func() {
+			for f := range tasks {
+				f()
+			}
+		}()
+	}
+	pool.tasks = tasks
+}
+
+// spawn runs f on a pool worker, or on a new goroutine if there is no pool.
+// f must not spawn work itself, or it could wait for a worker it occupies.
+func spawn(f func()) {
+	pool.m.RLock()
+	defer pool.m.RUnlock()
+	if pool.tasks == nil {
+		go f()
+		return
+	}
+	pool.tasks <- f
+}
+
+// tmpPool recycles the pixel buffers of the intermediate images between the
+// two passes, which are as large as the source in one direction.
+var tmpPool sync.Pool // of *[]byte
+
+// getTmpRGBA returns a w x h image whose pixels are not cleared; the passes
+// overwrite every one of them.
+func getTmpRGBA(w int, h int) *image.RGBA {
+	n := w * h << 2
+	if p, ok := tmpPool.Get().(*[]byte); ok && cap(*p) >= n {
+		return &image.RGBA{Pix: (*p)[:n], Stride: w << 2, Rect: image.Rect(0, 0, w, h)}
+	}
+	return image.NewRGBA(image.Rect(0, 0, w, h))
+}
+
+// putTmpRGBA hands the pixels of img back to tmpPool. img must not be used
+// afterwards.
+func putTmpRGBA(img *image.RGBA) {
+	pix := img.Pix
+	tmpPool.Put(&pix)
+}
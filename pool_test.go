@@ -0,0 +1,123 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetMaxWorkers(t *testing.T) {
+	SetMaxWorkers(3)
+	defer SetMaxWorkers(0)
+
+	var running, peak int32
+	var wg sync.WaitGroup
+	wg.Add(100)
+	for i := 0; i < 100; i++ {
+		spawn(func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Errorf("want at most 3 workers at once, got %d", peak)
+	}
+}
+
+func TestSetMaxWorkersConcurrentCalls(t *testing.T) {
+	SetMaxWorkers(2)
+	defer SetMaxWorkers(0)
+
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	want := image.NewRGBA(image.Rect(0, 0, 17, 13))
+	if err := RGBA(ctx, want, src); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 1000)
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got := image.NewRGBA(want.Rect)
+			if err := RGBA(ctx, got, src, WithConcurrency(4)); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(want.Pix, got.Pix) {
+				t.Error("pooled output differs")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestTmpPoolReuse(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	want := image.NewRGBA(image.Rect(0, 0, 23, 17))
+	if err := RGBA(ctx, want, src); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stale buffer from the pool must not show through.
+	dirty := getTmpRGBA(64, 48)
+	for i := range dirty.Pix {
+		dirty.Pix[i] = 0xff
+	}
+	putTmpRGBA(dirty)
+	got := image.NewRGBA(want.Rect)
+	if err := RGBA(ctx, got, src); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want.Pix, got.Pix) {
+		t.Error("a reused intermediate changed the result")
+	}
+
+	// the sizes differ so that buffers are taken at several lengths.
+	wants := make([]*image.RGBA, 16)
+	for i := range wants {
+		wants[i] = image.NewRGBA(image.Rect(0, 0, 23, 17))
+		if err := RGBA(ctx, wants[i], src.SubImage(image.Rect(0, 0, 64-i, 48)).(*image.RGBA)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range wants {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got := image.NewRGBA(image.Rect(0, 0, 23, 17))
+			if err := RGBA(ctx, got, src.SubImage(image.Rect(0, 0, 64-i, 48)).(*image.RGBA)); err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(wants[i].Pix, got.Pix) {
+				t.Errorf("%d: concurrent calls gave different results", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
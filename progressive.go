@@ -0,0 +1,162 @@
+package downscale
+
+import (
+	"context"
+	"encoding/binary"
+	"image"
+)
+
+// RGBAProgressive halves src with a 2x2 box until it is less than four times
+// the size of dest, then finishes with the exact pass of RGBA. It is faster
+// than RGBA for large ratios, at the cost of small rounding differences.
+// Steps from an odd size are done by RGBA to keep the weights exact.
+func RGBAProgressive(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaProgressive(ctx, dest, src, opts)
+	})
+}
+
+func rgbaProgressive(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+
+	o := newOptions(opts)
+	for dw > 0 && dh > 0 && sw >= dw<<2 && sh >= dh<<2 {
+		half := image.NewRGBA(image.Rect(0, 0, sw>>1, sh>>1))
+		var err error
+		if (sw|sh)&1 == 0 {
+			err = halve8RGBA(ctx, half, src, o)
+		} else {
+			// odd sizes keep the exact weights so that the steps stay
+			// aligned with the source.
+			err = RGBA(ctx, half, src, opts...)
+		}
+		if err != nil {
+			return err
+		}
+		src, sw, sh = half, half.Rect.Dx(), half.Rect.Dy()
+	}
+	return RGBA(ctx, dest, src, opts...)
+}
+
+// RGBAMipmaps returns the mipmap chain of src: each level is half the size of
+// the previous one, rounded down and at least 1, ending with a 1x1 level.
+// levels[0] is the first level below src. Each level is made from the
+// previous one, so the whole chain costs about the size of src once.
+func RGBAMipmaps(ctx context.Context, src *image.RGBA, opts ...Option) ([]*image.RGBA, error) {
+	// the chain is reported as one call writing all of its levels.
+	var dstPixels int
+	for w, h := src.Rect.Dx(), src.Rect.Dy(); w > 1 || h > 1; {
+		w, h = w>>1, h>>1
+		if w == 0 {
+			w = 1
+		}
+		if h == 0 {
+			h = 1
+		}
+		dstPixels += w * h
+	}
+	var levels []*image.RGBA
+	err := meteredPixels(ctx, opts, src.Rect.Dx()*src.Rect.Dy(), dstPixels, func(ctx context.Context) error {
+		var err error
+		levels, err = rgbaMipmaps(ctx, src, opts)
+		return err
+	})
+	return levels, err
+}
+
+func rgbaMipmaps(ctx context.Context, src *image.RGBA, opts []Option) ([]*image.RGBA, error) {
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return nil, err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw <= 0 || sh <= 0 {
+		return nil, ErrInvalidSize
+	}
+	o := newOptions(opts)
+	var levels []*image.RGBA
+	for sw > 1 || sh > 1 {
+		dw, dh := sw>>1, sh>>1
+		if dw == 0 {
+			dw = 1
+		}
+		if dh == 0 {
+			dh = 1
+		}
+		level := image.NewRGBA(image.Rect(0, 0, dw, dh))
+		var err error
+		if dw<<1 == sw && dh<<1 == sh {
+			err = halve8RGBA(ctx, level, src, o)
+		} else {
+			err = RGBA(ctx, level, src, opts...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+		src, sw, sh = level, dw, dh
+	}
+	return levels, nil
+}
+
+// halve8RGBA averages each 2x2 block of src into dest, which must be exactly
+// half the size of src.
+func halve8RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	dw, dh := uint32(dest.Rect.Dx()), uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery()}
+	h.wg.Add(n)
+	step := dh / uint32(n)
+	y := uint32(0)
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			halve8RGBAInner(h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, dw)
+		})
+		y += step
+	}
+	spawn(func() {
+		halve8RGBAInner(h, y, dh, dest.Pix, src.Pix, ds, ss, dw)
+	})
+	return h.Wait(ctx)
+}
+
+func halve8RGBAInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dw uint32) {
+	defer h.Done()
+	// premultiplied colors average directly. Two source pixels are loaded at
+	// once and their even and odd bytes are summed in 16-bit lanes.
+	const m = 0x00ff00ff00ff00ff
+	dwx4 := dw << 2
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		si := y << 1 * ss
+		r0, r1 := s[si:si+dwx4<<1], s[si+ss:si+ss+dwx4<<1]
+		row := d[y*ds : y*ds+dwx4]
+		for x := uint32(0); x < dwx4; x += 4 {
+			u0, u1 := binary.LittleEndian.Uint64(r0[x<<1:]), binary.LittleEndian.Uint64(r1[x<<1:])
+			e, o := u0&m+u1&m, u0>>8&m+u1>>8&m
+			e, o = (e+e>>32+0x00020002)>>2&0x00ff00ff, (o+o>>32+0x00020002)>>2&0x00ff00ff
+			binary.LittleEndian.PutUint32(row[x:], uint32(e|o<<8))
+		}
+	}
+}
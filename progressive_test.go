@@ -0,0 +1,107 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestRGBAProgressive(t *testing.T) {
+	ctx := context.Background()
+	for _, sz := range []struct{ sw, sh, dw, dh int }{
+		{800, 600, 50, 37},
+		{801, 599, 50, 37},
+		{640, 480, 200, 150},
+		{64, 48, 63, 47},
+	} {
+		src := image.NewRGBA(image.Rect(0, 0, sz.sw, sz.sh))
+		draw.Draw(src, src.Rect, testPattern(sz.sw, sz.sh), image.Point{}, draw.Src)
+		want := image.NewRGBA(image.Rect(0, 0, sz.dw, sz.dh))
+		if err := RGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		if err := RGBAProgressive(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		max := 0
+		for i := range want.Pix {
+			d := int(want.Pix[i]) - int(got.Pix[i])
+			if d < 0 {
+				d = -d
+			}
+			if d > max {
+				max = d
+			}
+		}
+		// odd-sized steps go through RGBA and add its rounding each time.
+		if max > 8 {
+			t.Errorf("%v: want a difference of at most 8, got %d", sz, max)
+		}
+	}
+}
+
+func TestHalve8RGBA(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	if err := halve8RGBA(context.Background(), dest, src, newOptions(nil)); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{
+		((0+4+16+20)*7 + 2) / 4, ((8+12+24+28)*7 + 2) / 4,
+	} {
+		if got := int(dest.Pix[i<<2]); got != want {
+			t.Errorf("pixel %d: want %d, got %d", i, want, got)
+		}
+	}
+}
+
+func TestRGBAMipmaps(t *testing.T) {
+	ctx := context.Background()
+	for _, sz := range []struct{ w, h, n int }{
+		{64, 48, 6},
+		{101, 37, 6},
+		{1, 9, 3},
+		{2, 2, 1},
+		{1, 1, 0},
+	} {
+		src := image.NewRGBA(image.Rect(0, 0, sz.w, sz.h))
+		draw.Draw(src, src.Rect, testPattern(sz.w, sz.h), image.Point{}, draw.Src)
+		levels, err := RGBAMipmaps(ctx, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(levels) != sz.n {
+			t.Fatalf("%dx%d: want %d levels, got %d", sz.w, sz.h, sz.n, len(levels))
+		}
+		w, h := sz.w, sz.h
+		for i, level := range levels {
+			if w >>= 1; w == 0 {
+				w = 1
+			}
+			if h >>= 1; h == 0 {
+				h = 1
+			}
+			if got := level.Rect.Size(); got != image.Pt(w, h) {
+				t.Errorf("%dx%d: level %d: want %dx%d, got %v", sz.w, sz.h, i, w, h, got)
+			}
+		}
+	}
+
+	// a uniform image stays uniform at every level.
+	src := image.NewRGBA(image.Rect(0, 0, 37, 20))
+	draw.Draw(src, src.Rect, image.NewUniform(color.RGBA{10, 20, 30, 255}), image.Point{}, draw.Src)
+	levels, err := RGBAMipmaps(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := levels[len(levels)-1]
+	if got := last.RGBAAt(0, 0); got != (color.RGBA{10, 20, 30, 255}) {
+		t.Errorf("want {10 20 30 255}, got %v", got)
+	}
+}
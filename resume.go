@@ -0,0 +1,113 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+// resumeBand is the number of rows of the horizontal pass, or columns of the
+// vertical pass, that RGBAResume completes between checks for cancellation.
+// At most one band is computed again after a resume.
+const resumeBand = 64
+
+// ResumeToken holds the progress of an RGBAResume call that was cancelled.
+// The zero value starts a new downscale.
+type ResumeToken struct {
+	sw, sh, dw, dh int
+	tmp            *image.RGBA
+	rows           int // rows of the horizontal pass that are done
+	cols           int // columns of the vertical pass that are done
+}
+
+// Reset makes t start a new downscale.
+func (t *ResumeToken) Reset() {
+	*t = ResumeToken{}
+}
+
+// RGBAResume is RGBA that can continue where a cancelled call stopped. When
+// ctx is cancelled it returns ErrAborted and records the finished work in t;
+// calling it again with t, the same src and the same dest completes the
+// downscale. t is reset once the downscale is complete. A t made for other
+// sizes is reset before use.
+func RGBAResume(ctx context.Context, dest *image.RGBA, src *image.RGBA, t *ResumeToken, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaResume(ctx, dest, src, t, opts)
+	})
+}
+
+func rgbaResume(ctx context.Context, dest *image.RGBA, src *image.RGBA, t *ResumeToken, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		copyRGBA(dest, src, false)
+		t.Reset()
+		return nil
+	}
+	if t.sw != sw || t.sh != sh || t.dw != dw || t.dh != dh {
+		*t = ResumeToken{sw: sw, sh: sh, dw: dw, dh: dh}
+	}
+
+	o := newOptions(opts)
+	// the horizontal pass writes dest directly when the height is kept, and
+	// the vertical pass reads src directly when the width is kept.
+	hdest, vsrc := dest, src
+	if sw != dw && sh != dh {
+		if t.tmp == nil {
+			t.tmp = image.NewRGBA(image.Rect(0, 0, dw, sh))
+		}
+		hdest, vsrc = t.tmp, t.tmp
+	}
+	if sw != dw {
+		horz := NewWeightTable(uint32(sw), uint32(dw))
+		for t.rows < sh {
+			if ctx.Err() != nil {
+				return ErrAborted
+			}
+			y1 := t.rows + resumeBand
+			if y1 > sh {
+				y1 = sh
+			}
+			d := hdest.SubImage(image.Rect(hdest.Rect.Min.X, hdest.Rect.Min.Y+t.rows, hdest.Rect.Max.X, hdest.Rect.Min.Y+y1)).(*image.RGBA)
+			s := src.SubImage(image.Rect(src.Rect.Min.X, src.Rect.Min.Y+t.rows, src.Rect.Max.X, src.Rect.Min.Y+y1)).(*image.RGBA)
+			if err := horz8RGBATable(ctx, d, s, horz, false, o); err != nil {
+				return err
+			}
+			t.rows = y1
+		}
+	}
+	if sh != dh {
+		vert := NewWeightTable(uint32(sh), uint32(dh))
+		for t.cols < dw {
+			if ctx.Err() != nil {
+				return ErrAborted
+			}
+			x1 := t.cols + resumeBand
+			if x1 > dw {
+				x1 = dw
+			}
+			d := dest.SubImage(image.Rect(dest.Rect.Min.X+t.cols, dest.Rect.Min.Y, dest.Rect.Min.X+x1, dest.Rect.Max.Y)).(*image.RGBA)
+			s := vsrc.SubImage(image.Rect(vsrc.Rect.Min.X+t.cols, vsrc.Rect.Min.Y, vsrc.Rect.Min.X+x1, vsrc.Rect.Max.Y)).(*image.RGBA)
+			if err := vert8RGBATable(ctx, d, s, vert, false, false, o); err != nil {
+				return err
+			}
+			t.cols = x1
+		}
+	}
+	t.Reset()
+	return nil
+}
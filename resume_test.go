@@ -0,0 +1,65 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"sync"
+	"testing"
+)
+
+// countdownCtx is cancelled once Err has been asked n times.
+type countdownCtx struct {
+	context.Context
+	n    int
+	once sync.Once
+	done chan struct{}
+}
+
+func newCountdownCtx(n int) *countdownCtx {
+	return &countdownCtx{Context: context.Background(), n: n, done: make(chan struct{})}
+}
+
+func (c *countdownCtx) Done() <-chan struct{} { return c.done }
+
+func (c *countdownCtx) Err() error {
+	if c.n--; c.n < 0 {
+		c.once.Do(func() { close(c.done) })
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestRGBAResume(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 260))
+	draw.Draw(src, src.Rect, testPattern(300, 260), image.Point{}, draw.Src)
+	for _, sz := range []image.Point{{70, 50}, {300, 50}, {70, 260}} {
+		want := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(context.Background(), want, src); err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < 8; n++ {
+			got := image.NewRGBA(want.Rect)
+			var tok ResumeToken
+			err := RGBAResume(newCountdownCtx(n), got, src, &tok)
+			if err == nil {
+				if tok != (ResumeToken{}) {
+					t.Errorf("%v %d: want the token reset once done", sz, n)
+				}
+			} else if err != ErrAborted {
+				t.Fatal(err)
+			} else {
+				if tok.rows+tok.cols == 0 && n > 0 {
+					t.Errorf("%v %d: want some progress recorded", sz, n)
+				}
+				if err := RGBAResume(context.Background(), got, src, &tok); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(want.Pix, got.Pix) {
+				t.Errorf("%v %d: the resumed result differs from RGBA", sz, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+func RGBA64(ctx context.Context, dest *image.RGBA64, src *image.RGBA64, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgba64(ctx, dest, src, opts)
+	})
+}
+
+func rgba64(ctx context.Context, dest *image.RGBA64, src *image.RGBA64, opts []Option) error {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<3], src.Pix[y*src.Stride:y*src.Stride+sw<<3])
+		}
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			if sw != dw {
+				tmp := image.NewRGBA64(image.Rect(0, 0, dw, sh))
+				h.pass(horzRGBA64(ctx, tmp, src, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vertRGBA64(ctx, dest, tmp, o))
+			} else {
+				h.pass(vertRGBA64(ctx, dest, src, o))
+			}
+		} else {
+			h.pass(horzRGBA64(ctx, dest, src, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+func horzRGBA64(ctx context.Context, dest *image.RGBA64, src *image.RGBA64, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sw, dw)
+	if err != nil {
+		return err
+	}
+	dh := uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := dh / uint32(n)
+	y := uint32(0)
+	for i := 1; i < n; i++ {
+		yMin := y
+		spawn(func() {
+			horzRGBA64Inner(h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dw, tt, ft)
+		})
+		y += step
+	}
+	spawn(func() {
+		horzRGBA64Inner(h, y, dh, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dw, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func vertRGBA64(ctx context.Context, dest *image.RGBA64, src *image.RGBA64, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dx() {
+		n--
+	}
+
+	dw := uint32(dest.Rect.Dx())
+	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sh, dh)
+	if err != nil {
+		return err
+	}
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	h.wg.Add(n)
+	step := (dw / uint32(n)) << 3
+	x := uint32(0)
+	for i := 1; i < n; i++ {
+		xMin := x
+		spawn(func() {
+			vertRGBA64Inner(h, xMin, xMin+step, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dh, tt, ft)
+		})
+		x += step
+	}
+	spawn(func() {
+		vertRGBA64Inner(h, x, dw<<3, dest.Pix, src.Pix, ds, ss, uint64(dlcmlen), uint64(slcmlen), dh, tt, ft)
+	})
+	return h.Wait(ctx)
+}
+
+func horzRGBA64Inner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint64, slcmlen uint64, dw uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return
+		}
+		di := y * ds
+		si := y * ss
+		var f diffuser
+		for x, fr := uint32(0), uint64(0); x < dw; x++ {
+			tl, tr := tt[x], tt[x+1]
+			fl := slcmlen - fr
+			fr = uint64(ft[x])
+			var a, r, g, b uint64
+			if fl != 0 {
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * fl
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * fl
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * fl
+				a += (uint64(s[si+6])<<8 | uint64(s[si+7])) * fl
+				si += 8
+			}
+			for i := tl + 1; i < tr; i++ {
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * slcmlen
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * slcmlen
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * slcmlen
+				a += (uint64(s[si+6])<<8 | uint64(s[si+7])) * slcmlen
+				si += 8
+			}
+			if fr != 0 {
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * fr
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * fr
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * fr
+				a += (uint64(s[si+6])<<8 | uint64(s[si+7])) * fr
+			}
+			putRGBA64(d[di:di+8], r, g, b, a, dlcmlen, h.round(), &f)
+			di += 8
+		}
+	}
+}
+
+func vertRGBA64Inner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint64, slcmlen uint64, dh uint32, tt []uint32, ft []uint32) {
+	defer h.Done()
+	for x := xMin; x < xMax; x += 8 {
+		if h.abortedAt(x >> 3) {
+			return
+		}
+		di, si := x, x
+		var f diffuser
+		for y, fr := uint32(0), uint64(0); y < dh; y++ {
+			tl, tr := tt[y], tt[y+1]
+			fl := slcmlen - fr
+			fr = uint64(ft[y])
+			var a, r, g, b uint64
+			if fl != 0 {
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * fl
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * fl
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * fl
+				a += (uint64(s[si+6])<<8 | uint64(s[si+7])) * fl
+				si += ss
+			}
+			for i := tl + 1; i < tr; i++ {
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * slcmlen
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * slcmlen
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * slcmlen
+				a += (uint64(s[si+6])<<8 | uint64(s[si+7])) * slcmlen
+				si += ss
+			}
+			if fr != 0 {
+				r += (uint64(s[si+0])<<8 | uint64(s[si+1])) * fr
+				g += (uint64(s[si+2])<<8 | uint64(s[si+3])) * fr
+				b += (uint64(s[si+4])<<8 | uint64(s[si+5])) * fr
+				a += (uint64(s[si+6])<<8 | uint64(s[si+7])) * fr
+			}
+			putRGBA64(d[di:di+8], r, g, b, a, dlcmlen, h.round(), &f)
+			di += ds
+		}
+	}
+}
+
+// putRGBA64 writes the premultiplied average directly. Weighting each
+// sample by its alpha after un-premultiplying, as RGBA does, yields the
+// same sums, so there is no need to round-trip through straight color.
+func putRGBA64(d []byte, r uint64, g uint64, b uint64, a uint64, dlcmlen uint64, rnd Rounding, f *diffuser) {
+	if rnd == RoundDiffuse {
+		a = f.next(3, a, dlcmlen)
+		r, g, b = f.nextMax(0, r, dlcmlen, a), f.nextMax(1, g, dlcmlen, a), f.nextMax(2, b, dlcmlen, a)
+	} else {
+		bias := rnd.or(RoundNearest).bias(dlcmlen)
+		r, g, b, a = (r+bias)/dlcmlen, (g+bias)/dlcmlen, (b+bias)/dlcmlen, (a+bias)/dlcmlen
+	}
+	d[0], d[1] = uint8(r>>8), uint8(r)
+	d[2], d[3] = uint8(g>>8), uint8(g)
+	d[4], d[5] = uint8(b>>8), uint8(b)
+	d[6], d[7] = uint8(a>>8), uint8(a)
+}
@@ -0,0 +1,75 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNRGBA64(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 4096, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4096; x++ {
+			v := uint16(x * 16)
+			src.SetNRGBA64(x, y, color.NRGBA64{R: v, G: v, B: 65535 - v, A: 65535})
+		}
+	}
+	dest := image.NewNRGBA64(image.Rect(0, 0, 1000, 2))
+	if err := NRGBA64(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	levels := map[uint16]struct{}{}
+	for x := 0; x < 1000; x++ {
+		c := dest.NRGBA64At(x, 1)
+		if c.A != 65535 {
+			t.Fatalf("x=%d: want alpha 65535, got %d", x, c.A)
+		}
+		if c.R != c.G {
+			t.Errorf("x=%d: R %d != G %d", x, c.R, c.G)
+		}
+		levels[c.R] = struct{}{}
+	}
+	if len(levels) <= 256 {
+		t.Errorf("want more than 256 distinct levels, got %d", len(levels))
+	}
+}
+
+func TestNRGBA64Overflow(t *testing.T) {
+	// a long run of opaque white drives the sums towards their maximum,
+	// and a destination length coprime to the source maximizes dlcmlen.
+	const l = 1 << 21
+	for _, r := range []image.Rectangle{image.Rect(0, 0, l, 1), image.Rect(0, 0, 1, l)} {
+		src := image.NewNRGBA64(r)
+		for i := range src.Pix {
+			src.Pix[i] = 0xff
+		}
+		dest := image.NewNRGBA64(image.Rect(0, 0, 3, 1))
+		if r.Dy() > 1 {
+			dest = image.NewNRGBA64(image.Rect(0, 0, 1, 3))
+		}
+		if err := NRGBA64(context.Background(), dest, src); err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range dest.Pix {
+			if v != 0xff {
+				t.Fatalf("%v: Pix[%d] = %#x, want 0xff", r, i, v)
+			}
+		}
+	}
+}
+
+func TestRGBA64(t *testing.T) {
+	src := image.NewRGBA64(image.Rect(0, 0, 3, 1))
+	src.SetRGBA64(0, 0, color.RGBA64{R: 60000, A: 60000})
+	src.SetRGBA64(1, 0, color.RGBA64{R: 1000, G: 1000, A: 2000})
+	src.SetRGBA64(2, 0, color.RGBA64{})
+	dest := image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	if err := RGBA64(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	want := color.RGBA64{R: 20333, G: 333, A: 20667}
+	if got := dest.RGBA64At(0, 0); got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -6,204 +6,608 @@ import (
 	"context"
 	"errors"
 	"image"
-	"runtime"
 )
 
-func RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA) error {
+func RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgba8(ctx, dest, src, false, opts)
+	})
+}
+
+// RGBAFlipV is RGBA that also flips the image vertically, writing the rows
+// of dest bottom-up as OpenGL textures expect. The flip is done by the
+// vertical pass, so it costs nothing over RGBA in most cases.
+func RGBAFlipV(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgba8(ctx, dest, src, true, opts)
+	})
+}
+
+func rgba8(ctx context.Context, dest *image.RGBA, src *image.RGBA, flip bool, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	// with a single pass, dest would be written while an aliased src is still
+	// being read. Two passes read all of src before dest is touched.
+	if (sw == dw || sh == dh) && overlaps(dest.Pix, src.Pix) {
+		c := getTmpRGBA(sw, sh)
+		defer putTmpRGBA(c)
+		copyRGBA(c, src, false)
+		src = c
+	}
+	o := newOptions(opts)
+	if IsCopy(src.Rect, dest.Rect) && !o.forceFilter {
+		copyRGBA(dest, src, flip)
+		return nil
+	}
+	var h handle
+	h.wg.Add(1)
+	go func() {
+		defer h.Done()
+		horz := horz8RGBA
+		vert := func(ctx context.Context, dest *image.RGBA, src *image.RGBA, o *options) error {
+			return vert8RGBATable(ctx, dest, src, NewWeightTable(uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())), false, flip, o)
+		}
+		// an opaque source gives the same result without the alpha weighting.
+		if isOpaque8(src.Pix, src.Stride, sw, sh) {
+			horz = func(ctx context.Context, dest *image.RGBA, src *image.RGBA, o *options) error {
+				return horzOpaque8RGBA(ctx, dest, src, false, false, o)
+			}
+			vert = func(ctx context.Context, dest *image.RGBA, src *image.RGBA, o *options) error {
+				return vertOpaque8RGBA(ctx, dest, src, false, flip, false, o)
+			}
+		}
+		if sh != dh {
+			if sw != dw && o.vertFirst && sw*dh < dw*sh {
+				tmp := getTmpRGBA(sw, dh)
+				defer putTmpRGBA(tmp)
+				h.pass(vert(ctx, tmp, src, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(horz(ctx, dest, tmp, o))
+			} else if sw != dw {
+				tmp := getTmpRGBA(dw, sh)
+				defer putTmpRGBA(tmp)
+				h.pass(horz(ctx, tmp, src, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vert(ctx, dest, tmp, o))
+			} else {
+				h.pass(vert(ctx, dest, src, o))
+			}
+		} else if flip {
+			// there is no vertical pass to do the flip.
+			tmp := getTmpRGBA(dw, dh)
+			defer putTmpRGBA(tmp)
+			h.pass(horz(ctx, tmp, src, o))
+			if h.Aborted() {
+				return
+			}
+			copyRGBA(dest, tmp, true)
+		} else {
+			h.pass(horz(ctx, dest, src, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// RGBARaw is RGBA for tightly packed premultiplied RGBA pixel buffers, where
+// a dw x dh image is dw*4 bytes per row in dPix, and likewise for sPix.
+func RGBARaw(ctx context.Context, dPix []byte, dw int, dh int, sPix []byte, sw int, sh int, opts ...Option) error {
+	if dw < 0 || dh < 0 || sw < 0 || sh < 0 {
+		return ErrInvalidSize
+	}
+	return RGBA(
+		ctx,
+		&image.RGBA{Pix: dPix, Stride: dw << 2, Rect: image.Rect(0, 0, dw, dh)},
+		&image.RGBA{Pix: sPix, Stride: sw << 2, Rect: image.Rect(0, 0, sw, sh)},
+		opts...,
+	)
+}
+
+// RGBAInto downscales src to the size of dr and writes it into that
+// rectangle of dest, leaving the rest of dest untouched. dr must lie within
+// dest.Rect.
+func RGBAInto(ctx context.Context, dest *image.RGBA, dr image.Rectangle, src *image.RGBA, opts ...Option) error {
+	if !dr.In(dest.Rect) {
+		return errors.New("downscale: dr is outside of dest.Rect")
+	}
+	return RGBA(ctx, dest.SubImage(dr).(*image.RGBA), src, opts...)
+}
+
+// RGBAToNRGBA downscales like RGBA and writes the result with straight alpha
+// into dest.
+func RGBAToNRGBA(ctx context.Context, dest *image.NRGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaToNRGBA(ctx, dest, src, opts)
+	})
+}
+
+func rgbaToNRGBA(ctx context.Context, dest *image.NRGBA, src *image.RGBA, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			s, d := src.Pix[y*src.Stride:y*src.Stride+sw<<2], dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2]
+			for i := 0; i < len(d); i += 4 {
+				a := uint32(s[i+3])
+				d[i+0] = uint8(divTable[(uint32(s[i+0])<<8)+a])
+				d[i+1] = uint8(divTable[(uint32(s[i+1])<<8)+a])
+				d[i+2] = uint8(divTable[(uint32(s[i+2])<<8)+a])
+				d[i+3] = s[i+3]
+			}
+		}
+		return nil
+	}
+	// the last pass writes dest through an RGBA view of the same pixels.
+	d := &image.RGBA{Pix: dest.Pix, Stride: dest.Stride, Rect: dest.Rect}
+	var h handle
+	h.wg.Add(1)
+	o := newOptions(opts)
+	go func() {
+		defer h.Done()
+		if sh != dh {
+			vert := NewWeightTable(uint32(sh), uint32(dh))
+			if sw != dw {
+				tmp := getTmpRGBA(dw, sh)
+				defer putTmpRGBA(tmp)
+				h.pass(horz8RGBA(ctx, tmp, src, o))
+				if h.Aborted() {
+					return
+				}
+				h.pass(vert8RGBATable(ctx, d, tmp, vert, true, false, o))
+			} else {
+				h.pass(vert8RGBATable(ctx, d, src, vert, true, false, o))
+			}
+		} else {
+			h.pass(horz8RGBATable(ctx, d, src, NewWeightTable(uint32(sw), uint32(dw)), true, o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// RGBAToNRGBADirect is RGBAToNRGBA, for callers that look for the fused
+// form: the box filter runs in premultiplied space and only the final write
+// into dest un-premultiplies, so there is no conversion pass over the result.
+func RGBAToNRGBADirect(ctx context.Context, dest *image.NRGBA, src *image.RGBA, opts ...Option) error {
+	return RGBAToNRGBA(ctx, dest, src, opts...)
+}
+
+// RGBAHorizontal scales only the width of src into dest, which must have the
+// same height as src.
+func RGBAHorizontal(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaHorizontal(ctx, dest, src, opts)
+	})
+}
+
+func rgbaHorizontal(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts []Option) error {
+	if err := checkAxis(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect, dest.Rect.Dy() == src.Rect.Dy()); err != nil {
+		return err
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		copyRGBA(dest, src, false)
+		return nil
+	}
+	return horz8RGBA(ctx, dest, src, newOptions(opts))
+}
+
+// RGBAVertical scales only the height of src into dest, which must have the
+// same width as src.
+func RGBAVertical(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaVertical(ctx, dest, src, opts)
+	})
+}
+
+func rgbaVertical(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts []Option) error {
+	if err := checkAxis(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect, dest.Rect.Dx() == src.Rect.Dx()); err != nil {
+		return err
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		copyRGBA(dest, src, false)
+		return nil
+	}
+	return vert8RGBA(ctx, dest, src, newOptions(opts))
+}
+
+// copyRGBA copies src into the same sized dest, in reverse row order if flip
+// is set.
+func copyRGBA(dest *image.RGBA, src *image.RGBA, flip bool) {
+	w, h := src.Rect.Dx()<<2, src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		dy := y
+		if flip {
+			dy = h - 1 - y
+		}
+		copy(dest.Pix[dy*dest.Stride:dy*dest.Stride+w], src.Pix[y*src.Stride:y*src.Stride+w])
+	}
+}
+
+// checkAxis validates a single-axis scale of the 4 bytes per pixel src into
+// dest. same reports whether the unscaled direction matches.
+func checkAxis(dPix []byte, dStride int, dr image.Rectangle, sPix []byte, sStride int, sr image.Rectangle, same bool) error {
+	if err := checkPix("dest", dPix, dStride, dr, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", sPix, sStride, sr, 4); err != nil {
+		return err
+	}
+	if !same {
+		return errors.New("downscale: dest and src differ in the unscaled direction")
+	}
+	sw, sh := sr.Dx(), sr.Dy()
+	dw, dh := dr.Dx(), dr.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// RGBAWithTables is RGBA with weight tables built in advance by
+// NewWeightTable, so that callers scaling many images of the same size do
+// not rebuild them. horz and vert may be nil when the width or the height is
+// left unchanged.
+func RGBAWithTables(ctx context.Context, dest *image.RGBA, src *image.RGBA, horz *WeightTable, vert *WeightTable, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaWithTables(ctx, dest, src, horz, vert, opts)
+	})
+}
+
+func rgbaWithTables(ctx context.Context, dest *image.RGBA, src *image.RGBA, horz *WeightTable, vert *WeightTable, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
 	sw, sh := src.Rect.Dx(), src.Rect.Dy()
 	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
 	if sw < dw || sh < dh {
-		return errors.New("upscale is not supported")
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
 	}
-	if sw == dw && sh == dh {
-		copy(dest.Pix, src.Pix)
+	if !horz.fits(sw, dw) || !vert.fits(sh, dh) {
+		return errors.New("downscale: weight tables do not match the image sizes")
+	}
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
 		return nil
 	}
 	var h handle
 	h.wg.Add(1)
+	o := newOptions(opts)
 	go func() {
 		defer h.Done()
 		if sh != dh {
 			if sw != dw {
 				tmp := image.NewRGBA(image.Rect(0, 0, dw, sh))
-				horz8RGBA(ctx, tmp, src)
+				h.pass(horz8RGBATable(ctx, tmp, src, horz, false, o))
 				if h.Aborted() {
 					return
 				}
-				vert8RGBA(ctx, dest, tmp)
+				h.pass(vert8RGBATable(ctx, dest, tmp, vert, false, false, o))
 			} else {
-				vert8RGBA(ctx, dest, src)
+				h.pass(vert8RGBATable(ctx, dest, src, vert, false, false, o))
 			}
 		} else {
-			horz8RGBA(ctx, dest, src)
+			h.pass(horz8RGBATable(ctx, dest, src, horz, false, o))
 		}
 	}()
 	return h.Wait(ctx)
 }
 
-func horz8RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA) error {
-	n := runtime.GOMAXPROCS(0)
+func horz8RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA, o *options) error {
+	return horz8RGBATable(ctx, dest, src, NewWeightTable(uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())), false, o)
+}
+
+func horz8RGBATable(ctx context.Context, dest *image.RGBA, src *image.RGBA, t *WeightTable, straight bool, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
 	for n > 1 && n<<1 > dest.Rect.Dy() {
 		n--
 	}
 
-	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
-	lcmlen := lcm(sw, dw)
-	slcmlen, dlcmlen := lcmlen/sw, lcmlen/dw
-	tt, ft := makeTable(dw, dlcmlen, slcmlen)
+	dw := uint32(dest.Rect.Dx())
+	slcmlen, dlcmlen, tt, ft := t.slcmlen, t.dlcmlen, t.tt, t.ft
 	dh := uint32(dest.Rect.Dy())
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
 
-	var h handle
+	h := handle{every: o.abortEvery(), rounding: o.rounding}
 	h.wg.Add(n)
 	step := dh / uint32(n)
 	y := uint32(0)
 	for i := 1; i < n; i++ {
-		go horz8RGBAInner(&h, y, y+step, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, sw, tt, ft)
+		yMin := y
+		spawn(func() {
+			horz8RGBAInner(&h, yMin, yMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft, straight)
+		})
 		y += step
 	}
-	go horz8RGBAInner(&h, y, dh, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, sw, tt, ft)
+	spawn(func() {
+		horz8RGBAInner(&h, y, dh, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dw, tt, ft, straight)
+	})
 	return h.Wait(ctx)
 }
 
-func vert8RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA) error {
-	n := runtime.GOMAXPROCS(0)
+func vert8RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA, o *options) error {
+	return vert8RGBATable(ctx, dest, src, NewWeightTable(uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())), false, false, o)
+}
+
+func vert8RGBATable(ctx context.Context, dest *image.RGBA, src *image.RGBA, t *WeightTable, straight bool, flip bool, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
 	for n > 1 && n<<1 > dest.Rect.Dx() {
 		n--
 	}
 
-	sw, dw := uint32(src.Rect.Dx()), uint32(dest.Rect.Dx())
-	sh, dh := uint32(src.Rect.Dy()), uint32(dest.Rect.Dy())
-	lcmlen := lcm(sh, dh)
-	slcmlen, dlcmlen := lcmlen/sh, lcmlen/dh
-	tt, ft := makeTable(dh, dlcmlen, slcmlen)
+	dw, dh := uint32(dest.Rect.Dx()), uint32(dest.Rect.Dy())
+	slcmlen, dlcmlen, tt, ft := t.slcmlen, t.dlcmlen, t.tt, t.ft
+	ds, ss := uint32(dest.Stride), uint32(src.Stride)
 
-	h := &handle{}
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
 	h.wg.Add(n)
 	step := (dw / uint32(n)) << 2
 	x := uint32(0)
 	for i := 1; i < n; i++ {
-		go vert8RGBAInner(h, x, x+step, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, dh, sw, tt, ft)
+		xMin := x
+		spawn(func() {
+			vert8RGBAInner(h, xMin, xMin+step, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft, straight, flip)
+		})
 		x += step
 	}
-	go vert8RGBAInner(h, x, dw<<2, dest.Pix, src.Pix, dlcmlen, slcmlen, dw, dh, sw, tt, ft)
+	spawn(func() {
+		vert8RGBAInner(h, x, dw<<2, dest.Pix, src.Pix, ds, ss, dlcmlen, slcmlen, dh, tt, ft, straight, flip)
+	})
 	return h.Wait(ctx)
 }
 
-func horz8RGBAInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, dlcmlen uint32, slcmlen uint32, dw uint32, sw uint32, tt []uint32, ft []uint32) {
+func horz8RGBAInner(h *handle, yMin uint32, yMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dw uint32, tt []uint32, ft []uint32, straight bool) {
 	defer h.Done()
-	swx4, dwx4 := sw<<2, dw<<2
+	// tt[dw] is the source width. Each row is first expanded into the
+	// alpha-weighted straight colors so that the taps only multiply.
+	swx4, dwx4 := tt[dw]<<2, dw<<2
+	buf := make([]uint32, swx4)
+	acc := make([]uint32, dwx4)
 	for y := yMin; y < yMax; y++ {
-		if y&7 == 7 && h.Aborted() {
+		if h.abortedAt(y) {
 			return
 		}
-		di := y * dwx4
-		si := y * swx4
-		for x, fr := uint32(0), uint32(0); x < dw; x++ {
-			tl, tr := tt[x], tt[x+1]
-			fl := slcmlen - fr
-			fr = ft[x]
-			var ta, a, r, g, b, w uint32
-			if fl != 0 {
-				ta = uint32(s[si+3])
-				if ta > 0 {
-					w = ta * fl
-					r += uint32(divTable[(uint32(s[si+0])<<8)+ta]) * w
-					g += uint32(divTable[(uint32(s[si+1])<<8)+ta]) * w
-					b += uint32(divTable[(uint32(s[si+2])<<8)+ta]) * w
-					a += w
-				}
-				si += 4
-			}
-			for i := tl + 1; i < tr; i++ {
-				ta = uint32(s[si+3])
-				if ta > 0 {
-					w = ta * slcmlen
-					r += uint32(divTable[(uint32(s[si+0])<<8)+ta]) * w
-					g += uint32(divTable[(uint32(s[si+1])<<8)+ta]) * w
-					b += uint32(divTable[(uint32(s[si+2])<<8)+ta]) * w
-					a += w
-				}
-				si += 4
-			}
-			if fr != 0 && s[si+3] > 0 {
-				ta = uint32(s[si+3])
-				w = ta * fr
-				r += uint32(divTable[(uint32(s[si+0])<<8)+ta]) * w
-				g += uint32(divTable[(uint32(s[si+1])<<8)+ta]) * w
-				b += uint32(divTable[(uint32(s[si+2])<<8)+ta]) * w
-				a += w
-			}
-			if a == 0 {
-				d[di+0] = 0
-				d[di+1] = 0
-				d[di+2] = 0
-				d[di+3] = 0
-			} else {
-				d[di+0] = uint8((r / dlcmlen * 32897) >> 23)
-				d[di+1] = uint8((g / dlcmlen * 32897) >> 23)
-				d[di+2] = uint8((b / dlcmlen * 32897) >> 23)
-				d[di+3] = uint8(a / dlcmlen)
+		si := y * ss
+		// the AVX2 accumulate8RGBA is as fast as expandOpaque8RGBA, so opaque
+		// rows are only told apart for the generic one.
+		if row := s[si : si+swx4]; !useAVX2 && isOpaque8(row, 0, int(tt[dw]), 1) {
+			expandOpaque8RGBA(buf, row)
+		} else {
+			for i := range buf {
+				buf[i] = 0
 			}
-			di += 4
+			accumulate8RGBA(buf, row, 1)
+		}
+		horzTaps8RGBA(acc, buf, tt, ft, slcmlen)
+		di := y * ds
+		if straight {
+			store8NRGBA(d[di:di+dwx4], acc, dlcmlen, h.round())
+		} else {
+			store8RGBA(d[di:di+dwx4], acc, dlcmlen, h.round())
 		}
 	}
 }
 
-func vert8RGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, dlcmlen uint32, slcmlen uint32, dw uint32, dh uint32, sw uint32, tt []uint32, ft []uint32) {
+func vert8RGBAInner(h *handle, xMin uint32, xMax uint32, d []byte, s []byte, ds uint32, ss uint32, dlcmlen uint32, slcmlen uint32, dh uint32, tt []uint32, ft []uint32, straight bool, flip bool) {
 	defer h.Done()
-	swx4, dwx4 := sw<<2, dw<<2
-	for x := xMin; x < xMax; x += 4 {
-		if (x>>2)&7 == 7 && h.Aborted() {
+	n := xMax - xMin
+	acc := make([]uint32, n)
+	for y, fr := uint32(0), uint32(0); y < dh; y++ {
+		if h.abortedAt(y) {
 			return
 		}
-		di, si := x, x
-		for y, fr := uint32(0), uint32(0); y < dh; y++ {
-			tl, tr := tt[y], tt[y+1]
-			fl := slcmlen - fr
-			fr = ft[y]
-			var ta, a, r, g, b, w uint32
-			if fl != 0 {
-				ta = uint32(s[si+3])
-				if ta > 0 {
-					w = ta * fl
-					r += uint32(divTable[(uint32(s[si+0])<<8)+ta]) * w
-					g += uint32(divTable[(uint32(s[si+1])<<8)+ta]) * w
-					b += uint32(divTable[(uint32(s[si+2])<<8)+ta]) * w
-					a += w
-				}
-				si += swx4
-			}
-			for i := tl + 1; i < tr; i++ {
-				ta = uint32(s[si+3])
-				if ta > 0 {
-					w = ta * slcmlen
-					r += uint32(divTable[(uint32(s[si+0])<<8)+ta]) * w
-					g += uint32(divTable[(uint32(s[si+1])<<8)+ta]) * w
-					b += uint32(divTable[(uint32(s[si+2])<<8)+ta]) * w
-					a += w
-				}
-				si += swx4
-			}
-			if fr != 0 && s[si+3] > 0 {
-				ta = uint32(s[si+3])
-				w = ta * fr
-				r += uint32(divTable[(uint32(s[si+0])<<8)+ta]) * w
-				g += uint32(divTable[(uint32(s[si+1])<<8)+ta]) * w
-				b += uint32(divTable[(uint32(s[si+2])<<8)+ta]) * w
-				a += w
-			}
-			if a == 0 {
-				d[di+0] = 0
-				d[di+1] = 0
-				d[di+2] = 0
-				d[di+3] = 0
-			} else {
-				d[di+0] = uint8((r / dlcmlen * 32897) >> 23)
-				d[di+1] = uint8((g / dlcmlen * 32897) >> 23)
-				d[di+2] = uint8((b / dlcmlen * 32897) >> 23)
-				d[di+3] = uint8(a / dlcmlen)
+		tl, tr := tt[y], tt[y+1]
+		fl := slcmlen - fr
+		fr = ft[y]
+		for i := range acc {
+			acc[i] = 0
+		}
+		// fl is never zero because ft holds remainders of slcmlen.
+		si := tl*ss + xMin
+		accumulate8RGBA(acc, s[si:si+n], fl)
+		for i := tl + 1; i < tr; i++ {
+			si += ss
+			accumulate8RGBA(acc, s[si:si+n], slcmlen)
+		}
+		if fr != 0 {
+			si += ss
+			accumulate8RGBA(acc, s[si:si+n], fr)
+		}
+		dy := y
+		if flip {
+			dy = dh - 1 - y
+		}
+		di := dy*ds + xMin
+		if straight {
+			store8NRGBA(d[di:di+n], acc, dlcmlen, h.round())
+		} else {
+			store8RGBA(d[di:di+n], acc, dlcmlen, h.round())
+		}
+	}
+}
+
+// accumulate8RGBAGeneric adds the straight colors of the premultiplied row
+// to acc, weighted by their alpha and w.
+func accumulate8RGBAGeneric(acc []uint32, row []byte, w uint32) {
+	row = row[:len(acc)]
+	for i := 0; i < len(acc); i += 4 {
+		ta := uint32(row[i+3])
+		if ta == 0 {
+			continue
+		}
+		tw := ta * w
+		acc[i+0] += uint32(divTable[(uint32(row[i+0])<<8)+ta]) * tw
+		acc[i+1] += uint32(divTable[(uint32(row[i+1])<<8)+ta]) * tw
+		acc[i+2] += uint32(divTable[(uint32(row[i+2])<<8)+ta]) * tw
+		acc[i+3] += tw
+	}
+}
+
+// expandOpaque8RGBA is accumulate8RGBA into a zeroed buf with a weight of 1
+// for a row whose alphas are all 255. The colors are already straight, so
+// the divTable lookups are skipped.
+func expandOpaque8RGBA(buf []uint32, row []byte) {
+	row = row[:len(buf)]
+	for i := 0; i < len(buf); i += 4 {
+		buf[i+0] = uint32(row[i+0]) * 255
+		buf[i+1] = uint32(row[i+1]) * 255
+		buf[i+2] = uint32(row[i+2]) * 255
+		buf[i+3] = 255
+	}
+}
+
+// horzTaps8RGBAGeneric sums the taps of every destination pixel from the
+// expanded source row buf into acc.
+func horzTaps8RGBAGeneric(acc []uint32, buf []uint32, tt []uint32, ft []uint32, slcmlen uint32) {
+	si := 0
+	for x, di, fr := 0, 0, uint32(0); di < len(acc); x, di = x+1, di+4 {
+		tl, tr := tt[x], tt[x+1]
+		// fl is never zero because ft holds remainders of slcmlen.
+		fl := slcmlen - fr
+		fr = ft[x]
+		r := buf[si+0] * fl
+		g := buf[si+1] * fl
+		b := buf[si+2] * fl
+		a := buf[si+3] * fl
+		si += 4
+		for i := tl + 1; i < tr; i++ {
+			r += buf[si+0] * slcmlen
+			g += buf[si+1] * slcmlen
+			b += buf[si+2] * slcmlen
+			a += buf[si+3] * slcmlen
+			si += 4
+		}
+		if fr != 0 {
+			r += buf[si+0] * fr
+			g += buf[si+1] * fr
+			b += buf[si+2] * fr
+			a += buf[si+3] * fr
+		}
+		acc[di+0] = r
+		acc[di+1] = g
+		acc[di+2] = b
+		acc[di+3] = a
+	}
+}
+
+// store8RGBA writes the premultiplied colors accumulated in acc to d. The
+// default rounding truncates with a multiplication for the division by 255.
+func store8RGBA(d []byte, acc []uint32, dlcmlen uint32, rnd Rounding) {
+	d = d[:len(acc)]
+	div := newDivider(dlcmlen)
+	if rnd == RoundDiffuse {
+		var f diffuser
+		q, l := uint64(dlcmlen)*255, uint64(dlcmlen)
+		for i := 0; i < len(acc); i += 4 {
+			a := f.next(3, uint64(acc[i+3]), l)
+			d[i+0] = uint8(f.nextMax(0, uint64(acc[i+0]), q, a))
+			d[i+1] = uint8(f.nextMax(1, uint64(acc[i+1]), q, a))
+			d[i+2] = uint8(f.nextMax(2, uint64(acc[i+2]), q, a))
+			d[i+3] = uint8(a)
+		}
+		return
+	}
+	if rnd = rnd.or(RoundDown); rnd != RoundDown {
+		q := uint64(dlcmlen) * 255
+		cb, ab := rnd.bias(q), uint32(rnd.bias(uint64(dlcmlen)))
+		for i := 0; i < len(acc); i += 4 {
+			d[i+0] = uint8((uint64(acc[i+0]) + cb) / q)
+			d[i+1] = uint8((uint64(acc[i+1]) + cb) / q)
+			d[i+2] = uint8((uint64(acc[i+2]) + cb) / q)
+			d[i+3] = uint8(div.div(acc[i+3] + ab))
+		}
+		return
+	}
+	for i := 0; i < len(acc); i += 4 {
+		if a := acc[i+3]; a == 0 {
+			d[i+0] = 0
+			d[i+1] = 0
+			d[i+2] = 0
+			d[i+3] = 0
+		} else {
+			d[i+0] = uint8((div.div(acc[i+0]) * 32897) >> 23)
+			d[i+1] = uint8((div.div(acc[i+1]) * 32897) >> 23)
+			d[i+2] = uint8((div.div(acc[i+2]) * 32897) >> 23)
+			d[i+3] = uint8(div.div(a))
+		}
+	}
+}
+
+// store8NRGBA writes the straight colors accumulated in acc to d. The alpha
+// weights cancel out, so only the alpha channel needs dlcmlen.
+func store8NRGBA(d []byte, acc []uint32, dlcmlen uint32, rnd Rounding) {
+	d = d[:len(acc)]
+	div := newDivider(dlcmlen)
+	crnd := rnd.or(RoundNearest)
+	ab := uint32(rnd.or(RoundDown).bias(uint64(dlcmlen)))
+	var f diffuser
+	for i := 0; i < len(acc); i += 4 {
+		if a := acc[i+3]; a == 0 {
+			d[i+0] = 0
+			d[i+1] = 0
+			d[i+2] = 0
+			d[i+3] = 0
+		} else {
+			if crnd == RoundDiffuse {
+				d[i+0] = uint8(f.next(0, uint64(acc[i+0]), uint64(a)))
+				d[i+1] = uint8(f.next(1, uint64(acc[i+1]), uint64(a)))
+				d[i+2] = uint8(f.next(2, uint64(acc[i+2]), uint64(a)))
+				d[i+3] = uint8(f.next(3, uint64(a), uint64(dlcmlen)))
+				continue
 			}
-			di += dwx4
+			cb := uint32(crnd.bias(uint64(a)))
+			d[i+0] = uint8((acc[i+0] + cb) / a)
+			d[i+1] = uint8((acc[i+1] + cb) / a)
+			d[i+2] = uint8((acc[i+2] + cb) / a)
+			d[i+3] = uint8(div.div(a + ab))
 		}
 	}
 }
@@ -0,0 +1,458 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestRGBASubImage(t *testing.T) {
+	ctx := context.Background()
+	full := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(full, full.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	r := image.Rect(10, 7, 50, 37)
+	sub := full.SubImage(r).(*image.RGBA)
+	cp := image.NewRGBA(r)
+	draw.Draw(cp, r, full, r.Min, draw.Src)
+
+	for _, size := range []image.Point{{40, 30}, {13, 30}, {40, 11}, {13, 11}} {
+		want := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		if err := RGBA(ctx, want, cp); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		if err := RGBA(ctx, got, sub); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: want %v, got %v", size, want.Pix, got.Pix)
+		}
+	}
+}
+
+func TestRGBAPaddedDest(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	draw.Draw(src, src.Rect, testPattern(40, 30), image.Point{}, draw.Src)
+	funcs := map[string]func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error{
+		"RGBA": RGBA,
+		"RGBAGamma": func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+			return RGBAGamma(ctx, dest, src, 2.2)
+		},
+		"RGBASRGB": RGBASRGB,
+		"RGBAFast": RGBAFast,
+	}
+	for name, fn := range funcs {
+		for _, size := range []image.Point{{40, 30}, {13, 30}, {40, 11}, {13, 11}} {
+			want := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+			if err := fn(ctx, want, src); err != nil {
+				t.Fatal(err)
+			}
+
+			atlas := image.NewRGBA(image.Rect(0, 0, size.X+6, size.Y+4))
+			for i := range atlas.Pix {
+				atlas.Pix[i] = 0xaa
+			}
+			r := image.Rect(3, 2, 3+size.X, 2+size.Y)
+			if err := fn(ctx, atlas.SubImage(r).(*image.RGBA), src); err != nil {
+				t.Fatal(err)
+			}
+			for y := atlas.Rect.Min.Y; y < atlas.Rect.Max.Y; y++ {
+				for x := atlas.Rect.Min.X; x < atlas.Rect.Max.X; x++ {
+					got := atlas.RGBAAt(x, y)
+					if !(image.Point{x, y}).In(r) {
+						if got != (color.RGBA{0xaa, 0xaa, 0xaa, 0xaa}) {
+							t.Fatalf("%s %v: (%d, %d) was overwritten: %v", name, size, x, y, got)
+						}
+						continue
+					}
+					if w := want.RGBAAt(x-r.Min.X, y-r.Min.Y); got != w {
+						t.Fatalf("%s %v: (%d, %d): want %v, got %v", name, size, x, y, w, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRGBAAlignedStride(t *testing.T) {
+	ctx := context.Background()
+	translucent := image.NewRGBA(image.Rect(0, 0, 80, 60))
+	draw.Draw(translucent, translucent.Rect, testPattern(80, 60), image.Point{}, draw.Src)
+	opaque := image.NewRGBA(translucent.Rect)
+	draw.Draw(opaque, opaque.Rect, image.Black, image.Point{}, draw.Src)
+	draw.Draw(opaque, opaque.Rect, translucent, image.Point{}, draw.Over)
+	funcs := map[string]func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error{
+		"RGBA":            RGBA,
+		"RGBAFlipV":       RGBAFlipV,
+		"RGBAOpaque":      RGBAOpaque,
+		"RGBAProgressive": RGBAProgressive,
+		"RGBALanczos":     RGBALanczos,
+		"RGBAFast":        RGBAFast,
+		"RGBASRGB":        RGBASRGB,
+		"RGBAGamma": func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+			return RGBAGamma(ctx, dest, src, 2.2, opts...)
+		},
+		"RGBALinear": func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+			return RGBALinear(ctx, dest, src, 2.2, opts...)
+		},
+	}
+	for name, fn := range funcs {
+		for _, src := range []*image.RGBA{translucent, opaque} {
+			for _, size := range []image.Point{{80, 60}, {17, 60}, {80, 13}, {17, 13}} {
+				want := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+				if err := fn(ctx, want, src); err != nil {
+					t.Fatal(err)
+				}
+				// rows aligned to 256 bytes, with the padding filled in.
+				stride := (size.X<<2 + 255) &^ 255
+				got := &image.RGBA{Pix: make([]byte, stride*size.Y), Stride: stride, Rect: want.Rect}
+				for i := range got.Pix {
+					got.Pix[i] = 0xaa
+				}
+				if err := fn(ctx, got, src, WithConcurrency(3)); err != nil {
+					t.Fatal(err)
+				}
+				for y := 0; y < size.Y; y++ {
+					row := got.Pix[y*stride : (y+1)*stride]
+					if !bytes.Equal(row[:size.X<<2], want.Pix[y*want.Stride:(y+1)*want.Stride]) {
+						t.Fatalf("%s %v: row %d differs", name, size, y)
+					}
+					for i, v := range row[size.X<<2:] {
+						if v != 0xaa {
+							t.Fatalf("%s %v: padding byte %d of row %d was overwritten", name, size, i, y)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestShortPix(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	dest := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	short := &image.RGBA{Pix: dest.Pix[:len(dest.Pix)-1], Stride: dest.Stride, Rect: dest.Rect}
+	if err := RGBA(ctx, short, src); err == nil {
+		t.Error("RGBA: want error, got nil")
+	}
+	if err := RGBAGamma(ctx, short, src, 2.2); err == nil {
+		t.Error("RGBAGamma: want error, got nil")
+	}
+	if err := RGBA(ctx, dest, &image.RGBA{Pix: src.Pix, Stride: 4, Rect: src.Rect}); err == nil {
+		t.Error("RGBA: want error for a narrow stride, got nil")
+	}
+
+	nsrc := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	nshort := &image.NRGBA{Pix: make([]byte, 10*4*9), Stride: 10 * 4, Rect: dest.Rect}
+	if err := NRGBA(ctx, nshort, nsrc); err == nil {
+		t.Error("NRGBA: want error, got nil")
+	}
+	if err := NRGBAGamma(ctx, nshort, nsrc, 2.2); err == nil {
+		t.Error("NRGBAGamma: want error, got nil")
+	}
+}
+
+func TestErrUpscaleUnsupported(t *testing.T) {
+	ctx := context.Background()
+	small, large := image.Rect(0, 0, 4, 4), image.Rect(0, 0, 8, 4)
+	errs := map[string]error{
+		"RGBA":    RGBA(ctx, image.NewRGBA(large), image.NewRGBA(small)),
+		"NRGBA":   NRGBA(ctx, image.NewNRGBA(large), image.NewNRGBA(small)),
+		"RGBA64":  RGBA64(ctx, image.NewRGBA64(large), image.NewRGBA64(small)),
+		"NRGBA64": NRGBA64(ctx, image.NewNRGBA64(large), image.NewNRGBA64(small)),
+	}
+	for name, err := range errs {
+		if !errors.Is(err, ErrUpscaleUnsupported) {
+			t.Errorf("%s: want ErrUpscaleUnsupported, got %v", name, err)
+		}
+	}
+}
+
+func TestErrInvalidSize(t *testing.T) {
+	ctx := context.Background()
+	ok := image.Rect(0, 0, 4, 4)
+	for _, c := range []struct{ dest, src image.Rectangle }{
+		{image.Rect(0, 0, 0, 4), ok},
+		{image.Rect(0, 0, 4, 0), ok},
+		{image.Rect(0, 0, 0, 0), ok},
+		{image.Rect(0, 0, 0, 0), image.Rect(0, 0, 0, 0)},
+		{ok, image.Rect(0, 0, 0, 4)},
+		{ok, image.Rect(0, 0, 4, 0)},
+		{image.Rectangle{Max: image.Point{-2, 4}}, ok},
+	} {
+		dest := &image.RGBA{Pix: make([]byte, 64), Stride: 16, Rect: c.dest}
+		src := &image.RGBA{Pix: make([]byte, 64), Stride: 16, Rect: c.src}
+		errs := map[string]error{
+			"RGBA":      RGBA(ctx, dest, src),
+			"RGBAFast":  RGBAFast(ctx, dest, src),
+			"RGBAGamma": RGBAGamma(ctx, dest, src, 2.2),
+			"Gray": Gray(ctx,
+				&image.Gray{Pix: make([]byte, 16), Stride: 4, Rect: c.dest},
+				&image.Gray{Pix: make([]byte, 16), Stride: 4, Rect: c.src}),
+		}
+		for name, err := range errs {
+			if !errors.Is(err, ErrInvalidSize) {
+				t.Errorf("%s %v <- %v: want ErrInvalidSize, got %v", name, c.dest, c.src, err)
+			}
+		}
+	}
+	if _, err := NewScaler(4, 4, 0, 4); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("NewScaler: want ErrInvalidSize, got %v", err)
+	}
+}
+
+func TestRGBAWithTables(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	for _, sz := range []image.Point{{31, 17}, {64, 17}, {31, 48}, {64, 48}} {
+		var horz, vert *WeightTable
+		if sz.X != 64 {
+			horz = NewWeightTable(64, uint32(sz.X))
+		}
+		if sz.Y != 48 {
+			vert = NewWeightTable(48, uint32(sz.Y))
+		}
+		want := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		if err := RGBAWithTables(ctx, got, src, horz, vert); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: differs from RGBA", sz)
+		}
+	}
+
+	dest := image.NewRGBA(image.Rect(0, 0, 31, 17))
+	if err := RGBAWithTables(ctx, dest, src, NewWeightTable(64, 30), NewWeightTable(48, 17)); err == nil {
+		t.Error("want an error for a mismatched horizontal table")
+	}
+	if err := RGBAWithTables(ctx, dest, src, NewWeightTable(64, 31), nil); err == nil {
+		t.Error("want an error for a missing vertical table")
+	}
+}
+
+func TestRGBAOneAxis(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	for _, tc := range []struct {
+		name string
+		fn   func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error
+		size image.Point
+		bad  image.Point
+	}{
+		{"RGBAHorizontal", RGBAHorizontal, image.Pt(23, 48), image.Pt(23, 47)},
+		{"RGBAVertical", RGBAVertical, image.Pt(64, 19), image.Pt(63, 19)},
+		{"RGBAHorizontal", RGBAHorizontal, image.Pt(64, 48), image.Pt(64, 48)},
+	} {
+		want := image.NewRGBA(image.Rect(0, 0, tc.size.X, tc.size.Y))
+		if err := RGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		if err := tc.fn(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%s %v: differs from RGBA", tc.name, tc.size)
+		}
+		if tc.bad != tc.size {
+			if err := tc.fn(ctx, image.NewRGBA(image.Rect(0, 0, tc.bad.X, tc.bad.Y)), src); err == nil {
+				t.Errorf("%s %v: want an error", tc.name, tc.bad)
+			}
+		}
+	}
+}
+
+func TestRGBAInto(t *testing.T) {
+	ctx := context.Background()
+	canvas := image.NewRGBA(image.Rect(0, 0, 42, 32))
+	draw.Draw(canvas, canvas.Rect, image.NewUniform(color.RGBA{1, 2, 3, 255}), image.Point{}, draw.Src)
+	// a contact sheet of four thumbnails with a one pixel border.
+	var cells [4]image.Rectangle
+	var wants [4]*image.RGBA
+	for i := range cells {
+		cells[i] = image.Rect(1, 1, 21, 16).Add(image.Pt(i%2*21, i/2*16))
+		src := image.NewRGBA(image.Rect(0, 0, 80+i*10, 60))
+		draw.Draw(src, src.Rect, testPattern(80+i*10, 60), image.Pt(i, 0), draw.Src)
+		if err := RGBAInto(ctx, canvas, cells[i], src); err != nil {
+			t.Fatal(err)
+		}
+		wants[i] = image.NewRGBA(image.Rect(0, 0, 20, 15))
+		if err := RGBA(ctx, wants[i], src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 42; x++ {
+			want := color.RGBA{1, 2, 3, 255}
+			for i, r := range cells {
+				if p := image.Pt(x, y); p.In(r) {
+					want = wants[i].RGBAAt(x-r.Min.X, y-r.Min.Y)
+				}
+			}
+			if got := canvas.RGBAAt(x, y); got != want {
+				t.Fatalf("(%d, %d): want %v, got %v", x, y, want, got)
+			}
+		}
+	}
+
+	if err := RGBAInto(ctx, canvas, image.Rect(30, 20, 50, 35), image.NewRGBA(image.Rect(0, 0, 40, 30))); err == nil {
+		t.Error("want an error for dr outside of dest")
+	}
+}
+
+func TestRGBAToNRGBA(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	for _, sz := range []image.Point{{31, 17}, {64, 17}, {31, 48}, {64, 48}} {
+		tmp := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(ctx, tmp, src); err != nil {
+			t.Fatal(err)
+		}
+		want := image.NewNRGBA(tmp.Rect)
+		draw.Draw(want, want.Rect, tmp, image.Point{}, draw.Src)
+
+		got := image.NewNRGBA(tmp.Rect)
+		if err := RGBAToNRGBA(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(want.Pix); i += 4 {
+			if want.Pix[i+3] != got.Pix[i+3] {
+				t.Fatalf("%v: alpha at %d: want %d, got %d", sz, i>>2, want.Pix[i+3], got.Pix[i+3])
+			}
+			// un-premultiplying the result of RGBA scales its rounding
+			// error by 255/alpha.
+			tol := 1 + 255/int(want.Pix[i+3])
+			for c := 0; c < 3; c++ {
+				if d := int(want.Pix[i+c]) - int(got.Pix[i+c]); d < -tol || d > tol {
+					t.Fatalf("%v: Pix[%d]: want %d, got %d", sz, i+c, want.Pix[i+c], got.Pix[i+c])
+				}
+			}
+		}
+
+		direct := image.NewNRGBA(tmp.Rect)
+		if err := RGBAToNRGBADirect(ctx, direct, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Pix, direct.Pix) {
+			t.Fatalf("%v: RGBAToNRGBADirect differs from RGBAToNRGBA", sz)
+		}
+	}
+}
+
+func TestRGBARaw(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	want := image.NewRGBA(image.Rect(0, 0, 23, 17))
+	if err := RGBA(ctx, want, src); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 23*17*4)
+	if err := RGBARaw(ctx, got, 23, 17, src.Pix, 64, 48); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want.Pix, got) {
+		t.Error("RGBARaw result differs from RGBA")
+	}
+	if err := RGBARaw(ctx, got[:len(got)-1], 23, 17, src.Pix, 64, 48); err == nil {
+		t.Error("want an error for a short dPix")
+	}
+	if err := RGBARaw(ctx, got, -23, 17, src.Pix, 64, 48); err == nil {
+		t.Error("want an error for a negative size")
+	}
+}
+
+func TestRGBAFlipV(t *testing.T) {
+	ctx := context.Background()
+	translucent := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(translucent, translucent.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	opaque := image.NewRGBA(translucent.Rect)
+	draw.Draw(opaque, opaque.Rect, image.Black, image.Point{}, draw.Src)
+	draw.Draw(opaque, opaque.Rect, translucent, image.Point{}, draw.Over)
+	for _, src := range []*image.RGBA{translucent, opaque} {
+		for _, sz := range []image.Point{{23, 17}, {64, 17}, {23, 48}, {64, 48}, {1, 1}} {
+			want := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+			if err := RGBA(ctx, want, src); err != nil {
+				t.Fatal(err)
+			}
+			got := image.NewRGBA(want.Rect)
+			if err := RGBAFlipV(ctx, got, src); err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < sz.Y; y++ {
+				w := want.Pix[y*want.Stride : y*want.Stride+sz.X<<2]
+				g := got.Pix[(sz.Y-1-y)*got.Stride : (sz.Y-1-y)*got.Stride+sz.X<<2]
+				if !bytes.Equal(w, g) {
+					t.Errorf("%v: row %d is not flipped", sz, y)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRGBAInPlace(t *testing.T) {
+	ctx := context.Background()
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 64, 19),
+		image.Rect(0, 5, 64, 24),
+		image.Rect(0, 0, 23, 48),
+		image.Rect(7, 0, 30, 48),
+		image.Rect(0, 0, 23, 19),
+		image.Rect(0, 3, 64, 51),
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 56))
+		draw.Draw(img, img.Rect, testPattern(64, 56), image.Point{}, draw.Src)
+		src := img.SubImage(image.Rect(0, 0, 64, 48)).(*image.RGBA)
+		clone := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		draw.Draw(clone, clone.Rect, src, image.Point{}, draw.Src)
+		want := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		if err := RGBA(ctx, want, clone); err != nil {
+			t.Fatal(err)
+		}
+		dest := img.SubImage(r).(*image.RGBA)
+		if err := RGBA(ctx, dest, src); err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < r.Dy(); y++ {
+			w := want.Pix[y*want.Stride : y*want.Stride+r.Dx()<<2]
+			g := dest.Pix[y*dest.Stride : y*dest.Stride+r.Dx()<<2]
+			if !bytes.Equal(w, g) {
+				t.Errorf("%v: row %d differs from the non-aliased result", r, y)
+				break
+			}
+		}
+	}
+}
+
+func TestExpandOpaque8RGBA(t *testing.T) {
+	row := make([]byte, 256*4)
+	for i := 0; i < 256; i++ {
+		row[i*4+0] = uint8(i)
+		row[i*4+1] = uint8(255 - i)
+		row[i*4+2] = uint8(i * 7)
+		row[i*4+3] = 255
+	}
+	want := make([]uint32, len(row))
+	accumulate8RGBAGeneric(want, row, 1)
+	got := make([]uint32, len(row))
+	expandOpaque8RGBA(got, row)
+	for i := range want {
+		if want[i] != got[i] {
+			t.Fatalf("#%d: want %d, got %d", i, want[i], got[i])
+		}
+	}
+}
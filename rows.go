@@ -0,0 +1,131 @@
+package downscale
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync"
+)
+
+// SrcRows gives the rows of a premultiplied RGBA source image one at a time,
+// for images that are not held as one *image.RGBA such as tiled stores.
+// Row must return at least width*4 bytes for every y from 0 to height-1 and
+// may be called from several goroutines at once. The returned slice is only
+// read until the next call of Row from the same goroutine.
+type SrcRows interface {
+	Row(y int) []byte
+}
+
+// RGBARows is RGBA for a sw x sh source read through src. The horizontal
+// pass calls src.Row once per source row.
+func RGBARows(ctx context.Context, dest *image.RGBA, src SrcRows, sw int, sh int, opts ...Option) error {
+	return metered(ctx, opts, image.Rect(0, 0, sw, sh), dest.Rect, func(ctx context.Context) error {
+		return rowsRGBA(ctx, dest, src, sw, sh, opts)
+	})
+}
+
+func rowsRGBA(ctx context.Context, dest *image.RGBA, src SrcRows, sw int, sh int, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	o := newOptions(opts)
+	tmp := dest
+	if sh != dh {
+		tmp = getTmpRGBA(dw, sh)
+		defer putTmpRGBA(tmp)
+	}
+	if err := horz8RGBARows(ctx, tmp, src, sw, o); err != nil {
+		return err
+	}
+	if sh == dh {
+		return nil
+	}
+	return vert8RGBA(ctx, dest, tmp, o)
+}
+
+var errShortRow = errors.New("downscale: SrcRows returned a row shorter than the source width")
+
+// horz8RGBARows is horz8RGBA reading the source through src, or a copy of
+// its rows when the width is kept.
+func horz8RGBARows(ctx context.Context, dest *image.RGBA, src SrcRows, sw int, o *options) error {
+	n := o.workers(dest.Rect.Dx() * dest.Rect.Dy())
+	for n > 1 && n<<1 > dest.Rect.Dy() {
+		n--
+	}
+
+	var t *WeightTable
+	if dw := dest.Rect.Dx(); sw != dw {
+		t = NewWeightTable(uint32(sw), uint32(dw))
+	}
+	dh := uint32(dest.Rect.Dy())
+
+	h := &handle{every: o.abortEvery(), rounding: o.rounding}
+	var m sync.Mutex
+	var rowErr error
+	h.wg.Add(n)
+	step := dh / uint32(n)
+	y := uint32(0)
+	for i := 0; i < n; i++ {
+		yMin, yMax := y, y+step
+		if i == n-1 {
+			yMax = dh
+		}
+		spawn(func() {
+			defer h.Done()
+			if err := horz8RGBARowsInner(h, yMin, yMax, dest, src, sw, t); err != nil {
+				m.Lock()
+				rowErr = err
+				m.Unlock()
+				h.SetAbort()
+			}
+		})
+		y += step
+	}
+	err := h.Wait(ctx)
+	m.Lock()
+	defer m.Unlock()
+	if rowErr != nil {
+		return rowErr
+	}
+	return err
+}
+
+func horz8RGBARowsInner(h *handle, yMin uint32, yMax uint32, dest *image.RGBA, src SrcRows, sw int, t *WeightTable) error {
+	swx4, dwx4 := sw<<2, dest.Rect.Dx()<<2
+	var buf, acc []uint32
+	if t != nil {
+		buf = make([]uint32, swx4)
+		acc = make([]uint32, dwx4)
+	}
+	for y := yMin; y < yMax; y++ {
+		if h.abortedAt(y) {
+			return nil
+		}
+		row := src.Row(int(y))
+		if len(row) < swx4 {
+			return errShortRow
+		}
+		d := dest.Pix[int(y)*dest.Stride : int(y)*dest.Stride+dwx4]
+		if t == nil {
+			copy(d, row)
+			continue
+		}
+		for i := range buf {
+			buf[i] = 0
+		}
+		accumulate8RGBA(buf, row[:swx4], 1)
+		horzTaps8RGBA(acc, buf, t.tt, t.ft, t.slcmlen)
+		store8RGBA(d, acc, t.dlcmlen, h.round())
+	}
+	return nil
+}
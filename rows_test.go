@@ -0,0 +1,62 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+// rgbaRows is SrcRows over an *image.RGBA.
+type rgbaRows struct {
+	img *image.RGBA
+}
+
+func (r rgbaRows) Row(y int) []byte {
+	i := r.img.PixOffset(r.img.Rect.Min.X, r.img.Rect.Min.Y+y)
+	return r.img.Pix[i : i+r.img.Rect.Dx()<<2]
+}
+
+func TestRGBARows(t *testing.T) {
+	ctx := context.Background()
+	full := image.NewRGBA(image.Rect(0, 0, 110, 80))
+	draw.Draw(full, full.Rect, testPattern(110, 80), image.Point{}, draw.Src)
+	src := full.SubImage(image.Rect(3, 2, 104, 79)).(*image.RGBA)
+	for _, sz := range []image.Point{{37, 29}, {101, 29}, {37, 77}, {101, 77}, {1, 1}} {
+		want := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []int{1, 8} {
+			got := image.NewRGBA(want.Rect)
+			if err := RGBARows(ctx, got, rgbaRows{src}, 101, 77, WithConcurrency(c)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want.Pix, got.Pix) {
+				t.Errorf("%v, %d workers: differs from RGBA", sz, c)
+			}
+		}
+	}
+
+	// RGBA takes another path for opaque images.
+	opaque := image.NewRGBA(image.Rect(0, 0, 101, 77))
+	draw.Draw(opaque, opaque.Rect, image.Opaque, image.Point{}, draw.Src)
+	draw.Draw(opaque, opaque.Rect, src, src.Rect.Min, draw.Over)
+	want := image.NewRGBA(image.Rect(0, 0, 37, 29))
+	if err := RGBA(ctx, want, opaque); err != nil {
+		t.Fatal(err)
+	}
+	got := image.NewRGBA(want.Rect)
+	if err := RGBARows(ctx, got, rgbaRows{opaque}, 101, 77); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want.Pix, got.Pix) {
+		t.Error("opaque: differs from RGBA")
+	}
+
+	got = image.NewRGBA(image.Rect(0, 0, 10, 10))
+	if err := RGBARows(ctx, got, rgbaRows{src}, 102, 77); err != errShortRow {
+		t.Errorf("want errShortRow, got %v", err)
+	}
+}
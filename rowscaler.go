@@ -0,0 +1,144 @@
+package downscale
+
+import (
+	"errors"
+)
+
+// RowScaler downscales premultiplied RGBA rows as they are pushed, so that
+// the source image never has to be held in memory as a whole.
+// It produces the same pixels as RGBA.
+//
+// Only the horizontally scaled rows that the next destination row depends
+// on are kept, which is about srcH/dstH+1 rows of dstW pixels.
+type RowScaler struct {
+	sw, sh, dw, dh int
+
+	hslcmlen, hdlcmlen uint32
+	htt, hft           []uint32
+	vslcmlen, vdlcmlen uint32
+	vtt, vft           []uint32
+
+	// rows holds the horizontally scaled source rows from row first on.
+	rows  [][]byte
+	free  [][]byte
+	first int
+	in    int
+	out   int
+	acc   []uint32
+}
+
+func NewRowScaler(srcW int, srcH int, dstW int, dstH int) (*RowScaler, error) {
+	if srcW <= 0 || srcH <= 0 || dstW <= 0 || dstH <= 0 {
+		return nil, ErrInvalidSize
+	}
+	if srcW < dstW || srcH < dstH {
+		return nil, ErrUpscaleUnsupported
+	}
+	if !sumFits(srcW, dstW, peak8RGBA) || !sumFits(srcH, dstH, peak8RGBA) {
+		return nil, ErrTooLarge
+	}
+	s := &RowScaler{sw: srcW, sh: srcH, dw: dstW, dh: dstH}
+	if srcW != dstW {
+		var err error
+		s.hslcmlen, s.hdlcmlen, s.htt, s.hft, err = lcmTable(uint32(srcW), uint32(dstW))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if srcH != dstH {
+		var err error
+		s.vslcmlen, s.vdlcmlen, s.vtt, s.vft, err = lcmTable(uint32(srcH), uint32(dstH))
+		if err != nil {
+			return nil, err
+		}
+		s.acc = make([]uint32, dstW<<2)
+	}
+	return s, nil
+}
+
+// WriteRow pushes the next source row. row must hold at least srcW
+// premultiplied RGBA pixels.
+func (s *RowScaler) WriteRow(row []byte) error {
+	if s.in >= s.sh {
+		return errors.New("downscale: all source rows have already been written")
+	}
+	if len(row) < s.sw<<2 {
+		return errors.New("downscale: source row is too short")
+	}
+	var d []byte
+	if n := len(s.free); n > 0 {
+		d, s.free = s.free[n-1], s.free[:n-1]
+	} else {
+		d = make([]byte, s.dw<<2)
+	}
+	if s.sw == s.dw {
+		copy(d, row)
+	} else {
+		horz8RGBAInner(nil, 0, 1, d, row, 0, 0, s.hdlcmlen, s.hslcmlen, uint32(s.dw), s.htt, s.hft, false)
+	}
+	s.rows = append(s.rows, d)
+	s.in++
+	return nil
+}
+
+// ReadRow writes the next destination row into dst, which must hold at least
+// dstW pixels. It reports false when more source rows have to be written
+// first or when every destination row has already been read.
+func (s *RowScaler) ReadRow(dst []byte) (bool, error) {
+	if s.out >= s.dh {
+		return false, nil
+	}
+	if len(dst) < s.dw<<2 {
+		return false, errors.New("downscale: destination row is too short")
+	}
+	if s.sh == s.dh {
+		if len(s.rows) == 0 {
+			return false, nil
+		}
+		copy(dst, s.rows[0])
+		s.release(1)
+		s.out++
+		return true, nil
+	}
+
+	y := uint32(s.out)
+	tl, tr := int(s.vtt[y]), int(s.vtt[y+1])
+	fr := s.vft[y]
+	last := tr - 1
+	if fr != 0 {
+		last = tr
+	}
+	if last >= s.in {
+		return false, nil
+	}
+
+	var fl uint32
+	if y == 0 {
+		fl = s.vslcmlen
+	} else {
+		fl = s.vslcmlen - s.vft[y-1]
+	}
+	acc := s.acc
+	for i := range acc {
+		acc[i] = 0
+	}
+	accumulate8RGBA(acc, s.rows[tl-s.first], fl)
+	for i := tl + 1; i < tr; i++ {
+		accumulate8RGBA(acc, s.rows[i-s.first], s.vslcmlen)
+	}
+	if fr != 0 {
+		accumulate8RGBA(acc, s.rows[tr-s.first], fr)
+	}
+	store8RGBA(dst, acc, s.vdlcmlen, RoundDefault)
+	s.out++
+
+	// the row at tr is shared with the next destination row when fr != 0.
+	s.release(tr - s.first)
+	return true, nil
+}
+
+func (s *RowScaler) release(n int) {
+	s.free = append(s.free, s.rows[:n]...)
+	s.rows = append(s.rows[:0], s.rows[n:]...)
+	s.first += n
+}
@@ -0,0 +1,63 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func TestRowScaler(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(src, src.Rect, testPattern(300, 200), image.Point{}, draw.Src)
+	for _, size := range []image.Point{{70, 45}, {300, 45}, {70, 200}, {300, 200}, {1, 1}, {150, 100}} {
+		want := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		if err := RGBA(context.Background(), want, src); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := NewRowScaler(300, 200, size.X, size.Y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		y, buffered := 0, 0
+		for sy := 0; sy < 200; sy++ {
+			if err := s.WriteRow(src.Pix[sy*src.Stride:]); err != nil {
+				t.Fatal(err)
+			}
+			if len(s.rows) > buffered {
+				buffered = len(s.rows)
+			}
+			for {
+				ok, err := s.ReadRow(got.Pix[y*got.Stride:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !ok {
+					break
+				}
+				y++
+			}
+		}
+		if y != size.Y {
+			t.Fatalf("%v: want %d rows, got %d", size, size.Y, y)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: streamed output differs from RGBA", size)
+		}
+		if buffered > 200/size.Y+2 {
+			t.Errorf("%v: want at most %d buffered rows, got %d", size, 200/size.Y+2, buffered)
+		}
+		if err := s.WriteRow(src.Pix); err == nil {
+			t.Errorf("%v: want error after the last row, got nil", size)
+		}
+	}
+}
+
+func TestNewRowScalerUpscale(t *testing.T) {
+	if _, err := NewRowScaler(4, 4, 8, 4); err != ErrUpscaleUnsupported {
+		t.Fatalf("want ErrUpscaleUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package downscale
+
+import (
+	"image"
+	"image/color"
+)
+
+// SampleRGBA returns the pixel at (dx, dy) of the dstW x dstH image that
+// RGBA would make from src, reading only the source pixels under it. It
+// returns the zero color when the sizes are invalid or (dx, dy) is outside
+// of the destination.
+func SampleRGBA(src *image.RGBA, dstW int, dstH int, dx int, dy int) color.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dstW <= 0 || dstH <= 0 || sw < dstW || sh < dstH {
+		return color.RGBA{}
+	}
+	if dx < 0 || dy < 0 || dx >= dstW || dy >= dstH {
+		return color.RGBA{}
+	}
+	if checkPix("src", src.Pix, src.Stride, src.Rect, 4) != nil {
+		return color.RGBA{}
+	}
+	xs, xw, xdiv, err := sampleTaps(sw, dstW, dx)
+	if err != nil {
+		return color.RGBA{}
+	}
+	ys, yw, ydiv, err := sampleTaps(sh, dstH, dy)
+	if err != nil {
+		return color.RGBA{}
+	}
+
+	// the horizontal pass writes one column of 8-bit pixels, which the
+	// vertical pass then reads like RGBA does with its intermediate image.
+	col := make([]byte, len(ys)<<2)
+	for i, y := range ys {
+		row := src.Pix[y*src.Stride:]
+		if xw == nil {
+			copy(col[i<<2:i<<2+4], row[xs[0]<<2:])
+			continue
+		}
+		var acc [4]uint32
+		for j, x := range xs {
+			accumulate8RGBA(acc[:], row[x<<2:x<<2+4], xw[j])
+		}
+		store8RGBA(col[i<<2:i<<2+4], acc[:], xdiv, RoundDefault)
+	}
+	if yw == nil {
+		return color.RGBA{col[0], col[1], col[2], col[3]}
+	}
+	var acc [4]uint32
+	for i := range ys {
+		accumulate8RGBA(acc[:], col[i<<2:i<<2+4], yw[i])
+	}
+	var d [4]byte
+	store8RGBA(d[:], acc[:], ydiv, RoundDefault)
+	return color.RGBA{d[0], d[1], d[2], d[3]}
+}
+
+// sampleTaps returns the source indices that destination index d of a
+// sl to dl box filter covers, with their weights and the dlcmlen that their
+// sum is divided by. The weights are nil when sl equals dl, as the pixel is
+// then copied.
+func sampleTaps(sl int, dl int, d int) ([]int, []uint32, uint32, error) {
+	if sl == dl {
+		return []int{d}, nil, 0, nil
+	}
+	if !sumFits(sl, dl, peak8RGBA) {
+		return nil, nil, 0, ErrTooLarge
+	}
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(uint32(sl), uint32(dl))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	var fr uint32
+	if d > 0 {
+		fr = ft[d-1]
+	}
+	tl, tr := tt[d], tt[d+1]
+	idx := []int{int(tl)}
+	w := []uint32{slcmlen - fr}
+	for i := tl + 1; i < tr; i++ {
+		idx = append(idx, int(i))
+		w = append(w, slcmlen)
+	}
+	if fr = ft[d]; fr != 0 {
+		idx = append(idx, int(tr))
+		w = append(w, fr)
+	}
+	return idx, w, dlcmlen, nil
+}
@@ -0,0 +1,38 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestSampleRGBA(t *testing.T) {
+	ctx := context.Background()
+	translucent := image.NewRGBA(image.Rect(0, 0, 53, 41))
+	draw.Draw(translucent, translucent.Rect, testPattern(53, 41), image.Point{}, draw.Src)
+	opaque := image.NewRGBA(translucent.Rect)
+	draw.Draw(opaque, opaque.Rect, image.Opaque, image.Point{}, draw.Src)
+	draw.Draw(opaque, opaque.Rect, testPattern(53, 41), image.Point{}, draw.Over)
+	sub := translucent.SubImage(image.Rect(3, 5, 50, 40)).(*image.RGBA)
+	for _, src := range []*image.RGBA{translucent, opaque, sub} {
+		sw, sh := src.Rect.Dx(), src.Rect.Dy()
+		for _, size := range [][2]int{{17, 13}, {sw, 9}, {11, sh}, {sw, sh}, {1, 1}} {
+			dest := image.NewRGBA(image.Rect(0, 0, size[0], size[1]))
+			if err := RGBA(ctx, dest, src); err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < size[1]; y++ {
+				for x := 0; x < size[0]; x++ {
+					if want, got := dest.RGBAAt(x, y), SampleRGBA(src, size[0], size[1], x, y); want != got {
+						t.Fatalf("%v (%d, %d): want %v, got %v", size, x, y, want, got)
+					}
+				}
+			}
+		}
+	}
+	if got := SampleRGBA(opaque, 10, 10, 10, 0); got != (color.RGBA{}) {
+		t.Errorf("want the zero color outside of dest, got %v", got)
+	}
+}
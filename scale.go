@@ -0,0 +1,158 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+)
+
+func Scale(ctx context.Context, dest draw.Image, src image.Image, opts ...Option) error {
+	sr := src.Bounds()
+	if _, ok := src.(*image.Uniform); ok {
+		// a uniform source has no pixels to read, only a huge bounds.
+		sr = image.Rectangle{}
+	}
+	return metered(ctx, opts, sr, dest.Bounds(), func(ctx context.Context) error {
+		return scale(ctx, dest, src, opts)
+	})
+}
+
+func scale(ctx context.Context, dest draw.Image, src image.Image, opts []Option) error {
+	if u, ok := src.(*image.Uniform); ok {
+		if dest.Bounds().Empty() {
+			return ErrInvalidSize
+		}
+		draw.Draw(dest, dest.Bounds(), u, image.Point{}, draw.Src)
+		return nil
+	}
+	switch d := dest.(type) {
+	case *image.RGBA:
+		switch s := src.(type) {
+		case *image.RGBA:
+			// the box filter truncates translucent premultiplied colors, so
+			// only the solid colors it keeps exactly are filled.
+			if solid(s.Pix, s.Stride, s.Rect, 4) {
+				if c := s.Pix[:4]; c[3] == 255 || c[0]|c[1]|c[2]|c[3] == 0 {
+					return fill(d.Pix, d.Stride, d.Rect, s.Rect, c)
+				}
+			}
+			return RGBA(ctx, d, s, opts...)
+		case *image.YCbCr:
+			return YCbCr(ctx, d, s, opts...)
+		}
+	case *image.NRGBA:
+		switch s := src.(type) {
+		case *image.NRGBA:
+			if solid(s.Pix, s.Stride, s.Rect, 4) {
+				// fully transparent pixels come out as zero whatever their color.
+				c := s.Pix[:4]
+				if c[3] == 0 {
+					c = []byte{0, 0, 0, 0}
+				}
+				return fill(d.Pix, d.Stride, d.Rect, s.Rect, c)
+			}
+			return NRGBA(ctx, d, s, opts...)
+		case *image.NYCbCrA:
+			return NYCbCrA(ctx, d, s, opts...)
+		}
+	case *image.RGBA64:
+		if s, ok := src.(*image.RGBA64); ok {
+			return RGBA64(ctx, d, s, opts...)
+		}
+	case *image.NRGBA64:
+		if s, ok := src.(*image.NRGBA64); ok {
+			return NRGBA64(ctx, d, s, opts...)
+		}
+	case *image.Gray:
+		if s, ok := src.(*image.Gray); ok {
+			if solid(s.Pix, s.Stride, s.Rect, 1) {
+				return fill(d.Pix, d.Stride, d.Rect, s.Rect, s.Pix[:1])
+			}
+			return Gray(ctx, d, s, opts...)
+		}
+	case *image.Alpha:
+		if s, ok := src.(*image.Alpha); ok {
+			return Alpha(ctx, d, s, opts...)
+		}
+	case *image.Alpha16:
+		if s, ok := src.(*image.Alpha16); ok {
+			return Alpha16(ctx, d, s, opts...)
+		}
+	case *image.Paletted:
+		if s, ok := src.(*image.Paletted); ok {
+			return Paletted(ctx, d, s, opts...)
+		}
+	case *image.Gray16:
+		if s, ok := src.(*image.Gray16); ok {
+			return Gray16(ctx, d, s, opts...)
+		}
+	case *image.CMYK:
+		if s, ok := src.(*image.CMYK); ok {
+			return CMYK(ctx, d, s, opts...)
+		}
+	}
+	return scaleGeneric(ctx, dest, src, opts...)
+}
+
+// solid reports whether every pixel of the image in pix has the same value.
+// It stops at the first row that differs, so it is cheap for most images.
+func solid(pix []byte, stride int, r image.Rectangle, bpp int) bool {
+	if r.Empty() || checkPix("src", pix, stride, r, bpp) != nil {
+		return false
+	}
+	w := r.Dx() * bpp
+	row := pix[:w]
+	for i := bpp; i < w; i++ {
+		if row[i] != row[i-bpp] {
+			return false
+		}
+	}
+	for y := 1; y < r.Dy(); y++ {
+		if !bytes.Equal(pix[y*stride:y*stride+w], row) {
+			return false
+		}
+	}
+	return true
+}
+
+// fill sets every pixel of the dest image in pix to px after the size checks
+// of the downscaling functions, which produce px for a solid source of size
+// sr.
+func fill(pix []byte, stride int, dr image.Rectangle, sr image.Rectangle, px []byte) error {
+	if err := checkPix("dest", pix, stride, dr, len(px)); err != nil {
+		return err
+	}
+	sw, sh := sr.Dx(), sr.Dy()
+	dw, dh := dr.Dx(), dr.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !lcmFits(sw, dw) || !lcmFits(sh, dh) {
+		return ErrTooLarge
+	}
+	w := dw * len(px)
+	row := pix[:w]
+	for i := 0; i < w; i += len(px) {
+		copy(row[i:], px)
+	}
+	for y := 1; y < dh; y++ {
+		copy(pix[y*stride:y*stride+w], row)
+	}
+	return nil
+}
+
+func scaleGeneric(ctx context.Context, dest draw.Image, src image.Image, opts ...Option) error {
+	sr, dr := src.Bounds(), dest.Bounds()
+	tmpSrc := image.NewRGBA64(image.Rect(0, 0, sr.Dx(), sr.Dy()))
+	draw.Draw(tmpSrc, tmpSrc.Rect, src, sr.Min, draw.Src)
+	tmpDest := image.NewRGBA64(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	if err := RGBA64(ctx, tmpDest, tmpSrc, opts...); err != nil {
+		return err
+	}
+	draw.Draw(dest, dr, tmpDest, image.Point{}, draw.Src)
+	return nil
+}
@@ -0,0 +1,299 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+func testPattern(w int, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(x * 255 / w),
+				G: uint8(y * 255 / h),
+				B: uint8((x ^ y) & 0xff),
+				A: uint8(255 - (x+y)&0x7f),
+			})
+		}
+	}
+	return img
+}
+
+func TestScale(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testPattern(90, 60)); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, ok := decoded.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("unexpected decoded type %T", decoded)
+	}
+
+	ctx := context.Background()
+	got := image.NewNRGBA(image.Rect(0, 0, 31, 17))
+	if err := Scale(ctx, got, src); err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewNRGBA(got.Rect)
+	if err := NRGBA(ctx, want, src); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("Scale result differs from NRGBA")
+	}
+
+	gray := image.NewGray(src.Rect)
+	draw.Draw(gray, gray.Rect, src, image.Point{}, draw.Src)
+	gotGray := image.NewGray(got.Rect)
+	if err := Scale(ctx, gotGray, gray); err != nil {
+		t.Fatal(err)
+	}
+	wantGray := image.NewGray(got.Rect)
+	if err := Gray(ctx, wantGray, gray); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotGray.Pix, wantGray.Pix) {
+		t.Error("Scale result differs from Gray")
+	}
+}
+
+func TestScaleGeneric(t *testing.T) {
+	src := image.NewCMYK(image.Rect(0, 0, 8, 8))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	if err := Scale(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			var r, g, b uint32
+			for i := 0; i < 4; i++ {
+				sr, sg, sb, _ := src.At(x*2+i&1, y*2+i>>1).RGBA()
+				r, g, b = r+sr, g+sg, b+sb
+			}
+			want := color.RGBA{uint8((r + 2) / 4 >> 8), uint8((g + 2) / 4 >> 8), uint8((b + 2) / 4 >> 8), 255}
+			if got := dest.RGBAAt(x, y); got != want {
+				t.Errorf("(%d, %d): want %v, got %v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestScaleUniform(t *testing.T) {
+	c := color.NRGBA{R: 10, G: 200, B: 30, A: 128}
+	dest := image.NewNRGBA(image.Rect(0, 0, 7, 5))
+	if err := Scale(context.Background(), dest, image.NewUniform(c)); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 7; x++ {
+			if got := dest.NRGBAAt(x, y); got != c {
+				t.Errorf("(%d, %d): want %v, got %v", x, y, c, got)
+			}
+		}
+	}
+	if err := Scale(context.Background(), image.NewNRGBA(image.Rectangle{}), image.NewUniform(c)); err != ErrInvalidSize {
+		t.Errorf("empty dest: want ErrInvalidSize, got %v", err)
+	}
+}
+
+func TestScaleSolid(t *testing.T) {
+	ctx := context.Background()
+	sr, dr := image.Rect(0, 0, 37, 23), image.Rect(0, 0, 11, 7)
+	for _, c := range []color.NRGBA{{10, 200, 30, 255}, {10, 200, 30, 77}, {10, 200, 30, 0}} {
+		src := image.NewNRGBA(sr)
+		draw.Draw(src, sr, image.NewUniform(c), image.Point{}, draw.Src)
+		got, want := image.NewNRGBA(dr), image.NewNRGBA(dr)
+		if err := Scale(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		if err := NRGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("NRGBA %v: want %v, got %v", c, want.Pix[:4], got.Pix[:4])
+		}
+
+		rsrc := image.NewRGBA(sr)
+		draw.Draw(rsrc, sr, image.NewUniform(c), image.Point{}, draw.Src)
+		rgot, rwant := image.NewRGBA(dr), image.NewRGBA(dr)
+		if err := Scale(ctx, rgot, rsrc); err != nil {
+			t.Fatal(err)
+		}
+		if err := RGBA(ctx, rwant, rsrc); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rgot.Pix, rwant.Pix) {
+			t.Errorf("RGBA %v: want %v, got %v", c, rwant.Pix[:4], rgot.Pix[:4])
+		}
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	if err := Scale(ctx, image.NewNRGBA(image.Rect(0, 0, 8, 8)), src); err != ErrUpscaleUnsupported {
+		t.Errorf("upscale: want ErrUpscaleUnsupported, got %v", err)
+	}
+}
+
+func TestScaleSubImage(t *testing.T) {
+	ctx := context.Background()
+	pattern := testPattern(64, 48)
+	r := image.Rect(10, 7, 50, 37)
+	for _, newImage := range []func(r image.Rectangle) draw.Image{
+		func(r image.Rectangle) draw.Image { return image.NewRGBA(r) },
+		func(r image.Rectangle) draw.Image { return image.NewNRGBA(r) },
+		func(r image.Rectangle) draw.Image { return image.NewRGBA64(r) },
+		func(r image.Rectangle) draw.Image { return image.NewNRGBA64(r) },
+		func(r image.Rectangle) draw.Image { return image.NewGray(r) },
+		func(r image.Rectangle) draw.Image { return image.NewGray16(r) },
+		func(r image.Rectangle) draw.Image { return image.NewAlpha(r) },
+	} {
+		full := newImage(pattern.Rect)
+		draw.Draw(full, full.Bounds(), pattern, image.Point{}, draw.Src)
+		sub := full.(interface {
+			SubImage(r image.Rectangle) image.Image
+		}).SubImage(r)
+		cp := newImage(r)
+		draw.Draw(cp, r, full, r.Min, draw.Src)
+		for _, size := range []image.Point{{13, 30}, {40, 11}, {13, 11}} {
+			want := newImage(image.Rect(0, 0, size.X, size.Y))
+			if err := Scale(ctx, want, cp); err != nil {
+				t.Fatal(err)
+			}
+			got := newImage(want.Bounds())
+			if err := Scale(ctx, got, sub); err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < size.Y; y++ {
+				for x := 0; x < size.X; x++ {
+					if w, g := want.At(x, y), got.At(x, y); w != g {
+						t.Fatalf("%T %v (%d, %d): want %v, got %v", full, size, x, y, w, g)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOnePixel(t *testing.T) {
+	ctx := context.Background()
+	for _, sz := range []image.Point{{1, 1}, {1, 7}, {9, 1}, {13, 11}} {
+		src := image.NewGray(image.Rect(0, 0, sz.X, sz.Y))
+		sum := 0
+		for i := range src.Pix {
+			src.Pix[i] = uint8(i * 37)
+			sum += int(src.Pix[i])
+		}
+		n := sz.X * sz.Y
+		want := uint8((sum + n/2) / n)
+
+		// the sizes between src and 1x1 check a 1 pixel length on either
+		// side alone.
+		for _, dsz := range []image.Point{{1, 1}, {1, sz.Y}, {sz.X, 1}} {
+			for _, c := range []int{1, 64} {
+				dest := image.NewGray(image.Rect(0, 0, dsz.X, dsz.Y))
+				if err := Gray(ctx, dest, src, WithConcurrency(c)); err != nil {
+					t.Fatalf("%v to %v: %v", sz, dsz, err)
+				}
+				if dsz == (image.Point{1, 1}) && dest.Pix[0] != want {
+					t.Errorf("%v to 1x1: want %d, got %d", sz, want, dest.Pix[0])
+				}
+
+				rgba := image.NewRGBA(src.Rect)
+				for i, v := range src.Pix {
+					copy(rgba.Pix[i*4:], []uint8{v, v, v, 255})
+				}
+				for fi, f := range []func(context.Context, *image.RGBA, *image.RGBA, ...Option) error{RGBA, RGBAOpaque, RGBAFlipV} {
+					got := image.NewRGBA(dest.Rect)
+					if err := f(ctx, got, rgba, WithConcurrency(c)); err != nil {
+						t.Fatalf("%v to %v: %v", sz, dsz, err)
+					}
+					if fi == 2 {
+						flipped := image.NewRGBA(got.Rect)
+						copyRGBA(flipped, got, true)
+						got = flipped
+					}
+					for i := range dest.Pix {
+						if d := int(dest.Pix[i]) - int(got.Pix[i*4]); d < -1 || d > 1 || got.Pix[i*4+3] != 255 {
+							t.Fatalf("#%d %v to %v, #%d: want %d, got %v", fi, sz, dsz, i, dest.Pix[i], got.Pix[i*4:i*4+4])
+						}
+					}
+				}
+				nrgba := image.NewNRGBA(src.Rect)
+				copy(nrgba.Pix, rgba.Pix)
+				gotN := image.NewNRGBA(dest.Rect)
+				if err := NRGBA(ctx, gotN, nrgba, WithConcurrency(c)); err != nil {
+					t.Fatalf("%v to %v: %v", sz, dsz, err)
+				}
+				for i := range dest.Pix {
+					if gotN.Pix[i*4] != dest.Pix[i] {
+						t.Fatalf("NRGBA %v to %v, #%d: want %d, got %d", sz, dsz, i, dest.Pix[i], gotN.Pix[i*4])
+					}
+				}
+			}
+		}
+	}
+
+	src := image.NewGray(image.Rect(0, 0, 1, 9))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 30)
+	}
+	for _, dest := range []draw.Image{
+		image.NewGray16(image.Rect(0, 0, 1, 1)),
+		image.NewRGBA64(image.Rect(0, 0, 1, 1)),
+		image.NewNRGBA64(image.Rect(0, 0, 1, 1)),
+		image.NewCMYK(image.Rect(0, 0, 1, 1)),
+	} {
+		// the sources are of the same type as dest to take its own path.
+		sImg := newLike(dest, src.Rect)
+		draw.Draw(sImg, sImg.Bounds(), src, image.Point{}, draw.Src)
+		if err := Scale(ctx, dest, sImg); err != nil {
+			t.Fatalf("%T: %v", dest, err)
+		}
+		if got := color.GrayModel.Convert(dest.At(0, 0)).(color.Gray).Y; got < 119 || got > 121 {
+			t.Errorf("%T: want 120, got %d", dest, got)
+		}
+	}
+
+	rs, err := NewRowScaler(1, 5, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []uint8{10, 20, 30, 40, 50} {
+		if err := rs.WriteRow([]byte{v, v, v, 255}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	row := make([]byte, 4)
+	if ok, err := rs.ReadRow(row); !ok || err != nil || row[0] != 30 {
+		t.Errorf("RowScaler: want 30, got %v (%v, %v)", row, ok, err)
+	}
+	if got := SampleRGBA(image.NewRGBA(image.Rect(0, 0, 1, 1)), 1, 1, 0, 0); got != (color.RGBA{}) {
+		t.Errorf("SampleRGBA: want zero, got %v", got)
+	}
+}
+
+func newLike(img draw.Image, r image.Rectangle) draw.Image {
+	switch img.(type) {
+	case *image.Gray16:
+		return image.NewGray16(r)
+	case *image.RGBA64:
+		return image.NewRGBA64(r)
+	case *image.NRGBA64:
+		return image.NewNRGBA64(r)
+	case *image.CMYK:
+		return image.NewCMYK(r)
+	}
+	panic("unsupported image type")
+}
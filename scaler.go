@@ -0,0 +1,294 @@
+package downscale
+
+import (
+	"context"
+	"errors"
+	"image"
+)
+
+// Scaler downscales images of a fixed size while keeping its intermediate
+// buffers and tables for the next call.
+// A Scaler must not be used concurrently.
+type Scaler struct {
+	sw, sh, dw, dh int
+	o              options
+
+	horz, vert *WeightTable
+	t8         *[256]uint16
+	t16        *[65536]uint8
+
+	src16, tmp16, dest16 *u16NRGBA
+	tmp8                 *image.RGBA
+}
+
+func NewScaler(srcW int, srcH int, dstW int, dstH int, opts ...Option) (*Scaler, error) {
+	if srcW <= 0 || srcH <= 0 || dstW <= 0 || dstH <= 0 {
+		return nil, ErrInvalidSize
+	}
+	if srcW < dstW || srcH < dstH {
+		return nil, ErrUpscaleUnsupported
+	}
+	if !lcmFits(srcW, dstW) || !lcmFits(srcH, dstH) {
+		return nil, ErrTooLarge
+	}
+	s := newScaler(srcW, srcH, dstW, dstH)
+	for _, opt := range opts {
+		opt(&s.o)
+	}
+	if err := checkGamma(s.o.gamma); err != nil {
+		return nil, err
+	}
+	s.t8, s.t16 = getGammaTable(s.o.gamma)
+	s.tables()
+	s.buffers16()
+	return s, nil
+}
+
+// NewGammaScaler is NewScaler with WithGamma(gamma). Its RGBAGamma and
+// NRGBAGamma reuse the gamma tables and the 16-bit intermediate images
+// allocated here, so keeping one Scaler per goroutine downscales without
+// allocating on every call.
+func NewGammaScaler(srcW int, srcH int, dstW int, dstH int, gamma float64, opts ...Option) (*Scaler, error) {
+	return NewScaler(srcW, srcH, dstW, dstH, append(opts[:len(opts):len(opts)], WithGamma(gamma))...)
+}
+
+func newScaler(sw int, sh int, dw int, dh int) *Scaler {
+	return &Scaler{sw: sw, sh: sh, dw: dw, dh: dh, o: defaultOptions()}
+}
+
+func (s *Scaler) check(dest *image.RGBA, src *image.RGBA) error {
+	return s.checkPix(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect)
+}
+
+func (s *Scaler) checkPix(dPix []byte, dStride int, dr image.Rectangle, sPix []byte, sStride int, sr image.Rectangle) error {
+	if err := checkPix("dest", dPix, dStride, dr, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", sPix, sStride, sr, 4); err != nil {
+		return err
+	}
+	if sr.Dx() != s.sw || sr.Dy() != s.sh || dr.Dx() != s.dw || dr.Dy() != s.dh {
+		return errors.New("downscale: image size does not match the Scaler")
+	}
+	if s.sw <= 0 || s.sh <= 0 || s.dw <= 0 || s.dh <= 0 {
+		return ErrInvalidSize
+	}
+	if s.sw < s.dw || s.sh < s.dh {
+		return ErrUpscaleUnsupported
+	}
+	if !lcmFits(s.sw, s.dw) || !lcmFits(s.sh, s.dh) {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+func (s *Scaler) tables() (*WeightTable, *WeightTable) {
+	if s.horz == nil && s.sw != s.dw {
+		s.horz = NewWeightTable(uint32(s.sw), uint32(s.dw))
+	}
+	if s.vert == nil && s.sh != s.dh {
+		s.vert = NewWeightTable(uint32(s.sh), uint32(s.dh))
+	}
+	return s.horz, s.vert
+}
+
+func (s *Scaler) buffers16() (*u16NRGBA, *u16NRGBA, *u16NRGBA) {
+	if s.src16 == nil {
+		s.src16 = &u16NRGBA{
+			Pix:  make([]uint16, (s.sw<<2)*s.sh),
+			Rect: image.Rect(0, 0, s.sw, s.sh),
+		}
+		s.dest16 = &u16NRGBA{
+			Pix:  make([]uint16, (s.dw<<2)*s.dh),
+			Rect: image.Rect(0, 0, s.dw, s.dh),
+		}
+		if s.sw != s.dw && s.sh != s.dh {
+			s.tmp16 = &u16NRGBA{
+				Pix:  make([]uint16, (s.dw<<2)*s.sh),
+				Rect: image.Rect(0, 0, s.dw, s.sh),
+			}
+		}
+	}
+	return s.src16, s.tmp16, s.dest16
+}
+
+// RGBA is the package-level RGBA with the tables and the intermediate image
+// of s reused across calls.
+func (s *Scaler) RGBA(ctx context.Context, dest *image.RGBA, src *image.RGBA) error {
+	if err := s.check(dest, src); err != nil {
+		return err
+	}
+	if !sumFits(s.sw, s.dw, peak8RGBA) || !sumFits(s.sh, s.dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	if s.sw == s.dw && s.sh == s.dh {
+		for y := 0; y < s.sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+s.dw<<2], src.Pix[y*src.Stride:y*src.Stride+s.sw<<2])
+		}
+		return nil
+	}
+	horz, vert := s.tables()
+	if horz != nil && vert != nil && s.tmp8 == nil {
+		s.tmp8 = image.NewRGBA(image.Rect(0, 0, s.dw, s.sh))
+	}
+	var h handle
+	h.wg.Add(1)
+	go func() {
+		defer h.Done()
+		switch {
+		case horz != nil && vert != nil:
+			h.pass(horz8RGBATable(ctx, s.tmp8, src, horz, false, &s.o))
+			if h.Aborted() {
+				return
+			}
+			h.pass(vert8RGBATable(ctx, dest, s.tmp8, vert, false, false, &s.o))
+		case horz != nil:
+			h.pass(horz8RGBATable(ctx, dest, src, horz, false, &s.o))
+		default:
+			h.pass(vert8RGBATable(ctx, dest, src, vert, false, false, &s.o))
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// Intermediate returns the dstW x srcH image that the last call of RGBA
+// wrote between its horizontal and vertical passes. It is nil until then,
+// and stays nil when only one direction is scaled. The next call of RGBA
+// overwrites it.
+func (s *Scaler) Intermediate() *image.RGBA {
+	return s.tmp8
+}
+
+func (s *Scaler) RGBAGamma(ctx context.Context, dest *image.RGBA, src *image.RGBA) error {
+	if err := s.check(dest, src); err != nil {
+		return err
+	}
+	if s.sw == s.dw && s.sh == s.dh {
+		for y := 0; y < s.sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+s.dw<<2], src.Pix[y*src.Stride:y*src.Stride+s.sw<<2])
+		}
+		return nil
+	}
+	t16 := s.t16
+	return s.rgbaLinear(ctx, dest, src, func(d []byte, s []uint16) {
+		encodeGammaRGBA(d, s, t16)
+	})
+}
+
+// rgbaLinear linearizes src with s.t8, downscales it in linear light and
+// hands the straight-alpha 16-bit result to encode one row at a time.
+func (s *Scaler) rgbaLinear(ctx context.Context, dest *image.RGBA, src *image.RGBA, encode func(d []byte, s []uint16)) error {
+	if err := s.check(dest, src); err != nil {
+		return err
+	}
+
+	h := handle{every: s.o.abortEvery()}
+	h.wg.Add(1)
+	go func() {
+		defer h.Done()
+
+		tmpSrc, tmp, tmpDest := s.buffers16()
+		horz, vert := s.tables()
+		t8 := s.t8
+
+		swx4 := s.sw << 2
+		for y := 0; y < s.sh; y++ {
+			if h.abortedAt(uint32(y)) {
+				return
+			}
+			s, d := src.Pix[y*src.Stride:y*src.Stride+swx4], tmpSrc.Pix[y*swx4:(y+1)*swx4]
+			var a uint32
+			for i := 0; i < len(d); i += 4 {
+				if a = uint32(s[i+3]); a == 255 {
+					d[i+3] = 65535
+					d[i+0] = t8[s[i+0]]
+					d[i+1] = t8[s[i+1]]
+					d[i+2] = t8[s[i+2]]
+				} else if a > 0 {
+					d[i+3] = uint16(a * 0x101)
+					d[i+0] = t8[divTable[(uint32(s[i+0])<<8)+a]]
+					d[i+1] = t8[divTable[(uint32(s[i+1])<<8)+a]]
+					d[i+2] = t8[divTable[(uint32(s[i+2])<<8)+a]]
+				} else {
+					d[i+3] = 0
+					d[i+0] = 0
+					d[i+1] = 0
+					d[i+2] = 0
+				}
+			}
+		}
+
+		if s.sw == s.dw && s.sh == s.dh {
+			copy(tmpDest.Pix, tmpSrc.Pix)
+		} else if !downscale16NRGBA(ctx, &h, tmpDest, tmpSrc, tmp, horz, vert, &s.o) {
+			return
+		}
+
+		dwx4 := s.dw << 2
+		for y := 0; y < s.dh; y++ {
+			if h.abortedAt(uint32(y)) {
+				return
+			}
+			encode(dest.Pix[y*dest.Stride:y*dest.Stride+dwx4], tmpDest.Pix[y*dwx4:(y+1)*dwx4])
+		}
+	}()
+	return h.Wait(ctx)
+}
+
+// NRGBAGamma is the package-level NRGBAGamma with the gamma of s and its
+// tables and intermediate images reused across calls.
+func (s *Scaler) NRGBAGamma(ctx context.Context, dest *image.NRGBA, src *image.NRGBA) error {
+	if err := s.checkPix(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect); err != nil {
+		return err
+	}
+	t8, t16 := s.t8, s.t16
+	return s.nrgbaGamma(ctx, dest, src, [3]*[256]uint16{t8, t8, t8}, tableEncoder([3]*[65536]uint8{t16, t16, t16}))
+}
+
+// nrgbaGamma decodes src with t8, downscales it in linear light and hands
+// the 16-bit result to encode one row at a time.
+func (s *Scaler) nrgbaGamma(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, t8 [3]*[256]uint16, encode func(d []byte, s []uint16)) error {
+	if s.sw == s.dw && s.sh == s.dh {
+		for y := 0; y < s.sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+s.dw<<2], src.Pix[y*src.Stride:y*src.Stride+s.sw<<2])
+		}
+		return nil
+	}
+
+	h := handle{every: s.o.abortEvery()}
+	h.wg.Add(1)
+	go func() {
+		defer h.Done()
+
+		tmpSrc, tmp, tmpDest := s.buffers16()
+		horz, vert := s.tables()
+
+		swx4 := s.sw << 2
+		r8, g8, b8 := t8[0], t8[1], t8[2]
+		for y := 0; y < s.sh; y++ {
+			if h.abortedAt(uint32(y)) {
+				return
+			}
+			s, d := src.Pix[y*src.Stride:y*src.Stride+swx4], tmpSrc.Pix[y*swx4:(y+1)*swx4]
+			for i := 0; i < len(d); i += 4 {
+				d[i+3] = uint16(s[i+3]) * 0x101
+				d[i+0] = r8[s[i+0]]
+				d[i+1] = g8[s[i+1]]
+				d[i+2] = b8[s[i+2]]
+			}
+		}
+
+		if !downscale16NRGBA(ctx, &h, tmpDest, tmpSrc, tmp, horz, vert, &s.o) {
+			return
+		}
+
+		dwx4 := s.dw << 2
+		for y := 0; y < s.dh; y++ {
+			if h.abortedAt(uint32(y)) {
+				return
+			}
+			encode(dest.Pix[y*dest.Stride:y*dest.Stride+dwx4], tmpDest.Pix[y*dwx4:(y+1)*dwx4])
+		}
+	}()
+	return h.Wait(ctx)
+}
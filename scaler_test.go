@@ -0,0 +1,189 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func TestScalerRGBAGamma(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			i := src.PixOffset(x, y)
+			a := uint8(255 - x*4)
+			src.Pix[i+0] = uint8(int(a) * x / 30)
+			src.Pix[i+1] = uint8(int(a) * y / 20)
+			src.Pix[i+2] = a / 2
+			src.Pix[i+3] = a
+		}
+	}
+	want := image.NewRGBA(image.Rect(0, 0, 7, 6))
+	if err := RGBAGamma(ctx, want, src, 2.2); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewScaler(30, 20, 7, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got := image.NewRGBA(image.Rect(0, 0, 7, 6))
+		if err := s.RGBAGamma(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("#%d: want %v, got %v", i, want.Pix, got.Pix)
+		}
+	}
+}
+
+func TestScalerRGBAGammaTransparent(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewScaler(8, 8, 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	if err := s.RGBAGamma(ctx, dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for i := range src.Pix {
+		src.Pix[i] = 0
+	}
+	if err := s.RGBAGamma(ctx, dest, src); err != nil {
+		t.Fatal(err)
+	}
+	if want := make([]byte, len(dest.Pix)); !bytes.Equal(want, dest.Pix) {
+		t.Errorf("want %v, got %v", want, dest.Pix)
+	}
+}
+
+func TestScalerSizeMismatch(t *testing.T) {
+	s, err := NewScaler(30, 20, 7, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	dest := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	if err := s.RGBAGamma(context.Background(), dest, src); err == nil {
+		t.Fatal("want error, got nil")
+	}
+}
+
+func TestNewScalerUpscale(t *testing.T) {
+	if _, err := NewScaler(4, 4, 8, 4); err == nil {
+		t.Fatal("want error, got nil")
+	}
+}
+
+func TestScalerRGBA(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(src, src.Rect, testPattern(64, 48), image.Point{}, draw.Src)
+	s, err := NewScaler(64, 48, 23, 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Intermediate() != nil {
+		t.Error("want no intermediate before the first call")
+	}
+	want := image.NewRGBA(image.Rect(0, 0, 23, 17))
+	if err := RGBA(ctx, want, src); err != nil {
+		t.Fatal(err)
+	}
+	var last *image.RGBA
+	for i := 0; i < 2; i++ {
+		got := image.NewRGBA(want.Rect)
+		if err := s.RGBA(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("call %d: differs from RGBA", i)
+		}
+		tmp := s.Intermediate()
+		if tmp == nil {
+			t.Fatal("want an intermediate image")
+		}
+		if tmp.Rect.Dx() != 23 || tmp.Rect.Dy() != 48 {
+			t.Errorf("want 23x48, got %dx%d", tmp.Rect.Dx(), tmp.Rect.Dy())
+		}
+		if bytes.Count(tmp.Pix, []byte{0}) == len(tmp.Pix) {
+			t.Error("want the intermediate to hold the horizontal pass")
+		}
+		if last != nil && last != tmp {
+			t.Error("want the intermediate to be reused")
+		}
+		last = tmp
+	}
+}
+
+func TestGammaScalerNRGBAGamma(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	draw.Draw(src, src.Rect, testPattern(30, 20), image.Point{}, draw.Src)
+	want := image.NewNRGBA(image.Rect(0, 0, 7, 6))
+	if err := NRGBAGamma(ctx, want, src, 1.8); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewGammaScaler(30, 20, 7, 6, 1.8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got := image.NewNRGBA(want.Rect)
+		if err := s.NRGBAGamma(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("#%d: want %v, got %v", i, want.Pix, got.Pix)
+		}
+	}
+	if _, err := NewGammaScaler(30, 20, 7, 6, 0); err != ErrInvalidGamma {
+		t.Errorf("want ErrInvalidGamma, got %v", err)
+	}
+}
+
+func TestGammaScalerTransparent(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewGammaScaler(8, 8, 3, 3, 2.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opaque := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 255
+	}
+	transparent := image.NewNRGBA(opaque.Rect)
+	want := make([]byte, 3*3*4)
+
+	dest := image.NewNRGBA(image.Rect(0, 0, 3, 3))
+	if err := s.NRGBAGamma(ctx, dest, opaque); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.NRGBAGamma(ctx, dest, transparent); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, dest.Pix) {
+		t.Errorf("NRGBAGamma: want %v, got %v", want, dest.Pix)
+	}
+
+	rdest := image.NewRGBA(dest.Rect)
+	if err := s.RGBAGamma(ctx, rdest, (*image.RGBA)(opaque)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RGBAGamma(ctx, rdest, (*image.RGBA)(transparent)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, rdest.Pix) {
+		t.Errorf("RGBAGamma: want %v, got %v", want, rdest.Pix)
+	}
+}
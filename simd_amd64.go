@@ -0,0 +1,84 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package downscale
+
+var useAVX2 = hasAVX2()
+
+// divTablePad is divTable followed by one spare entry, because the AVX2
+// gather loads 32 bits for every 16-bit entry it looks up.
+var divTablePad [65537]uint16
+
+func init() {
+	if useAVX2 {
+		copy(divTablePad[:], divTable[:])
+	}
+}
+
+func cpuid(eaxArg uint32, ecxArg uint32) (eax uint32, ebx uint32, ecx uint32, edx uint32)
+func xgetbv() (eax uint32, edx uint32)
+
+func hasAVX2() bool {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return false
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	const osxsave, avx = 1 << 27, 1 << 28
+	if ecx1&osxsave == 0 || ecx1&avx == 0 {
+		return false
+	}
+	// the OS has to save the XMM and YMM registers.
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return false
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	return ebx7&(1<<5) != 0
+}
+
+//go:noescape
+func accumulate8RGBAAVX2(acc *uint32, row *byte, n int, w uint32, table *uint16)
+
+func accumulate8RGBA(acc []uint32, row []byte, w uint32) {
+	row = row[:len(acc)]
+	if useAVX2 {
+		// two pixels per iteration.
+		if n := len(acc) >> 3; n > 0 {
+			accumulate8RGBAAVX2(&acc[0], &row[0], n, w, &divTablePad[0])
+			acc, row = acc[n<<3:], row[n<<3:]
+		}
+	}
+	accumulate8RGBAGeneric(acc, row, w)
+}
+
+//go:noescape
+func horzTaps8RGBAAVX2(acc *uint32, buf *uint32, tt *uint32, ft *uint32, n int, slcmlen uint32)
+
+func horzTaps8RGBA(acc []uint32, buf []uint32, tt []uint32, ft []uint32, slcmlen uint32) {
+	n := len(acc) >> 2
+	if !useAVX2 || n == 0 {
+		horzTaps8RGBAGeneric(acc, buf, tt, ft, slcmlen)
+		return
+	}
+	// every tap the assembly reads has to be inside buf.
+	last := tt[n]
+	if ft[n-1] != 0 {
+		last++
+	}
+	_ = buf[last<<2-1]
+	horzTaps8RGBAAVX2(&acc[0], &buf[0], &tt[0], &ft[0], n, slcmlen)
+}
+
+//go:noescape
+func accumulate8AVX2(acc *uint32, row *byte, n int, w uint32)
+
+func accumulate8(acc []uint32, row []byte, w uint32) {
+	row = row[:len(acc)]
+	if useAVX2 {
+		if n := len(acc) >> 3; n > 0 {
+			accumulate8AVX2(&acc[0], &row[0], n, w)
+			acc, row = acc[n<<3:], row[n<<3:]
+		}
+	}
+	accumulate8Generic(acc, row, w)
+}
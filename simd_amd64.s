@@ -0,0 +1,150 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+#include "textflag.h"
+
+// func cpuid(eaxArg uint32, ecxArg uint32) (eax uint32, ebx uint32, ecx uint32, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax uint32, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// func accumulate8RGBAAVX2(acc *uint32, row *byte, n int, w uint32, table *uint16)
+//
+// For two pixels at a time it computes, like accumulate8RGBAGeneric,
+//   acc[c] += table[c<<8|a] * a * w  for the colors
+//   acc[3] += a * w                  for the alpha
+// A zero alpha makes a*w zero, so transparent pixels need no branch.
+TEXT ·accumulate8RGBAAVX2(SB), NOSPLIT, $0-40
+	MOVQ acc+0(FP), DI
+	MOVQ row+8(FP), SI
+	MOVQ n+16(FP), CX
+	MOVL w+24(FP), AX
+	MOVQ table+32(FP), R8
+
+	MOVQ         AX, X7
+	VPBROADCASTD X7, Y7 // w
+	MOVL         $0xffff, AX
+	MOVQ         AX, X6
+	VPBROADCASTD X6, Y6 // 16-bit mask
+	MOVL         $1, AX
+	MOVQ         AX, X5
+	VPBROADCASTD X5, Y5 // ones
+
+loop:
+	VPMOVZXBD (SI), Y0          // r0 g0 b0 a0 r1 g1 b1 a1
+	VPSHUFD   $0xff, Y0, Y1     // a0 x4, a1 x4
+	VPSLLD    $8, Y0, Y2
+	VPOR      Y1, Y2, Y2        // c<<8 | a
+	VPCMPEQD  Y3, Y3, Y3
+	VPXOR     Y4, Y4, Y4
+	VPGATHERDD Y3, (R8)(Y2*2), Y4
+	VPAND     Y6, Y4, Y4
+	VPBLENDD  $0x88, Y5, Y4, Y4 // the alpha lanes only take the weight
+	VPMULLD   Y7, Y1, Y1        // a * w
+	VPMULLD   Y1, Y4, Y4
+	VPADDD    (DI), Y4, Y4
+	VMOVDQU   Y4, (DI)
+	ADDQ      $8, SI
+	ADDQ      $32, DI
+	DECQ      CX
+	JNZ       loop
+
+	VZEROUPPER
+	RET
+
+// func horzTaps8RGBAAVX2(acc *uint32, buf *uint32, tt *uint32, ft *uint32, n int, slcmlen uint32)
+//
+// The same loop as horzTaps8RGBAGeneric with one pixel in each register.
+TEXT ·horzTaps8RGBAAVX2(SB), NOSPLIT, $0-44
+	MOVQ acc+0(FP), DI
+	MOVQ buf+8(FP), SI
+	MOVQ tt+16(FP), R8
+	MOVQ ft+24(FP), R9
+	MOVQ n+32(FP), CX
+	MOVL slcmlen+40(FP), R10
+
+	MOVQ         R10, X7
+	VPBROADCASTD X7, X7 // slcmlen
+	XORQ         BX, BX // x
+	XORQ         R11, R11 // fr of the previous pixel
+
+pixel:
+	MOVL (R8)(BX*4), AX  // tl
+	MOVL 4(R8)(BX*4), DX // tr
+	MOVL R10, R12
+	SUBL R11, R12        // fl
+	MOVL (R9)(BX*4), R11 // fr
+
+	MOVQ         AX, R13
+	SHLQ         $4, R13
+	MOVQ         R12, X1
+	VPBROADCASTD X1, X1
+	VPMULLD      (SI)(R13*1), X1, X0
+	ADDQ         $16, R13
+	INCL         AX
+
+middle:
+	CMPL    AX, DX
+	JAE     last
+	VPMULLD (SI)(R13*1), X7, X2
+	VPADDD  X2, X0, X0
+	ADDQ    $16, R13
+	INCL    AX
+	JMP     middle
+
+last:
+	TESTL        R11, R11
+	JZ           store
+	MOVQ         R11, X1
+	VPBROADCASTD X1, X1
+	VPMULLD      (SI)(R13*1), X1, X2
+	VPADDD       X2, X0, X0
+
+store:
+	VMOVDQU X0, (DI)
+	ADDQ    $16, DI
+	INCQ    BX
+	CMPQ    BX, CX
+	JB      pixel
+
+	VZEROUPPER
+	RET
+
+// func accumulate8AVX2(acc *uint32, row *byte, n int, w uint32)
+//
+// For eight bytes at a time it computes acc[i] += row[i] * w.
+TEXT ·accumulate8AVX2(SB), NOSPLIT, $0-28
+	MOVQ acc+0(FP), DI
+	MOVQ row+8(FP), SI
+	MOVQ n+16(FP), CX
+	MOVL w+24(FP), AX
+
+	MOVQ         AX, X1
+	VPBROADCASTD X1, Y1 // w
+
+loop:
+	VPMOVZXBD (SI), Y0
+	VPMULLD   Y1, Y0, Y0
+	VPADDD    (DI), Y0, Y0
+	VMOVDQU   Y0, (DI)
+	ADDQ      $8, SI
+	ADDQ      $32, DI
+	DECQ      CX
+	JNZ       loop
+
+	VZEROUPPER
+	RET
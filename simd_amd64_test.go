@@ -0,0 +1,115 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestAVX2MatchesGeneric(t *testing.T) {
+	if !useAVX2 {
+		t.Skip("AVX2 is not available")
+	}
+	rnd := rand.New(rand.NewSource(1))
+	src := image.NewRGBA(image.Rect(0, 0, 257, 193))
+	for i := 0; i < len(src.Pix); i += 4 {
+		a := uint8(rnd.Intn(256))
+		if rnd.Intn(4) == 0 {
+			a = 255 * uint8(rnd.Intn(2))
+		}
+		src.Pix[i+3] = a
+		for c := 0; c < 3; c++ {
+			src.Pix[i+c] = uint8(rnd.Intn(int(a) + 1))
+		}
+	}
+
+	defer func() { useAVX2 = true }()
+	for _, size := range []image.Point{{100, 100}, {257, 3}, {3, 193}, {1, 1}, {255, 190}, {64, 48}} {
+		useAVX2 = false
+		want := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		if err := RGBA(context.Background(), want, src); err != nil {
+			t.Fatal(err)
+		}
+		useAVX2 = true
+		got := image.NewRGBA(want.Rect)
+		if err := RGBA(context.Background(), got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: AVX2 output differs from the generic one", size)
+		}
+	}
+
+	for _, n := range []int{1, 2, 3, 8, 31} {
+		row := src.Pix[:n<<2]
+		want, got := make([]uint32, n<<2), make([]uint32, n<<2)
+		accumulate8RGBAGeneric(want, row, 12345)
+		accumulate8RGBA(got, row, 12345)
+		for i := range want {
+			if want[i] != got[i] {
+				t.Fatalf("accumulate8RGBA n=%d [%d]: want %d, got %d", n, i, want[i], got[i])
+			}
+		}
+	}
+	for _, n := range []int{1, 7, 8, 9, 31} {
+		row := src.Pix[:n]
+		want, got := make([]uint32, n), make([]uint32, n)
+		for i := range want {
+			want[i], got[i] = uint32(i), uint32(i)
+		}
+		accumulate8Generic(want, row, 54321)
+		accumulate8(got, row, 54321)
+		for i := range want {
+			if want[i] != got[i] {
+				t.Fatalf("accumulate8 n=%d [%d]: want %d, got %d", n, i, want[i], got[i])
+			}
+		}
+	}
+}
+
+// BenchmarkRGBASIMD runs BenchmarkRGBA once with the AVX2 kernels and once
+// with the generic ones, which is where the speedup of the assembly shows.
+func BenchmarkRGBASIMD(b *testing.B) {
+	if !useAVX2 {
+		b.Skip("AVX2 is not available")
+	}
+	defer func() { useAVX2 = true }()
+	for _, avx2 := range []bool{false, true} {
+		name := "Generic"
+		if avx2 {
+			name = "AVX2"
+		}
+		b.Run(name, func(b *testing.B) {
+			useAVX2 = avx2
+			BenchmarkRGBA(b)
+		})
+	}
+}
+
+func BenchmarkAccumulate8RGBA(b *testing.B) {
+	if !useAVX2 {
+		b.Skip("AVX2 is not available")
+	}
+	row := make([]byte, 4000<<2)
+	for i := range row {
+		row[i] = uint8(i * 7)
+	}
+	acc := make([]uint32, len(row))
+	b.Run("Generic", func(b *testing.B) {
+		b.SetBytes(int64(len(row)))
+		for i := 0; i < b.N; i++ {
+			accumulate8RGBAGeneric(acc, row, 3)
+		}
+	})
+	b.Run("AVX2", func(b *testing.B) {
+		b.SetBytes(int64(len(row)))
+		for i := 0; i < b.N; i++ {
+			accumulate8RGBA(acc, row, 3)
+		}
+	})
+}
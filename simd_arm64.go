@@ -0,0 +1,47 @@
+//go:build arm64 && !purego
+// +build arm64,!purego
+
+package downscale
+
+// useNEON is always true, as every arm64 CPU has Advanced SIMD. It is a
+// variable so that the tests can compare the kernels against the generic
+// loops.
+var useNEON = true
+
+// useAVX2 is false here; it only guards the amd64 kernels.
+const useAVX2 = false
+
+//go:noescape
+func accumulate8RGBANEON(acc *uint32, row *byte, n int, w uint32, table *uint16)
+
+func accumulate8RGBA(acc []uint32, row []byte, w uint32) {
+	row = row[:len(acc)]
+	n := len(acc) >> 2
+	if !useNEON || n == 0 {
+		accumulate8RGBAGeneric(acc, row, w)
+		return
+	}
+	accumulate8RGBANEON(&acc[0], &row[0], n, w, &divTable[0])
+}
+
+//go:noescape
+func horzTaps8RGBANEON(acc *uint32, buf *uint32, tt *uint32, ft *uint32, n int, slcmlen uint32)
+
+func horzTaps8RGBA(acc []uint32, buf []uint32, tt []uint32, ft []uint32, slcmlen uint32) {
+	n := len(acc) >> 2
+	if !useNEON || n == 0 {
+		horzTaps8RGBAGeneric(acc, buf, tt, ft, slcmlen)
+		return
+	}
+	// every tap the assembly reads has to be inside buf.
+	last := tt[n]
+	if ft[n-1] != 0 {
+		last++
+	}
+	_ = buf[last<<2-1]
+	horzTaps8RGBANEON(&acc[0], &buf[0], &tt[0], &ft[0], n, slcmlen)
+}
+
+func accumulate8(acc []uint32, row []byte, w uint32) {
+	accumulate8Generic(acc, row, w)
+}
@@ -0,0 +1,106 @@
+//go:build arm64 && !purego
+// +build arm64,!purego
+
+#include "textflag.h"
+
+// The Go assembler has no integer vector multiply, so these are encoded by
+// hand:
+//   MUL Vd.4S, Vn.4S, Vm.4S = 0x4ea09c00 | m<<16 | n<<5 | d
+//   MLA Vd.4S, Vn.4S, Vm.4S = 0x4ea09400 | m<<16 | n<<5 | d
+
+// func accumulate8RGBANEON(acc *uint32, row *byte, n int, w uint32, table *uint16)
+//
+// For one pixel at a time it computes, like accumulate8RGBAGeneric,
+//   acc[c] += table[c<<8|a] * a * w  for the colors
+//   acc[3] += a * w                  for the alpha
+// The three lookups are scalar loads, as NEON has no gather.
+TEXT ·accumulate8RGBANEON(SB), NOSPLIT, $0-40
+	MOVD  acc+0(FP), R0
+	MOVD  row+8(FP), R1
+	MOVD  n+16(FP), R2
+	MOVWU w+24(FP), R3
+	MOVD  table+32(FP), R4
+	MOVW  $1, R14
+
+loop:
+	MOVWU.P 4(R1), R8 // r g b a
+	LSRW    $24, R8, R9 // a
+	CBZW    R9, skip
+	MULW    R3, R9, R10 // a * w
+
+	UBFXW $0, R8, $8, R11
+	LSLW  $8, R11, R11
+	ORRW  R9, R11, R11
+	MOVHU (R4)(R11<<1), R11
+	UBFXW $8, R8, $8, R12
+	LSLW  $8, R12, R12
+	ORRW  R9, R12, R12
+	MOVHU (R4)(R12<<1), R12
+	UBFXW $16, R8, $8, R13
+	LSLW  $8, R13, R13
+	ORRW  R9, R13, R13
+	MOVHU (R4)(R13<<1), R13
+
+	VMOV R11, V1.S[0]
+	VMOV R12, V1.S[1]
+	VMOV R13, V1.S[2]
+	VMOV R14, V1.S[3] // the alpha lane only takes the weight
+	VDUP R10, V2.S4
+	VLD1 (R0), [V0.S4]
+	WORD $0x4ea29420 // MLA V0.4S, V1.4S, V2.4S
+	VST1 [V0.S4], (R0)
+
+skip:
+	ADD  $16, R0
+	SUB  $1, R2
+	CBNZ R2, loop
+	RET
+
+// func horzTaps8RGBANEON(acc *uint32, buf *uint32, tt *uint32, ft *uint32, n int, slcmlen uint32)
+//
+// The same loop as horzTaps8RGBAGeneric with one pixel in each register.
+TEXT ·horzTaps8RGBANEON(SB), NOSPLIT, $0-44
+	MOVD  acc+0(FP), R0
+	MOVD  buf+8(FP), R1
+	MOVD  tt+16(FP), R2
+	MOVD  ft+24(FP), R3
+	MOVD  n+32(FP), R4
+	MOVWU slcmlen+40(FP), R5
+
+	VDUP R5, V7.S4 // slcmlen
+	MOVD $0, R6    // x
+	MOVW $0, R7    // fr of the previous pixel
+
+pixel:
+	MOVWU (R2)(R6<<2), R8 // tl
+	ADD   $1, R6, R9
+	MOVWU (R2)(R9<<2), R10 // tr
+	SUBW  R7, R5, R11      // fl
+	MOVWU (R3)(R6<<2), R7  // fr
+
+	ADD      R8<<4, R1, R12
+	VLD1.P   16(R12), [V1.S4]
+	VDUP     R11, V2.S4
+	WORD     $0x4ea29c20 // MUL V0.4S, V1.4S, V2.4S
+	ADDW     $1, R8
+
+middle:
+	CMPW   R10, R8
+	BHS    last
+	VLD1.P 16(R12), [V1.S4]
+	WORD   $0x4ea79420 // MLA V0.4S, V1.4S, V7.4S
+	ADDW   $1, R8
+	B      middle
+
+last:
+	CBZW R7, store
+	VLD1 (R12), [V1.S4]
+	VDUP R7, V2.S4
+	WORD $0x4ea29420 // MLA V0.4S, V1.4S, V2.4S
+
+store:
+	VST1.P [V0.S4], 16(R0)
+	ADD    $1, R6
+	CMP    R4, R6
+	BLO    pixel
+	RET
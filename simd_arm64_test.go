@@ -0,0 +1,112 @@
+//go:build arm64 && !purego
+// +build arm64,!purego
+
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestNEONMatchesGeneric(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	src := image.NewRGBA(image.Rect(0, 0, 257, 193))
+	for i := 0; i < len(src.Pix); i += 4 {
+		a := uint8(rnd.Intn(256))
+		if rnd.Intn(4) == 0 {
+			a = 255 * uint8(rnd.Intn(2))
+		}
+		src.Pix[i+3] = a
+		for c := 0; c < 3; c++ {
+			src.Pix[i+c] = uint8(rnd.Intn(int(a) + 1))
+		}
+	}
+
+	defer func() { useNEON = true }()
+	for _, size := range []image.Point{{100, 100}, {257, 3}, {3, 193}, {1, 1}, {255, 190}, {64, 48}} {
+		useNEON = false
+		want := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		if err := RGBA(context.Background(), want, src); err != nil {
+			t.Fatal(err)
+		}
+		useNEON = true
+		got := image.NewRGBA(want.Rect)
+		if err := RGBA(context.Background(), got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: NEON output differs from the generic one", size)
+		}
+	}
+
+	for _, n := range []int{1, 2, 3, 8, 31} {
+		row := src.Pix[:n<<2]
+		want, got := make([]uint32, n<<2), make([]uint32, n<<2)
+		for i := range want {
+			want[i], got[i] = uint32(i), uint32(i)
+		}
+		accumulate8RGBAGeneric(want, row, 12345)
+		accumulate8RGBA(got, row, 12345)
+		for i := range want {
+			if want[i] != got[i] {
+				t.Fatalf("accumulate8RGBA n=%d [%d]: want %d, got %d", n, i, want[i], got[i])
+			}
+		}
+	}
+
+	buf := make([]uint32, 257<<2)
+	accumulate8RGBAGeneric(buf, src.Pix[:257<<2], 1)
+	for _, dw := range []uint32{1, 2, 100, 256} {
+		slcmlen, _, tt, ft, err := lcmTable(257, dw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, got := make([]uint32, dw<<2), make([]uint32, dw<<2)
+		horzTaps8RGBAGeneric(want, buf, tt, ft, slcmlen)
+		horzTaps8RGBA(got, buf, tt, ft, slcmlen)
+		for i := range want {
+			if want[i] != got[i] {
+				t.Fatalf("horzTaps8RGBA dw=%d [%d]: want %d, got %d", dw, i, want[i], got[i])
+			}
+		}
+	}
+}
+
+// BenchmarkRGBASIMD runs BenchmarkRGBA once with the NEON kernels and once
+// with the generic ones.
+func BenchmarkRGBASIMD(b *testing.B) {
+	defer func() { useNEON = true }()
+	for _, neon := range []bool{false, true} {
+		name := "Generic"
+		if neon {
+			name = "NEON"
+		}
+		b.Run(name, func(b *testing.B) {
+			useNEON = neon
+			BenchmarkRGBA(b)
+		})
+	}
+}
+
+func BenchmarkAccumulate8RGBA(b *testing.B) {
+	row := make([]byte, 4000<<2)
+	for i := range row {
+		row[i] = uint8(i * 7)
+	}
+	acc := make([]uint32, len(row))
+	b.Run("Generic", func(b *testing.B) {
+		b.SetBytes(int64(len(row)))
+		for i := 0; i < b.N; i++ {
+			accumulate8RGBAGeneric(acc, row, 3)
+		}
+	})
+	b.Run("NEON", func(b *testing.B) {
+		b.SetBytes(int64(len(row)))
+		for i := 0; i < b.N; i++ {
+			accumulate8RGBA(acc, row, 3)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+//go:build (!amd64 && !arm64) || purego
+// +build !amd64,!arm64 purego
+
+package downscale
+
+const useAVX2 = false
+
+func accumulate8RGBA(acc []uint32, row []byte, w uint32) {
+	accumulate8RGBAGeneric(acc, row, w)
+}
+
+func horzTaps8RGBA(acc []uint32, buf []uint32, tt []uint32, ft []uint32, slcmlen uint32) {
+	horzTaps8RGBAGeneric(acc, buf, tt, ft, slcmlen)
+}
+
+func accumulate8(acc []uint32, row []byte, w uint32) {
+	accumulate8Generic(acc, row, w)
+}
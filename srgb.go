@@ -0,0 +1,24 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+// NRGBASRGB is like NRGBAGamma but uses the piecewise sRGB transfer
+// function instead of a plain power curve.
+func NRGBASRGB(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		t8, t16 := getSRGBTable()
+		return nrgbaGamma(ctx, dest, src, [3]*[256]uint16{t8, t8, t8}, tableEncoder([3]*[65536]uint8{t16, t16, t16}), newOptions(opts))
+	})
+}
+
+// RGBASRGB is like RGBAGamma but uses the piecewise sRGB transfer function
+// instead of a plain power curve.
+func RGBASRGB(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		t8, t16 := getSRGBTable()
+		return rgbaGamma(ctx, dest, src, t8, t16, newOptions(opts))
+	})
+}
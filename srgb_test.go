@@ -0,0 +1,50 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSRGBTable(t *testing.T) {
+	t8, t16 := makeSRGBTable()
+	// ((128/255 + 0.055) / 1.055) ^ 2.4 * 65535 = 14146.4...
+	if got := t8[128]; got != 14146 {
+		t.Errorf("t8[128]: want 14146, got %d", got)
+	}
+	// 10/255 is below the linear toe: 10 / 255 / 12.92 * 65535 = 198.9...
+	if got := t8[10]; got != 199 {
+		t.Errorf("t8[10]: want 199, got %d", got)
+	}
+	for i, v := range t8 {
+		if got := t16[v]; int(got) != i {
+			t.Errorf("t16[t8[%d]]: want %d, got %d", i, i, got)
+		}
+	}
+}
+
+func TestGetSRGBTable(t *testing.T) {
+	want8, want16 := makeSRGBTable()
+	t8, t16 := getSRGBTable()
+	if *t8 != want8 || *t16 != want16 {
+		t.Fatal("table does not match makeSRGBTable")
+	}
+	if t8b, t16b := getSRGBTable(); t8b != t8 || t16b != t16 {
+		t.Error("want cached tables, got new ones")
+	}
+}
+
+func TestNRGBASRGB(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	src.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 255})
+	dest := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	if err := NRGBASRGB(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	// linear 0.5 encodes to 187.5 in sRGB.
+	if got := dest.NRGBAAt(0, 0); got.R != 187 && got.R != 188 {
+		t.Errorf("want 187 or 188, got %d", got.R)
+	}
+}
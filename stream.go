@@ -0,0 +1,96 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+// RGBAWriteTo is RGBA that hands each row of dest to emit, in order from the
+// top, as soon as the vertical pass has finished it, so that an encoder can
+// start before the whole image is done. row is the part of dest.Pix that
+// holds the row. When only the width is scaled, the rows are emitted after
+// the horizontal pass.
+func RGBAWriteTo(ctx context.Context, dest *image.RGBA, src *image.RGBA, emit func(y int, row []byte), opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaWriteTo(ctx, dest, src, emit, opts)
+	})
+}
+
+func rgbaWriteTo(ctx context.Context, dest *image.RGBA, src *image.RGBA, emit func(y int, row []byte), opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", src.Pix, src.Stride, src.Rect, 4); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+	if !sumFits(sw, dw, peak8RGBA) || !sumFits(sh, dh, peak8RGBA) {
+		return ErrTooLarge
+	}
+	if overlaps(dest.Pix, src.Pix) {
+		c := getTmpRGBA(sw, sh)
+		defer putTmpRGBA(c)
+		copyRGBA(c, src, false)
+		src = c
+	}
+	o := newOptions(opts)
+	dwx4 := dw << 2
+	if sh == dh {
+		if sw == dw {
+			copyRGBA(dest, src, false)
+		} else if err := horz8RGBA(ctx, dest, src, o); err != nil {
+			return err
+		}
+		for y := 0; y < dh; y++ {
+			emit(y, dest.Pix[y*dest.Stride:y*dest.Stride+dwx4])
+		}
+		return nil
+	}
+
+	tmp := src
+	if sw != dw {
+		tmp = getTmpRGBA(dw, sh)
+		defer putTmpRGBA(tmp)
+		if err := horz8RGBA(ctx, tmp, src, o); err != nil {
+			return err
+		}
+	}
+
+	vert := NewWeightTable(uint32(sh), uint32(dh))
+	acc := make([]uint32, dwx4)
+	for y := 0; y < dh; y++ {
+		if ctx.Err() != nil {
+			return ErrAborted
+		}
+		tl, tr := int(vert.tt[y]), int(vert.tt[y+1])
+		fl := vert.slcmlen
+		if y > 0 {
+			fl -= vert.ft[y-1]
+		}
+		fr := vert.ft[y]
+		for i := range acc {
+			acc[i] = 0
+		}
+		si := tl * tmp.Stride
+		accumulate8RGBA(acc, tmp.Pix[si:si+dwx4], fl)
+		for i := tl + 1; i < tr; i++ {
+			si += tmp.Stride
+			accumulate8RGBA(acc, tmp.Pix[si:si+dwx4], vert.slcmlen)
+		}
+		if fr != 0 {
+			si += tmp.Stride
+			accumulate8RGBA(acc, tmp.Pix[si:si+dwx4], fr)
+		}
+		row := dest.Pix[y*dest.Stride : y*dest.Stride+dwx4]
+		store8RGBA(row, acc, vert.dlcmlen, o.rounding)
+		emit(y, row)
+	}
+	return nil
+}
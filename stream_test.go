@@ -0,0 +1,51 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func TestRGBAWriteTo(t *testing.T) {
+	translucent := image.NewRGBA(image.Rect(0, 0, 90, 70))
+	draw.Draw(translucent, translucent.Rect, testPattern(90, 70), image.Point{}, draw.Src)
+	// RGBA takes another path for opaque images.
+	opaque := image.NewRGBA(translucent.Rect)
+	draw.Draw(opaque, opaque.Rect, image.Opaque, image.Point{}, draw.Src)
+	draw.Draw(opaque, opaque.Rect, testPattern(90, 70), image.Point{}, draw.Over)
+	for _, src := range []*image.RGBA{translucent, opaque} {
+		testRGBAWriteTo(t, src)
+	}
+}
+
+func testRGBAWriteTo(t *testing.T, src *image.RGBA) {
+	ctx := context.Background()
+	for _, sz := range []image.Point{{31, 23}, {90, 23}, {31, 70}, {90, 70}} {
+		want := image.NewRGBA(image.Rect(0, 0, sz.X, sz.Y))
+		if err := RGBA(ctx, want, src); err != nil {
+			t.Fatal(err)
+		}
+		got := image.NewRGBA(want.Rect)
+		next := 0
+		err := RGBAWriteTo(ctx, got, src, func(y int, row []byte) {
+			if y != next {
+				t.Fatalf("%v: want row %d, got %d", sz, next, y)
+			}
+			if w := want.Pix[y*want.Stride : (y+1)*want.Stride]; !bytes.Equal(w, row) {
+				t.Errorf("%v: row %d differs from RGBA", sz, y)
+			}
+			next++
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != sz.Y {
+			t.Errorf("%v: want %d rows, got %d", sz, sz.Y, next)
+		}
+		if !bytes.Equal(want.Pix, got.Pix) {
+			t.Errorf("%v: dest differs from RGBA", sz)
+		}
+	}
+}
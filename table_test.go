@@ -1,6 +1,8 @@
 package downscale
 
 import (
+	"context"
+	"image"
 	"testing"
 )
 
@@ -8,7 +10,10 @@ func TestMakeTable(t *testing.T) {
 	for _, testData := range makeTableTestData {
 		lcmlen := lcm(testData.sw, testData.dw)
 		slcmlen, dlcmlen := lcmlen/testData.sw, lcmlen/testData.dw
-		gotTT, gotFT := makeTable(testData.dw, dlcmlen, slcmlen)
+		gotTT, gotFT, err := makeTable(testData.dw, dlcmlen, slcmlen)
+		if err != nil {
+			t.Fatal(err)
+		}
 		if len(gotTT) != len(gotFT) {
 			t.Fatalf("len(gotTT) != len(gotFT) / %d != %d", len(gotTT), len(gotFT))
 		}
@@ -25,6 +30,37 @@ func TestMakeTable(t *testing.T) {
 	}
 }
 
+func TestDegenerateTable(t *testing.T) {
+	if _, _, err := makeTable(4, 0, 3); err == nil {
+		t.Error("makeTable: want an error for a zero length")
+	}
+	if _, _, _, _, err := lcmTable(0, 3); err != ErrInvalidSize {
+		t.Errorf("lcmTable: want ErrInvalidSize, got %v", err)
+	}
+	if _, _, _, _, err := lcmTable(70001, 65537); err != ErrTooLarge {
+		t.Errorf("lcmTable: want ErrTooLarge, got %v", err)
+	}
+	if NewWeightTable(70001, 65537) != nil {
+		t.Error("NewWeightTable: want nil for a lcm beyond 32 bits")
+	}
+	// the passes are reached only after validation, but still must not panic.
+	src := image.NewGray(image.Rect(0, 0, 8, 8))
+	if err := horz8Gray(context.Background(), image.NewGray(image.Rect(0, 0, 0, 8)), src, newOptions(nil)); err != ErrInvalidSize {
+		t.Errorf("horz8Gray: want ErrInvalidSize, got %v", err)
+	}
+}
+
+func TestGetGammaTable(t *testing.T) {
+	want8, want16 := makeGammaTable(1.8)
+	t8, t16 := getGammaTable(1.8)
+	if *t8 != want8 || *t16 != want16 {
+		t.Fatal("table does not match makeGammaTable")
+	}
+	if t8b, t16b := getGammaTable(1.8); t8b != t8 || t16b != t16 {
+		t.Error("want cached tables, got new ones")
+	}
+}
+
 var makeTableTestData = []struct {
 	sw uint32
 	dw uint32
@@ -2040,3 +2076,129 @@ var makeTableTestData = []struct {
 		},
 	},
 }
+
+func TestDivider(t *testing.T) {
+	for _, d := range []uint32{1, 2, 3, 7, 255, 1000, 65535, 1<<31 + 1, 0xffffffff} {
+		v := newDivider(d)
+		for _, x := range []uint32{0, 1, d - 1, d, d + 1, 12345678, 1 << 31, 0xfffffffe, 0xffffffff} {
+			if want, got := x/d, v.div(x); want != got {
+				t.Errorf("%d / %d: want %d, got %d", x, d, want, got)
+			}
+		}
+	}
+}
+
+func TestLargeCoprimeSizes(t *testing.T) {
+	ctx := context.Background()
+	// lcm(65536, 65535) is just below 1<<32, and dlcmlen*(dw+1) is not.
+	src := image.NewRGBA(image.Rect(0, 0, 65536, 1))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i+0], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3] = 200, 100, 50, 255
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, 65535, 1))
+	if err := RGBA(ctx, dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(dest.Pix); i += 4 {
+		if p := dest.Pix[i : i+4]; p[0] != 200 || p[1] != 100 || p[2] != 50 || p[3] != 255 {
+			t.Fatalf("x=%d: want [200 100 50 255], got %v", i>>2, p)
+		}
+	}
+
+	tt, ft, err := makeTable(65535, 65536, 65535)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tt[65535]; got != 65536 {
+		t.Errorf("want 65536, got %d", got)
+	}
+	if got := ft[65535]; got != 1 {
+		t.Errorf("want 1, got %d", got)
+	}
+
+	// 70001 and 65537 are coprime and their lcm exceeds 32 bits.
+	if err := Gray(ctx, image.NewGray(image.Rect(0, 0, 65537, 1)), image.NewGray(image.Rect(0, 0, 70001, 1))); err != ErrTooLarge {
+		t.Errorf("want ErrTooLarge, got %v", err)
+	}
+	if _, err := NewScaler(70001, 1, 65537, 1); err != ErrTooLarge {
+		t.Errorf("want ErrTooLarge, got %v", err)
+	}
+	rd, rs := image.NewRGBA(image.Rect(0, 0, 65537, 1)), image.NewRGBA(image.Rect(0, 0, 70001, 1))
+	if err := RGBAGamma(ctx, rd, rs, 2.2); err != ErrTooLarge {
+		t.Errorf("RGBAGamma: want ErrTooLarge, got %v", err)
+	}
+	if err := RGBALinear(ctx, rd, rs, 2.2); err != ErrTooLarge {
+		t.Errorf("RGBALinear: want ErrTooLarge, got %v", err)
+	}
+	if err := RGBASRGB(ctx, rd, rs); err != ErrTooLarge {
+		t.Errorf("RGBASRGB: want ErrTooLarge, got %v", err)
+	}
+}
+
+func TestSumOverflow(t *testing.T) {
+	ctx := context.Background()
+	nrgba := func(w int, v uint8) error {
+		src := image.NewNRGBA(image.Rect(0, 0, w, 1))
+		for i := range src.Pix {
+			src.Pix[i] = v
+		}
+		dest := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		if err := NRGBA(ctx, dest, src); err != nil {
+			return err
+		}
+		if dest.Pix[0] != v || dest.Pix[3] != v {
+			t.Errorf("NRGBA %dx1: want %d, got %v", w, v, dest.Pix)
+		}
+		return nil
+	}
+	rgba := func(w int, v uint8) error {
+		src := image.NewRGBA(image.Rect(0, 0, w, 1))
+		for i := range src.Pix {
+			src.Pix[i] = v
+		}
+		dest := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		if err := RGBA(ctx, dest, src); err != nil {
+			return err
+		}
+		if dest.Pix[0] != v || dest.Pix[3] != v {
+			t.Errorf("RGBA %dx1: want %d, got %v", w, v, dest.Pix)
+		}
+		return nil
+	}
+	gray := func(w int, v uint8) error {
+		src := image.NewGray(image.Rect(0, 0, w, 1))
+		for i := range src.Pix {
+			src.Pix[i] = v
+		}
+		dest := image.NewGray(image.Rect(0, 0, 1, 1))
+		if err := Gray(ctx, dest, src); err != nil {
+			return err
+		}
+		if dest.Pix[0] != v {
+			t.Errorf("Gray %dx1: want %d, got %v", w, v, dest.Pix)
+		}
+		return nil
+	}
+
+	// 65793*256*255 and 16777215*256 are the largest sums below 1<<32.
+	if err := nrgba(65793, 255); err != nil {
+		t.Errorf("NRGBA 65793x1: %v", err)
+	}
+	if err := rgba(65793, 128); err != nil {
+		t.Errorf("RGBA 65793x1: %v", err)
+	}
+	if err := gray(16777215, 255); err != nil {
+		t.Errorf("Gray 16777215x1: %v", err)
+	}
+	for _, w := range []int{66000, 70000} {
+		if err := nrgba(w, 255); err != ErrTooLarge {
+			t.Errorf("NRGBA %dx1: want ErrTooLarge, got %v", w, err)
+		}
+	}
+	if err := rgba(200000, 128); err != ErrTooLarge {
+		t.Errorf("RGBA 200000x1: want ErrTooLarge, got %v", err)
+	}
+	if err := gray(20000000, 255); err != ErrTooLarge {
+		t.Errorf("Gray 20000000x1: want ErrTooLarge, got %v", err)
+	}
+}
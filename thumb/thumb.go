@@ -0,0 +1,115 @@
+// Package thumb decodes, downscales and re-encodes PNG and JPEG images in
+// one call. It is kept apart from downscale so that the core package does
+// not depend on any image codec.
+package thumb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/oov/downscale"
+)
+
+// Thumbnail decodes a PNG or JPEG image from r, downscales it to the largest
+// size that fits within maxW x maxH while keeping its aspect ratio, and
+// encodes the result to w. format is "png" or "jpeg".
+func Thumbnail(w io.Writer, r io.Reader, maxW int, maxH int, format string, opts ...downscale.Option) error {
+	if maxW <= 0 || maxH <= 0 {
+		return errors.New("thumb: invalid fit size")
+	}
+	encode, err := encoder(format)
+	if err != nil {
+		return err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	dest, err := scale(src, maxW, maxH, opts)
+	if err != nil {
+		return err
+	}
+	return encode(w, dest)
+}
+
+// ThumbnailBytes is Thumbnail for an encoded image held in data. The format
+// is sniffed from data and the thumbnail is encoded in the same format,
+// whose name is returned along with the encoded bytes.
+func ThumbnailBytes(data []byte, maxW int, maxH int, opts ...downscale.Option) ([]byte, string, error) {
+	if maxW <= 0 || maxH <= 0 {
+		return nil, "", errors.New("thumb: invalid fit size")
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	encode, err := encoder(format)
+	if err != nil {
+		return nil, "", err
+	}
+	dest, err := scale(src, maxW, maxH, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, dest); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), format, nil
+}
+
+func encoder(format string) (func(io.Writer, image.Image) error, error) {
+	switch format {
+	case "png":
+		return png.Encode, nil
+	case "jpeg", "jpg":
+		return func(w io.Writer, m image.Image) error {
+			return jpeg.Encode(w, m, nil)
+		}, nil
+	}
+	return nil, errors.New("thumb: unsupported format: " + format)
+}
+
+func scale(src image.Image, maxW int, maxH int, opts []downscale.Option) (image.Image, error) {
+	if src.Bounds().Empty() {
+		return nil, errors.New("thumb: empty source image")
+	}
+	dest, src := newDest(src, maxW, maxH)
+	if err := downscale.Scale(context.Background(), dest, src, opts...); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// newDest allocates a destination that downscale.Scale handles natively for
+// src, converting src to *image.RGBA when there is none.
+func newDest(src image.Image, maxW int, maxH int) (draw.Image, image.Image) {
+	b := src.Bounds()
+	dw, dh := downscale.FitSize(b.Dx(), b.Dy(), maxW, maxH)
+	r := image.Rect(0, 0, dw, dh)
+	switch src.(type) {
+	case *image.RGBA, *image.YCbCr:
+		return image.NewRGBA(r), src
+	case *image.NRGBA:
+		return image.NewNRGBA(r), src
+	case *image.RGBA64:
+		return image.NewRGBA64(r), src
+	case *image.NRGBA64:
+		return image.NewNRGBA64(r), src
+	case *image.Gray:
+		return image.NewGray(r), src
+	case *image.Gray16:
+		return image.NewGray16(r), src
+	case *image.Paletted:
+		return image.NewPaletted(r, nil), src
+	}
+	tmp := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(tmp, tmp.Rect, src, b.Min, draw.Src)
+	return image.NewRGBA(r), tmp
+}
@@ -0,0 +1,113 @@
+package thumb
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnailJPEG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			src.SetRGBA(x, y, color.RGBA{uint8(x * 2), uint8(y * 3), 128, 255})
+		}
+	}
+	var in bytes.Buffer
+	if err := jpeg.Encode(&in, src, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Thumbnail(&out, &in, 30, 30, "jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := jpeg.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := m.Bounds(); b.Dx() != 30 || b.Dy() != 20 {
+		t.Errorf("want 30x20, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestThumbnailPNG(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 40, 100))
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Thumbnail(&out, &in, 50, 50, "png"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := png.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*image.Gray); !ok {
+		t.Errorf("want *image.Gray, got %T", m)
+	}
+	if b := m.Bounds(); b.Dx() != 20 || b.Dy() != 50 {
+		t.Errorf("want 20x50, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestThumbnailFormat(t *testing.T) {
+	var out bytes.Buffer
+	if err := Thumbnail(&out, bytes.NewReader(nil), 10, 10, "gif"); err == nil {
+		t.Error("want an error for an unsupported format")
+	}
+}
+
+func TestThumbnailBytes(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			src.SetRGBA(x, y, color.RGBA{uint8(x * 2), uint8(y * 3), 128, 255})
+		}
+	}
+	for _, tc := range []struct {
+		format string
+		encode func(*bytes.Buffer) error
+		decode func(*bytes.Reader) (image.Image, error)
+	}{
+		{
+			"png",
+			func(b *bytes.Buffer) error { return png.Encode(b, src) },
+			func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) },
+		},
+		{
+			"jpeg",
+			func(b *bytes.Buffer) error { return jpeg.Encode(b, src, nil) },
+			func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) },
+		},
+	} {
+		var in bytes.Buffer
+		if err := tc.encode(&in); err != nil {
+			t.Fatal(err)
+		}
+		out, format, err := ThumbnailBytes(in.Bytes(), 60, 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != tc.format {
+			t.Errorf("want format %q, got %q", tc.format, format)
+		}
+		m, err := tc.decode(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.format, err)
+		}
+		if b := m.Bounds(); b.Dx() != 60 || b.Dy() != 40 {
+			t.Errorf("%s: want 60x40, got %dx%d", tc.format, b.Dx(), b.Dy())
+		}
+	}
+
+	if _, _, err := ThumbnailBytes([]byte("not an image"), 10, 10); err == nil {
+		t.Error("want an error for unknown data")
+	}
+}
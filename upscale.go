@@ -0,0 +1,84 @@
+package downscale
+
+import (
+	"context"
+	"image"
+)
+
+func RGBAUpscale(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaUpscale(ctx, dest, src, opts)
+	})
+}
+
+func rgbaUpscale(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts []Option) error {
+	if err := checkResize(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw := dest.Rect.Dx()
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+	return filterRGBA(ctx, dest, src, &kernels[Triangle], newOptions(opts))
+}
+
+func NRGBAUpscale(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nrgbaUpscale(ctx, dest, src, opts)
+	})
+}
+
+func nrgbaUpscale(ctx context.Context, dest *image.NRGBA, src *image.NRGBA, opts []Option) error {
+	if err := checkResize(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw := dest.Rect.Dx()
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+	return filterNRGBA(ctx, dest, src, &kernels[Triangle], newOptions(opts))
+}
+
+func RGBABicubic(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return rgbaBicubic(ctx, dest, src, opts)
+	})
+}
+
+func rgbaBicubic(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts []Option) error {
+	if err := checkResize(dest.Pix, dest.Stride, dest.Rect, src.Pix, src.Stride, src.Rect); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw := dest.Rect.Dx()
+	if IsCopy(src.Rect, dest.Rect) {
+		for y := 0; y < sh; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+dw<<2], src.Pix[y*src.Stride:y*src.Stride+sw<<2])
+		}
+		return nil
+	}
+	return filterRGBA(ctx, dest, src, &kernels[CatmullRom], newOptions(opts))
+}
+
+// checkResize validates the images of the functions that can both enlarge
+// and reduce, before any pixel is touched.
+func checkResize(dPix []byte, dStride int, dr image.Rectangle, sPix []byte, sStride int, sr image.Rectangle) error {
+	if err := checkPix("dest", dPix, dStride, dr, 4); err != nil {
+		return err
+	}
+	if err := checkPix("src", sPix, sStride, sr, 4); err != nil {
+		return err
+	}
+	if sr.Dx() <= 0 || sr.Dy() <= 0 || dr.Dx() <= 0 || dr.Dy() <= 0 {
+		return ErrInvalidSize
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRGBAUpscale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.SetRGBA(0, 0, color.RGBA{255, 255, 255, 255})
+	src.SetRGBA(1, 0, color.RGBA{0, 0, 0, 255})
+	src.SetRGBA(0, 1, color.RGBA{0, 0, 0, 255})
+	src.SetRGBA(1, 1, color.RGBA{255, 255, 255, 255})
+	dest := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	if err := RGBAUpscale(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	want := [4][4]uint8{
+		{255, 191, 64, 0},
+		{191, 159, 96, 64},
+		{64, 96, 159, 191},
+		{0, 64, 191, 255},
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if got := dest.RGBAAt(x, y); got.R != want[y][x] || got.A != 255 {
+				t.Errorf("(%d, %d): want %d, got %v", x, y, want[y][x], got)
+			}
+		}
+	}
+}
+
+func TestNRGBAUpscale(t *testing.T) {
+	// the transparent pixel's color must not bleed into the result.
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	src.SetNRGBA(1, 0, color.NRGBA{0, 255, 0, 0})
+	dest := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	if err := NRGBAUpscale(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	want := []color.NRGBA{{255, 0, 0, 255}, {255, 0, 0, 191}, {255, 0, 0, 64}, {0, 0, 0, 0}}
+	for x, w := range want {
+		if got := dest.NRGBAAt(x, 0); got != w {
+			t.Errorf("x=%d: want %v, got %v", x, w, got)
+		}
+	}
+}
+
+func TestRGBABicubic(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 8; x++ {
+			v := uint8(x * x * 4)
+			src.SetRGBA(x, y, color.RGBA{v, 255 - v, 0, 255})
+		}
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, 29, 7))
+	if err := RGBABicubic(context.Background(), dest, src); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 7; y++ {
+		for x := 1; x < 29; x++ {
+			c0, c1 := dest.RGBAAt(x-1, y), dest.RGBAAt(x, y)
+			if c1.R < c0.R || c1.G > c0.G {
+				t.Errorf("(%d, %d): not monotonic: %v -> %v", x, y, c0, c1)
+			}
+		}
+	}
+}
+
+func TestUpscaleInvalid(t *testing.T) {
+	ctx := context.Background()
+	short := &image.RGBA{Pix: make([]byte, 10), Stride: 16, Rect: image.Rect(0, 0, 4, 4)}
+	shortN := &image.NRGBA{Pix: short.Pix, Stride: short.Stride, Rect: short.Rect}
+	ok := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	okN := image.NewNRGBA(ok.Rect)
+	empty := image.NewRGBA(image.Rect(0, 0, 0, 4))
+	for name, err := range map[string]error{
+		"RGBAUpscale short src":  RGBAUpscale(ctx, ok, short),
+		"RGBAUpscale short dest": RGBAUpscale(ctx, short, ok),
+		"NRGBAUpscale short src": NRGBAUpscale(ctx, okN, shortN),
+		"RGBABicubic short src":  RGBABicubic(ctx, ok, short),
+	} {
+		if err == nil {
+			t.Errorf("%s: want error, got nil", name)
+		}
+	}
+	for name, err := range map[string]error{
+		"RGBAUpscale":  RGBAUpscale(ctx, empty, ok),
+		"NRGBAUpscale": NRGBAUpscale(ctx, image.NewNRGBA(empty.Rect), okN),
+		"RGBABicubic":  RGBABicubic(ctx, ok, empty),
+	} {
+		if err != ErrInvalidSize {
+			t.Errorf("%s: want ErrInvalidSize, got %v", name, err)
+		}
+	}
+}
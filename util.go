@@ -3,32 +3,108 @@ package downscale
 import (
 	"context"
 	"errors"
+	"fmt"
+	"image"
 	"math"
+	"math/bits"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 var ErrAborted = errors.New("downscale: aborted")
 
+// ErrUpscaleUnsupported is returned when dest is larger than src in either
+// direction. The message is kept as is for callers that match on it.
+var ErrUpscaleUnsupported = errors.New("upscale is not supported")
+
+// ErrInvalidSize is returned when a source or destination image has no
+// pixels, as a zero or negative width or height cannot be scaled.
+var ErrInvalidSize = errors.New("downscale: invalid image size")
+
+// ErrInvalidGamma is returned for a gamma that is not within (0, 10], which
+// includes NaN and the infinities.
+var ErrInvalidGamma = errors.New("downscale: gamma must be within (0, 10]")
+
+// ErrTooLarge is returned when the least common multiple of a source and a
+// destination length does not fit in 32 bits, which the box filter needs to
+// weight pixels exactly, or when the 8-bit functions could not sum the
+// weighted pixels of one destination pixel in 32 bits.
+var ErrTooLarge = errors.New("downscale: image size is too large")
+
+// ErrDegenerateFilter is returned when the weights of a filter cannot be
+// represented for a pair of sizes, which would leave destination pixels
+// black or sampled from a single source pixel.
+var ErrDegenerateFilter = errors.New("downscale: filter weights vanish at this size")
+
+// PanicError is returned when a worker goroutine panics, for example on an
+// image whose fields are inconsistent. Value is what was passed to panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("downscale: worker panicked: %v", e.Value)
+}
+
 type handle struct {
-	m     sync.RWMutex
-	abort bool
+	abort int32 // accessed atomically
 	wg    sync.WaitGroup
+	every uint32 // rows between abort checks; zero means 8
+
+	rounding Rounding // the rounding of the box filter writes
+
+	m   sync.Mutex
+	err *PanicError // the first panic of a worker
 }
 
 func (h *handle) Wait(ctx context.Context) error {
-	complete := make(chan struct{})
+	// buffered so that the waiter never blocks on a receiver that is gone.
+	complete := make(chan struct{}, 1)
 	go func() {
 		h.wg.Wait()
 		complete <- struct{}{}
 	}()
 	select {
 	case <-complete:
-		return nil
 	case <-ctx.Done():
 		h.SetAbort()
 		<-complete
+		if err := h.panicked(); err != nil {
+			return err
+		}
 		return ErrAborted
 	}
+	return h.panicked()
+}
+
+// fail records err and aborts the remaining work.
+func (h *handle) fail(err *PanicError) {
+	h.m.Lock()
+	if h.err == nil {
+		h.err = err
+	}
+	h.m.Unlock()
+	h.SetAbort()
+}
+
+func (h *handle) panicked() error {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.err == nil {
+		return nil
+	}
+	return h.err
+}
+
+// pass takes the result of a nested pass so that a panic in one of its
+// workers is returned by h.Wait as well.
+func (h *handle) pass(err error) {
+	if pe, ok := err.(*PanicError); ok {
+		h.fail(pe)
+	}
 }
 
 func (h *handle) SetAbort() {
@@ -36,9 +112,7 @@ func (h *handle) SetAbort() {
 		return
 	}
 
-	h.m.Lock()
-	h.abort = true
-	h.m.Unlock()
+	atomic.StoreInt32(&h.abort, 1)
 }
 
 func (h *handle) Aborted() bool {
@@ -46,19 +120,78 @@ func (h *handle) Aborted() bool {
 		return false
 	}
 
-	h.m.RLock()
-	abort := h.abort
-	h.m.RUnlock()
-	return abort
+	return atomic.LoadInt32(&h.abort) != 0
 }
 
+// abortedAt reports whether the work has been aborted, checking only on the
+// last of every h.every rows so that the atomic load stays off the hot path.
+func (h *handle) abortedAt(i uint32) bool {
+	if h == nil {
+		return false
+	}
+	n := h.every
+	if n == 0 {
+		n = 8
+	}
+	return i%n == n-1 && h.Aborted()
+}
+
+// round returns the rounding of the box filter writes. A nil handle uses the
+// default.
+func (h *handle) round() Rounding {
+	if h == nil {
+		return RoundDefault
+	}
+	return h.rounding
+}
+
+// Done must be deferred directly so that it can recover a panic of the
+// worker.
 func (h *handle) Done() {
 	if h == nil {
 		return
 	}
+	if r := recover(); r != nil {
+		h.fail(&PanicError{Value: r, Stack: debug.Stack()})
+	}
 	h.wg.Done()
 }
 
+// checkPix reports an error when an image's Pix cannot hold every row of r,
+// which would otherwise panic inside a worker goroutine.
+func checkPix(name string, pix []byte, stride int, r image.Rectangle, bpp int) error {
+	if r.Empty() {
+		return nil
+	}
+	if stride < r.Dx()*bpp || len(pix) < (r.Dy()-1)*stride+r.Dx()*bpp {
+		return fmt.Errorf("downscale: %s.Pix (len %d, stride %d) is too small for %s.Rect %v", name, len(pix), stride, name, r)
+	}
+	return nil
+}
+
+// divider divides uint32 values by a fixed divisor with a multiplication,
+// as described in "Faster Remainder by Direct Computation" by Lemire et al.
+// The result is exact for every uint32 dividend.
+type divider struct {
+	m uint64
+	d uint32
+}
+
+func newDivider(d uint32) divider {
+	if d == 1 {
+		return divider{d: 1}
+	}
+	return divider{m: ^uint64(0)/uint64(d) + 1, d: d}
+}
+
+func (v divider) div(x uint32) uint32 {
+	if v.m == 0 {
+		return x
+	}
+	hi, _ := bits.Mul64(v.m, uint64(x))
+	return uint32(hi)
+}
+
 func gcd(a uint32, b uint32) uint32 {
 	if a == 0 {
 		return b
@@ -73,31 +206,209 @@ func gcd(a uint32, b uint32) uint32 {
 	return a
 }
 
+// overlaps reports whether a and b share any byte of memory.
+func overlaps(a []byte, b []byte) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	a0, b0 := uintptr(unsafe.Pointer(&a[0])), uintptr(unsafe.Pointer(&b[0]))
+	return a0 < b0+uintptr(len(b)) && b0 < a0+uintptr(len(a))
+}
+
+// IsCopy reports whether scaling an image of srcRect into dstRect keeps its
+// size, in which case the pixels are copied as they are.
+func IsCopy(srcRect image.Rectangle, dstRect image.Rectangle) bool {
+	return srcRect.Dx() == dstRect.Dx() && srcRect.Dy() == dstRect.Dy()
+}
+
 func lcm(a uint32, b uint32) uint32 {
-	return (a * b) / gcd(a, b)
+	return a / gcd(a, b) * b
+}
+
+// lcmFits reports whether lcm(a, b) can be represented as a uint32.
+func lcmFits(a int, b int) bool {
+	if a <= 0 || b <= 0 {
+		return true
+	}
+	return uint64(a)/uint64(gcd(uint32(a), uint32(b)))*uint64(b) <= math.MaxUint32
+}
+
+// peak8 and peak8RGBA are the largest values per unit of weight, rounding
+// bias included, that the 8-bit functions sum in a uint32: a sample, and a
+// straight color multiplied by its alpha.
+const (
+	peak8     = 256
+	peak8RGBA = 256 * 255
+)
+
+// sumFits is lcmFits for the 8-bit functions. The weights of one destination
+// pixel add up to dlcmlen, which is sl/gcd(sl, dl), so its sum stays below
+// dlcmlen*peak.
+func sumFits(sl int, dl int, peak uint64) bool {
+	if !lcmFits(sl, dl) {
+		return false
+	}
+	if sl <= 0 || dl <= 0 {
+		return true
+	}
+	return uint64(sl)/uint64(gcd(uint32(sl), uint32(dl)))*peak <= math.MaxUint32
+}
+
+// WeightTable holds the box-filter weights for scaling one direction from a
+// source length to a destination length. It is read-only once built and can
+// be shared between goroutines.
+type WeightTable struct {
+	tt, ft           []uint32
+	slcmlen, dlcmlen uint32
+}
+
+// NewWeightTable builds the table for scaling sl pixels down to dl pixels.
+// Both lengths must be non-zero, and their least common multiple must fit in
+// a uint32; RGBA reports ErrTooLarge for sizes where it does not. It returns
+// nil for such lengths, which no image size fits.
+func NewWeightTable(sl uint32, dl uint32) *WeightTable {
+	slcmlen, dlcmlen, tt, ft, err := lcmTable(sl, dl)
+	if err != nil {
+		return nil
+	}
+	return &WeightTable{tt: tt, ft: ft, slcmlen: slcmlen, dlcmlen: dlcmlen}
 }
 
-func makeTable(l uint32, dlcmlen uint32, slcmlen uint32) ([]uint32, []uint32) {
+// fits reports whether t scales sl pixels to dl pixels. A nil table fits
+// when no scaling is needed.
+func (t *WeightTable) fits(sl int, dl int) bool {
+	if t == nil {
+		return sl == dl
+	}
+	n := len(t.tt) - 1
+	return n == dl && int(t.tt[n]) == sl
+}
+
+// lcmTable builds the table for scaling sl pixels to dl pixels, along with
+// the lengths of a source and a destination pixel in units of the least
+// common multiple of sl and dl.
+func lcmTable(sl uint32, dl uint32) (uint32, uint32, []uint32, []uint32, error) {
+	if sl == 0 || dl == 0 {
+		return 0, 0, nil, nil, ErrInvalidSize
+	}
+	if uint64(sl)/uint64(gcd(sl, dl))*uint64(dl) > math.MaxUint32 {
+		return 0, 0, nil, nil, ErrTooLarge
+	}
+	lcmlen := lcm(sl, dl)
+	slcmlen, dlcmlen := lcmlen/sl, lcmlen/dl
+	tt, ft, err := makeTable(dl, dlcmlen, slcmlen)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	return slcmlen, dlcmlen, tt, ft, nil
+}
+
+// makeTable reports an error instead of dividing by zero when a length is
+// zero, as it is after the least common multiple wraps around.
+func makeTable(l uint32, dlcmlen uint32, slcmlen uint32) ([]uint32, []uint32, error) {
+	if l == 0 || dlcmlen == 0 || slcmlen == 0 {
+		return nil, nil, errors.New("downscale: degenerate weight table")
+	}
 	buf := make([]uint32, l*2+2)
 	tt := buf[:l+1]
 	ft := buf[l+1:]
+	// the products are taken in 64 bits since dlcmlen*(l+1) exceeds the
+	// least common multiple.
+	d, sl := uint64(dlcmlen), uint64(slcmlen)
 	for i := uint32(0); i <= l; i++ {
-		ft[i] = (dlcmlen * (i + 1)) % slcmlen
-		tt[i] = (dlcmlen * i) / slcmlen
+		ft[i] = uint32((d * uint64(i+1)) % sl)
+		tt[i] = uint32((d * uint64(i)) / sl)
+	}
+	return tt, ft, nil
+}
+
+type gammaTable struct {
+	t8  [256]uint16
+	t16 [65536]uint8
+}
+
+// gammaTables memoizes makeGammaTable by gamma value. The tables are never
+// written after they are built, so they can be shared by every caller.
+var gammaTables sync.Map
+
+func checkGamma(g float64) error {
+	if !(g > 0 && g <= 10) {
+		return ErrInvalidGamma
 	}
-	return tt, ft
+	return nil
+}
+
+func getGammaTable(g float64) (*[256]uint16, *[65536]uint8) {
+	if v, ok := gammaTables.Load(g); ok {
+		t := v.(*gammaTable)
+		return &t.t8, &t.t16
+	}
+	t := &gammaTable{}
+	t.t8, t.t16 = makeGammaTable(g)
+	if g == g { // NaN never matches itself, so do not let it pile up
+		if v, loaded := gammaTables.LoadOrStore(g, t); loaded {
+			t = v.(*gammaTable)
+		}
+	}
+	return &t.t8, &t.t16
 }
 
 func makeGammaTable(g float64) ([256]uint16, [65536]uint8) {
+	t := makeDecodeTable(g)
+
+	g = 1.0 / g
+	var rt [65536]uint8
+	for i := range rt {
+		rt[i] = uint8(math.Pow(float64(i)/65535, g) * 255)
+	}
+	return t, rt
+}
+
+// makeDecodeTable returns the first table of makeGammaTable, which maps 8-bit
+// values to linear 16-bit ones.
+func makeDecodeTable(g float64) [256]uint16 {
 	var t [256]uint16
 	for i := range t {
 		t[i] = uint16(math.Pow(float64(i)/255, g) * 65535)
 	}
+	return t
+}
+
+var (
+	srgbOnce  sync.Once
+	srgbTable gammaTable
+)
+
+// getSRGBTable returns the sRGB tables, built by the first call. Like the
+// tables of getGammaTable, they are shared by every caller.
+func getSRGBTable() (*[256]uint16, *[65536]uint8) {
+	srgbOnce.Do(func() {
+		srgbTable.t8, srgbTable.t16 = makeSRGBTable()
+	})
+	return &srgbTable.t8, &srgbTable.t16
+}
+
+func makeSRGBTable() ([256]uint16, [65536]uint8) {
+	var t [256]uint16
+	for i := range t {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		t[i] = uint16(v*65535 + 0.5)
+	}
 
-	g = 1.0 / g
 	var rt [65536]uint8
 	for i := range rt {
-		rt[i] = uint8(math.Pow(float64(i)/65535, g) * 255)
+		v := float64(i) / 65535
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		rt[i] = uint8(v*255 + 0.5)
 	}
 	return t, rt
 }
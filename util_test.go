@@ -0,0 +1,89 @@
+package downscale
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestCancel(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	funcs := map[string]func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error{
+		"RGBA": RGBA,
+		"RGBAGamma": func(ctx context.Context, dest *image.RGBA, src *image.RGBA, opts ...Option) error {
+			return RGBAGamma(ctx, dest, src, 2.2, opts...)
+		},
+		"RGBALanczos": RGBALanczos,
+	}
+	for name, fn := range funcs {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Millisecond)
+		start := time.Now()
+		err := fn(ctx, image.NewRGBA(image.Rect(0, 0, 1222, 1333)), src)
+		elapsed := time.Since(start)
+		cancel()
+		if err != ErrAborted {
+			t.Errorf("%s: want ErrAborted, got %v", name, err)
+		}
+		if elapsed > time.Second {
+			t.Errorf("%s: took %v to give up", name, elapsed)
+		}
+	}
+}
+
+func TestWorkerPanic(t *testing.T) {
+	ctx := context.Background()
+	// Gray16 trusts Pix, so the rows past its end panic inside the workers.
+	for _, sz := range []image.Point{{30, 20}, {60, 10}, {30, 40}} {
+		src := image.NewGray16(image.Rect(0, 0, 60, 40))
+		src.Pix = src.Pix[:60*10*2]
+		err := Gray16(ctx, image.NewGray16(image.Rect(0, 0, sz.X, sz.Y)), src)
+		var pe *PanicError
+		if !errors.As(err, &pe) {
+			t.Errorf("%v: want a *PanicError, got %v", sz, err)
+		}
+	}
+
+	h := &handle{}
+	h.wg.Add(2)
+	go func() {
+		defer h.Done()
+		panic("boom")
+	}()
+	go h.Done()
+	err := h.Wait(ctx)
+	if pe, ok := err.(*PanicError); !ok || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Errorf("want the recovered panic, got %v", err)
+	}
+	if !h.Aborted() {
+		t.Error("want the handle aborted after a panic")
+	}
+}
+
+func TestIsCopy(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 8, 6),
+		image.Rect(3, 2, 11, 8),
+		image.Rect(0, 0, 7, 6),
+		image.Rect(0, 0, 8, 5),
+	} {
+		dest := image.NewRGBA(r)
+		if err := RGBA(ctx, dest, src); err != nil {
+			t.Fatal(err)
+		}
+		copied := bytes.Equal(dest.Pix, src.Pix)
+		if got := IsCopy(src.Rect, r); got != copied {
+			t.Errorf("%v: want %v, got %v", r, copied, got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package xdraw lets downscale be used where a golang.org/x/image/draw
+// Scaler is expected.
+package xdraw
+
+import (
+	"context"
+	"image"
+	stddraw "image/draw"
+
+	"github.com/oov/downscale"
+	"golang.org/x/image/draw"
+)
+
+// Scaler implements draw.Scaler with downscale.Scale.
+//
+// Requests it cannot serve, such as enlarging, masks, or a source rectangle
+// that is not inside the source image, are passed to Fallback, or to
+// draw.CatmullRom when Fallback is nil.
+type Scaler struct {
+	Fallback draw.Scaler
+	Options  []downscale.Option
+}
+
+// Box is a Scaler with the default options.
+var Box draw.Scaler = Scaler{}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+func (s Scaler) Scale(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle, op draw.Op, opts *draw.Options) {
+	if dr.Empty() || sr.Empty() {
+		return
+	}
+	if !s.scale(dst, dr, src, sr, op, opts) {
+		s.fallback().Scale(dst, dr, src, sr, op, opts)
+	}
+}
+
+func (s Scaler) fallback() draw.Scaler {
+	if s.Fallback != nil {
+		return s.Fallback
+	}
+	return draw.CatmullRom
+}
+
+func (s Scaler) scale(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle, op draw.Op, opts *draw.Options) bool {
+	if opts != nil && (opts.SrcMask != nil || opts.DstMask != nil) {
+		return false
+	}
+	if dr.Dx() > sr.Dx() || dr.Dy() > sr.Dy() || !sr.In(src.Bounds()) {
+		return false
+	}
+	if sr != src.Bounds() {
+		si, ok := src.(subImager)
+		if !ok {
+			return false
+		}
+		src = si.SubImage(sr)
+	}
+
+	ctx := context.Background()
+	if op == draw.Src && dr.In(dst.Bounds()) {
+		if di, ok := dst.(subImager); ok {
+			if d, ok := di.SubImage(dr).(stddraw.Image); ok {
+				return downscale.Scale(ctx, d, src, s.Options...) == nil
+			}
+		}
+	}
+
+	// draw.Draw composites the premultiplied result with op and clips it to
+	// dst.
+	tmp := image.NewRGBA(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	if err := downscale.Scale(ctx, tmp, src, s.Options...); err != nil {
+		return false
+	}
+	stddraw.Draw(dst, dr, tmp, image.Point{}, op)
+	return true
+}
@@ -0,0 +1,83 @@
+package xdraw
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func TestScaleSubRect(t *testing.T) {
+	bg := color.RGBA{R: 255, A: 255}
+	half := color.RGBA{B: 128, A: 128}
+	src := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	fill(src, src.Rect, half)
+
+	dr := image.Rect(5, 6, 15, 16)
+	for _, op := range []draw.Op{draw.Src, draw.Over} {
+		dst := image.NewRGBA(image.Rect(0, 0, 20, 20))
+		fill(dst, dst.Rect, bg)
+		Box.Scale(dst, dr, src, src.Rect, op, nil)
+
+		inside := half
+		if op == draw.Over {
+			// 128/255 of blue over opaque red
+			inside = color.RGBA{R: 127, B: 128, A: 255}
+		}
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 20; x++ {
+				want := bg
+				if (image.Point{x, y}).In(dr) {
+					want = inside
+				}
+				if got := dst.RGBAAt(x, y); got != want {
+					t.Fatalf("op %v (%d, %d): want %v, got %v", op, x, y, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestScaleSrcRect(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	fill(src, src.Rect, color.RGBA{R: 255, A: 255})
+	green := color.RGBA{G: 255, A: 255}
+	sr := image.Rect(20, 0, 40, 20)
+	fill(src, sr, green)
+
+	dst := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	Box.Scale(dst, dst.Rect, src, sr, draw.Src, nil)
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if got := dst.RGBAAt(x, y); got != green {
+				t.Fatalf("(%d, %d): want %v, got %v", x, y, green, got)
+			}
+		}
+	}
+}
+
+type recorder struct{ called bool }
+
+func (r *recorder) Scale(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle, op draw.Op, opts *draw.Options) {
+	r.called = true
+}
+
+func TestScaleFallback(t *testing.T) {
+	var r recorder
+	s := Scaler{Fallback: &r}
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	dst := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	s.Scale(dst, dst.Rect, src, src.Rect, draw.Src, nil)
+	if !r.called {
+		t.Error("want the fallback to handle enlarging")
+	}
+}
@@ -0,0 +1,202 @@
+package downscale
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+func YCbCr(ctx context.Context, dest *image.RGBA, src *image.YCbCr, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return ycbcr(ctx, dest, src, opts)
+	})
+}
+
+func ycbcr(ctx context.Context, dest *image.RGBA, src *image.YCbCr, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkYCbCr("src", src); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+
+	every := int(newOptions(opts).abortEvery())
+	tmp := image.NewYCbCr(image.Rect(0, 0, dw, dh), src.SubsampleRatio)
+	if err := downscaleYCbCr(ctx, tmp, src, opts...); err != nil {
+		return err
+	}
+
+	for y := 0; y < dh; y++ {
+		if y%every == every-1 && ctx.Err() != nil {
+			return ErrAborted
+		}
+		d := dest.Pix[y*dest.Stride : y*dest.Stride+dw<<2]
+		for x := 0; x < dw; x++ {
+			yi, ci := tmp.YOffset(x, y), tmp.COffset(x, y)
+			r, g, b := color.YCbCrToRGB(tmp.Y[yi], tmp.Cb[ci], tmp.Cr[ci])
+			d[x<<2+0] = r
+			d[x<<2+1] = g
+			d[x<<2+2] = b
+			d[x<<2+3] = 255
+		}
+	}
+	return nil
+}
+
+// NYCbCrA downscales each plane of src, including the alpha plane, and
+// converts the result into dest. As with YCbCr the planes are scaled
+// independently, so colors are averaged without weighting them by alpha.
+func NYCbCrA(ctx context.Context, dest *image.NRGBA, src *image.NYCbCrA, opts ...Option) error {
+	return metered(ctx, opts, src.Rect, dest.Rect, func(ctx context.Context) error {
+		return nycbcra(ctx, dest, src, opts)
+	})
+}
+
+func nycbcra(ctx context.Context, dest *image.NRGBA, src *image.NYCbCrA, opts []Option) error {
+	if err := checkPix("dest", dest.Pix, dest.Stride, dest.Rect, 4); err != nil {
+		return err
+	}
+	if err := checkYCbCr("src", &src.YCbCr); err != nil {
+		return err
+	}
+	if err := checkPlane("src.A", src.A, src.AStride, src.Rect); err != nil {
+		return err
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dest.Rect.Dx(), dest.Rect.Dy()
+	if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+		return ErrInvalidSize
+	}
+	if sw < dw || sh < dh {
+		return ErrUpscaleUnsupported
+	}
+
+	every := int(newOptions(opts).abortEvery())
+	tmp := image.NewNYCbCrA(image.Rect(0, 0, dw, dh), src.SubsampleRatio)
+	if err := downscaleYCbCr(ctx, &tmp.YCbCr, &src.YCbCr, opts...); err != nil {
+		return err
+	}
+	if err := Gray(ctx, &image.Gray{
+		Pix:    tmp.A,
+		Stride: tmp.AStride,
+		Rect:   image.Rect(0, 0, dw, dh),
+	}, &image.Gray{
+		Pix:    src.A,
+		Stride: src.AStride,
+		Rect:   image.Rect(0, 0, sw, sh),
+	}, opts...); err != nil {
+		return err
+	}
+
+	for y := 0; y < dh; y++ {
+		if y%every == every-1 && ctx.Err() != nil {
+			return ErrAborted
+		}
+		d := dest.Pix[y*dest.Stride : y*dest.Stride+dw<<2]
+		for x := 0; x < dw; x++ {
+			yi, ci := tmp.YOffset(x, y), tmp.COffset(x, y)
+			r, g, b := color.YCbCrToRGB(tmp.Y[yi], tmp.Cb[ci], tmp.Cr[ci])
+			d[x<<2+0] = r
+			d[x<<2+1] = g
+			d[x<<2+2] = b
+			d[x<<2+3] = tmp.A[tmp.AOffset(x, y)]
+		}
+	}
+	return nil
+}
+
+// downscaleYCbCr scales each plane of src into dest independently. Both
+// images must share the same subsample ratio.
+func downscaleYCbCr(ctx context.Context, dest *image.YCbCr, src *image.YCbCr, opts ...Option) error {
+	if err := Gray(ctx, &image.Gray{
+		Pix:    dest.Y,
+		Stride: dest.YStride,
+		Rect:   image.Rect(0, 0, dest.Rect.Dx(), dest.Rect.Dy()),
+	}, &image.Gray{
+		Pix:    src.Y,
+		Stride: src.YStride,
+		Rect:   image.Rect(0, 0, src.Rect.Dx(), src.Rect.Dy()),
+	}, opts...); err != nil {
+		return err
+	}
+
+	sc, dc := chromaRect(src.Rect, src.SubsampleRatio), chromaRect(dest.Rect, dest.SubsampleRatio)
+	if err := Gray(ctx, &image.Gray{
+		Pix:    dest.Cb,
+		Stride: dest.CStride,
+		Rect:   dc,
+	}, &image.Gray{
+		Pix:    src.Cb,
+		Stride: src.CStride,
+		Rect:   sc,
+	}, opts...); err != nil {
+		return err
+	}
+	return Gray(ctx, &image.Gray{
+		Pix:    dest.Cr,
+		Stride: dest.CStride,
+		Rect:   dc,
+	}, &image.Gray{
+		Pix:    src.Cr,
+		Stride: src.CStride,
+		Rect:   sc,
+	}, opts...)
+}
+
+// checkYCbCr reports an error when a plane of m cannot hold every row of
+// the part of the image it covers.
+func checkYCbCr(name string, m *image.YCbCr) error {
+	if err := checkPlane(name+".Y", m.Y, m.YStride, m.Rect); err != nil {
+		return err
+	}
+	c := chromaRect(m.Rect, m.SubsampleRatio)
+	if err := checkPlane(name+".Cb", m.Cb, m.CStride, c); err != nil {
+		return err
+	}
+	return checkPlane(name+".Cr", m.Cr, m.CStride, c)
+}
+
+// checkPlane is checkPix for a plane of one byte per sample that starts at
+// the top left of r.
+func checkPlane(name string, pix []byte, stride int, r image.Rectangle) error {
+	if r.Empty() {
+		return nil
+	}
+	if stride < r.Dx() || len(pix) < (r.Dy()-1)*stride+r.Dx() {
+		return fmt.Errorf("downscale: %s (len %d, stride %d) is too small for %v", name, len(pix), stride, r)
+	}
+	return nil
+}
+
+// chromaRect returns the extent of the chroma planes of an image.YCbCr
+// whose luma plane covers r, as laid out by image.NewYCbCr.
+func chromaRect(r image.Rectangle, ratio image.YCbCrSubsampleRatio) image.Rectangle {
+	var hx, hy uint
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		hx = 1
+	case image.YCbCrSubsampleRatio420:
+		hx, hy = 1, 1
+	case image.YCbCrSubsampleRatio440:
+		hy = 1
+	case image.YCbCrSubsampleRatio411:
+		hx = 2
+	case image.YCbCrSubsampleRatio410:
+		hx, hy = 2, 1
+	}
+	return image.Rect(
+		r.Min.X>>hx,
+		r.Min.Y>>hy,
+		(r.Max.X+1<<hx-1)>>hx,
+		(r.Max.Y+1<<hy-1)>>hy,
+	)
+}
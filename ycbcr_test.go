@@ -0,0 +1,110 @@
+package downscale
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestYCbCr(t *testing.T) {
+	ratios := []image.YCbCrSubsampleRatio{
+		image.YCbCrSubsampleRatio444,
+		image.YCbCrSubsampleRatio422,
+		image.YCbCrSubsampleRatio420,
+	}
+	ctx := context.Background()
+	for _, ratio := range ratios {
+		src := image.NewYCbCr(image.Rect(0, 0, 101, 77), ratio)
+		for y := 0; y < 77; y++ {
+			for x := 0; x < 101; x++ {
+				src.Y[src.YOffset(x, y)] = uint8(x * 2)
+				src.Cb[src.COffset(x, y)] = uint8(96 + y/2)
+				src.Cr[src.COffset(x, y)] = uint8(160 - x/2)
+			}
+		}
+		got := image.NewRGBA(image.Rect(0, 0, 33, 20))
+		if err := YCbCr(ctx, got, src); err != nil {
+			t.Fatal(err)
+		}
+
+		rgba := image.NewRGBA(src.Rect)
+		draw.Draw(rgba, rgba.Rect, src, image.Point{}, draw.Src)
+		want := image.NewRGBA(got.Rect)
+		if err := RGBA(ctx, want, rgba); err != nil {
+			t.Fatal(err)
+		}
+		// the chroma planes stay subsampled until the final conversion, so a
+		// small difference from the full-resolution reference is expected.
+		for i := range got.Pix {
+			if d := int(got.Pix[i]) - int(want.Pix[i]); d > 5 || d < -5 {
+				t.Errorf("%v: Pix[%d]: want %d, got %d", ratio, i, want.Pix[i], got.Pix[i])
+			}
+		}
+	}
+}
+
+func TestNYCbCrA(t *testing.T) {
+	ctx := context.Background()
+	src := image.NewNYCbCrA(image.Rect(0, 0, 101, 77), image.YCbCrSubsampleRatio420)
+	for y := 0; y < 77; y++ {
+		for x := 0; x < 101; x++ {
+			src.Y[src.YOffset(x, y)] = 100
+			src.Cb[src.COffset(x, y)] = 110
+			src.Cr[src.COffset(x, y)] = 140
+			src.A[src.AOffset(x, y)] = uint8(x * 255 / 100)
+		}
+	}
+	got := image.NewNRGBA(image.Rect(0, 0, 33, 20))
+	if err := NYCbCrA(ctx, got, src); err != nil {
+		t.Fatal(err)
+	}
+
+	alpha := image.NewGray(got.Rect)
+	if err := Gray(ctx, alpha, &image.Gray{Pix: src.A, Stride: src.AStride, Rect: src.Rect}); err != nil {
+		t.Fatal(err)
+	}
+	r, g, b := color.YCbCrToRGB(100, 110, 140)
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 33; x++ {
+			want := color.NRGBA{r, g, b, alpha.GrayAt(x, y).Y}
+			if c := got.NRGBAAt(x, y); c != want {
+				t.Fatalf("(%d, %d): want %v, got %v", x, y, want, c)
+			}
+		}
+	}
+	if got.NRGBAAt(0, 0).A >= got.NRGBAAt(32, 0).A {
+		t.Error("want the alpha gradient to be kept")
+	}
+}
+
+func TestYCbCrShortPlane(t *testing.T) {
+	ctx := context.Background()
+	r := image.Rect(0, 0, 40, 30)
+	for _, plane := range []string{"Y", "Cb", "Cr", "A"} {
+		src := image.NewNYCbCrA(r, image.YCbCrSubsampleRatio420)
+		switch plane {
+		case "Y":
+			src.Y = src.Y[:10]
+		case "Cb":
+			src.Cb = src.Cb[:10]
+		case "Cr":
+			src.Cr = src.Cr[:10]
+		case "A":
+			src.A = src.A[:10]
+		}
+		dest := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		err := NYCbCrA(ctx, dest, src)
+		if _, ok := err.(*PanicError); ok || err == nil {
+			t.Errorf("NYCbCrA short %s: want a size error, got %v", plane, err)
+		}
+		if plane == "A" {
+			continue
+		}
+		err = YCbCr(ctx, image.NewRGBA(dest.Rect), &src.YCbCr)
+		if _, ok := err.(*PanicError); ok || err == nil {
+			t.Errorf("YCbCr short %s: want a size error, got %v", plane, err)
+		}
+	}
+}